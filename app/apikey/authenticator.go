@@ -0,0 +1,76 @@
+package apikey
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+// lastUsedResolution limits how often usage is written back, so a busy CI
+// job does not turn every request into a database write.
+const lastUsedResolution = time.Minute
+
+var (
+	ErrInvalidApiKey     = apperror.New(apperror.CodeUnauthorized, "invalid or expired api key")
+	ErrInsufficientScope = apperror.New(apperror.CodeForbidden, "api key lacks the required scope")
+)
+
+// Authenticator resolves the key presented by a request to its owner. Keys
+// with only the read scope are limited to safe methods.
+type Authenticator struct {
+	repository domain.ApiKeyRepository
+}
+
+func NewAuthenticator(repository domain.ApiKeyRepository) *Authenticator {
+	return &Authenticator{repository: repository}
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, key string, method string, clientIP string) (*domain.ApiKey, error) {
+	prefix, ok := security.ParseApiKeyPrefix(key)
+	if !ok {
+		return nil, ErrInvalidApiKey
+	}
+
+	// Prefixes are unique across tenants and the key decides the tenant of
+	// the request, so the lookup cannot be scoped to one.
+	apiKey, err := a.repository.GetByPrefix(tenant.AllTenants(ctx), prefix)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, ErrInvalidApiKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(security.HashApiKey(key))) != 1 || !apiKey.IsActive(now) {
+		return nil, ErrInvalidApiKey
+	}
+
+	if !apiKey.HasScope(requiredScope(method)) && !apiKey.HasScope(domain.ApiKeyScopeWrite) {
+		return nil, ErrInsufficientScope
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > lastUsedResolution || apiKey.LastUsedIp != clientIP {
+		if err := a.repository.TouchLastUsed(tenant.WithTenant(ctx, apiKey.TenantId, tenant.SourceToken), apiKey.Id, now, clientIP); err != nil {
+			zap.L().Error("failed to track api key usage", zap.String("apiKeyId", apiKey.Id), zap.Error(err))
+		}
+	}
+
+	return apiKey, nil
+}
+
+func requiredScope(method string) string {
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return domain.ApiKeyScopeRead
+	default:
+		return domain.ApiKeyScopeWrite
+	}
+}
@@ -0,0 +1,64 @@
+package apikey
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+var (
+	ErrUnauthorized = apperror.New(apperror.CodeUnauthorized, "unauthorized")
+)
+
+type ApiKeyCreateRequest struct {
+	Name      string     `json:"name" validate:"required,min=2,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1,dive,oneof=read write"`
+	ExpiresAt *time.Time `json:"expiresAt" validate:"omitempty,gt"`
+}
+
+// ApiKeyCreateResponse is the only place the plain key is ever returned.
+type ApiKeyCreateResponse struct {
+	Key    string `json:"key"`
+	ApiKey ApiKey `json:"apiKey"`
+}
+
+type ApiKeyCreateHandler struct {
+	repository domain.ApiKeyRepository
+}
+
+func NewApiKeyCreateHandler(repository domain.ApiKeyRepository) *ApiKeyCreateHandler {
+	return &ApiKeyCreateHandler{repository: repository}
+}
+
+func (h *ApiKeyCreateHandler) Handle(ctx context.Context, request *ApiKeyCreateRequest) (*ApiKeyCreateResponse, error) {
+	userId, ok := auth.UserId(ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	key, prefix, err := security.GenerateApiKey()
+	if err != nil {
+		return nil, err
+	}
+
+	apiKey := &domain.ApiKey{
+		Id:        uuid.New().String(),
+		Name:      request.Name,
+		Prefix:    prefix,
+		KeyHash:   security.HashApiKey(key),
+		Scopes:    request.Scopes,
+		ExpiresAt: request.ExpiresAt,
+		UserId:    userId,
+	}
+
+	if err := h.repository.Create(ctx, apiKey); err != nil {
+		return nil, err
+	}
+
+	return &ApiKeyCreateResponse{Key: key, ApiKey: NewApiKey(apiKey)}, nil
+}
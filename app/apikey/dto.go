@@ -0,0 +1,34 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+// ApiKey is an API key as clients see it, without the hash of the key.
+type ApiKey struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIp string     `json:"lastUsedIp,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func NewApiKey(apiKey *domain.ApiKey) ApiKey {
+	return ApiKey{
+		Id:         apiKey.Id,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		ExpiresAt:  apiKey.ExpiresAt,
+		RevokedAt:  apiKey.RevokedAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		LastUsedIp: apiKey.LastUsedIp,
+		CreatedAt:  apiKey.CreatedAt,
+	}
+}
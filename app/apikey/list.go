@@ -0,0 +1,39 @@
+package apikey
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+)
+
+type ApiKeyListRequest struct{}
+
+type ApiKeyListResponse struct {
+	ApiKeys []ApiKey `json:"apiKeys"`
+}
+
+type ApiKeyListHandler struct {
+	repository domain.ApiKeyRepository
+}
+
+func NewApiKeyListHandler(repository domain.ApiKeyRepository) *ApiKeyListHandler {
+	return &ApiKeyListHandler{repository: repository}
+}
+
+func (h *ApiKeyListHandler) Handle(ctx context.Context, request *ApiKeyListRequest) (*ApiKeyListResponse, error) {
+	userId, ok := auth.UserId(ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	apiKeys, err := h.repository.ListByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	response := &ApiKeyListResponse{ApiKeys: make([]ApiKey, len(apiKeys))}
+	for i := range apiKeys {
+		response.ApiKeys[i] = NewApiKey(&apiKeys[i])
+	}
+	return response, nil
+}
@@ -0,0 +1,34 @@
+package apikey
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+)
+
+type ApiKeyRevokeRequest struct {
+	Id string `params:"id" validate:"required,uuid4"`
+}
+
+type ApiKeyRevokeResponse struct{}
+
+type ApiKeyRevokeHandler struct {
+	repository domain.ApiKeyRepository
+}
+
+func NewApiKeyRevokeHandler(repository domain.ApiKeyRepository) *ApiKeyRevokeHandler {
+	return &ApiKeyRevokeHandler{repository: repository}
+}
+
+func (h *ApiKeyRevokeHandler) Handle(ctx context.Context, request *ApiKeyRevokeRequest) (*ApiKeyRevokeResponse, error) {
+	userId, ok := auth.UserId(ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	if err := h.repository.Revoke(ctx, userId, request.Id); err != nil {
+		return nil, err
+	}
+	return &ApiKeyRevokeResponse{}, nil
+}
@@ -2,13 +2,23 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
 	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
 	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEmailNotVerified   = apperror.New(apperror.CodeForbidden, "email address is not verified")
+	ErrInvalidCredentials = apperror.New(apperror.CodeUnauthorized, "invalid email or password")
 )
 
 type LoginRequest struct {
@@ -16,59 +26,109 @@ type LoginRequest struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+// LoginResponse carries either the token pair or, for accounts with MFA
+// enabled, a short lived challenge token to be completed at /auth/mfa/verify.
 type LoginResponse struct {
-	Token        string `json:"token"`
-	RefreshToken string `json:"refreshToken"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	MfaRequired  bool   `json:"mfaRequired,omitempty"`
+	MfaToken     string `json:"mfaToken,omitempty"`
 }
 
 type LoginHandler struct {
-	repository             domain.UserRepository
-	refreshTokenRepository domain.RefreshTokenRepository
-	config                 config.SecurityConfig
+	repository domain.UserRepository
+	hasher     security.PasswordHasher
+	issuer     *TokenIssuer
+	throttle   *LoginThrottle
+	config     config.SecurityConfig
+	dummyHash  string
 }
 
-func NewLoginHandler(repository domain.UserRepository, refreshTokenRepository domain.RefreshTokenRepository, config config.SecurityConfig) *LoginHandler {
-	return &LoginHandler{repository: repository, refreshTokenRepository: refreshTokenRepository, config: config}
+func NewLoginHandler(repository domain.UserRepository, hasher security.PasswordHasher, issuer *TokenIssuer, throttle *LoginThrottle, config config.SecurityConfig) *LoginHandler {
+	// Unknown emails are compared against this hash so they take as long as
+	// a wrong password and cannot be told apart by timing.
+	dummyHash, err := hasher.Hash(uuid.New().String())
+	if err != nil {
+		panic(fmt.Errorf("fatal error generating dummy password hash: %w", err))
+	}
+
+	return &LoginHandler{repository: repository, hasher: hasher, issuer: issuer, throttle: throttle, config: config, dummyHash: dummyHash}
 }
 
 func (h *LoginHandler) Handle(ctx context.Context, request *LoginRequest) (*LoginResponse, error) {
+	clientIP := requestctx.ClientIP(ctx)
+	if err := h.throttle.Check(ctx, request.Email, clientIP); err != nil {
+		return nil, err
+	}
+
 	user, err := h.repository.GetByEmail(ctx, request.Email)
+	if errors.Is(err, domain.ErrNotFound) {
+		_ = h.hasher.Verify(request.Password, h.dummyHash)
+		h.throttle.Failure(ctx, request.Email, clientIP)
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if err := security.ValidatePassw(request.Password, user.Password); err != nil {
-		return nil, err
+	if err := h.hasher.Verify(request.Password, user.Password); err != nil {
+		if !errors.Is(err, security.ErrPasswordMismatch) {
+			logUnverifiableHash(user, err)
+		}
+		h.throttle.Failure(ctx, request.Email, clientIP)
+		return nil, ErrInvalidCredentials
 	}
-	claims := jwt.MapClaims{
-		"sub":      user.Id,
-		"email":    user.Email,
-		"fullName": user.FirstName + " " + user.LastName,
-		"exp":      time.Now().Add(time.Minute * time.Duration(h.config.MinutesOfJwtExpiration)).Unix(),
+	h.throttle.Success(ctx, request.Email)
+	h.rehashIfNeeded(ctx, user, request.Password)
+
+	if h.config.EmailVerification.Required && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString([]byte(h.config.JwtSecretKey))
-	if err != nil {
-		return nil, err
+	if user.MfaEnabled {
+		return mfaChallenge(h.config, user)
 	}
 
-	rt, err := security.GenerateRefreshToken()
+	return h.issuer.Issue(ctx, user)
+}
+
+// mfaChallenge answers a completed first factor of an MFA enabled account
+// with the challenge token instead of the token pair.
+func mfaChallenge(config config.SecurityConfig, user *domain.User) (*LoginResponse, error) {
+	ttl := time.Duration(config.Mfa.MinutesOfChallengeExpiration) * time.Minute
+	challenge, err := security.SignPurposeToken(config.JwtSecretKey, security.PurposeClaims{
+		Purpose:          security.PurposeMfaChallenge,
+		Tenant:           user.TenantId,
+		RegisteredClaims: jwt.RegisteredClaims{ID: uuid.New().String(), Subject: user.Id},
+	}, ttl)
 	if err != nil {
 		return nil, err
 	}
+	return &LoginResponse{MfaRequired: true, MfaToken: challenge}, nil
+}
+
+// logUnverifiableHash reports a stored hash that is malformed or of an
+// unknown algorithm. The client only learns that the password is wrong.
+func logUnverifiableHash(user *domain.User, err error) {
+	zap.L().Error("stored password hash cannot be verified", zap.String("userId", user.Id), zap.Error(err))
+}
 
-	refreshToken := domain.RefreshToken{
-		Id:        uuid.New().String(),
-		Token:     rt,
-		ExpiresAt: time.Now().Add(time.Duration(h.config.HoursOfRefreshTokenExpiration) * time.Hour),
-		UserId:    user.Id,
+// rehashIfNeeded upgrades the stored hash to the current algorithm and
+// parameters while the plain password is at hand. Failures only delay the
+// upgrade to the next login.
+func (h *LoginHandler) rehashIfNeeded(ctx context.Context, user *domain.User, password string) {
+	if !h.hasher.NeedsRehash(user.Password) {
+		return
 	}
 
-	err = h.refreshTokenRepository.Create(ctx, &refreshToken)
+	hashed, err := h.hasher.Hash(password)
 	if err != nil {
-		return nil, err
+		zap.L().Error("failed to rehash password", zap.String("userId", user.Id), zap.Error(err))
+		return
 	}
 
-	return &LoginResponse{Token: t, RefreshToken: rt}, nil
+	user.Password = hashed
+	if err := h.repository.Update(ctx, user); err != nil {
+		zap.L().Error("failed to store rehashed password", zap.String("userId", user.Id), zap.Error(err))
+	}
 }
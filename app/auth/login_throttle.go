@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrTooManyLoginAttempts = apperror.New(apperror.CodeTooManyRequests, "too many failed login attempts, try again later")
+)
+
+// LoginThrottle tracks failed logins per account and per client IP and locks
+// a key out with an exponentially growing duration once it exceeds its limit.
+// Accounts are keyed by the submitted email, whether or not it exists, so a
+// lockout does not reveal which addresses are registered.
+type LoginThrottle struct {
+	store     domain.LoginAttemptStore
+	publisher domain.SecurityEventPublisher
+	config    config.LoginThrottleConfig
+}
+
+func NewLoginThrottle(store domain.LoginAttemptStore, publisher domain.SecurityEventPublisher, config config.LoginThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{store: store, publisher: publisher, config: config}
+}
+
+func (t *LoginThrottle) Check(ctx context.Context, email string, clientIP string) error {
+	now := time.Now()
+	for _, key := range t.keys(ctx, email, clientIP) {
+		attempt, err := t.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if attempt.IsLocked(now) {
+			return ErrTooManyLoginAttempts
+		}
+	}
+	return nil
+}
+
+// Failure records a failed attempt. Store errors are logged rather than
+// returned, the caller already answers with a credentials error.
+func (t *LoginThrottle) Failure(ctx context.Context, email string, clientIP string) {
+	now := time.Now()
+	window := time.Duration(t.config.MinutesOfFailureWindow) * time.Minute
+
+	limits := map[string]int{accountKey(ctx, email): t.config.MaxFailuresPerAccount}
+	if clientIP != "" {
+		limits[clientKey(clientIP)] = t.config.MaxFailuresPerIp
+	}
+
+	for key, limit := range limits {
+		attempt, err := t.store.RegisterFailure(ctx, key, now, window)
+		if err != nil {
+			zap.L().Error("failed to register login failure", zap.String("key", key), zap.Error(err))
+			continue
+		}
+		if attempt.Failures < limit {
+			continue
+		}
+
+		until := now.Add(t.lockout(attempt.Failures - limit))
+		if err := t.store.Lock(ctx, key, until); err != nil {
+			zap.L().Error("failed to lock login key", zap.String("key", key), zap.Error(err))
+			continue
+		}
+
+		eventType := domain.SecurityEventAccountLocked
+		if strings.HasPrefix(key, "ip:") {
+			eventType = domain.SecurityEventClientLocked
+		}
+		t.publisher.Publish(ctx, domain.SecurityEvent{
+			Type:       eventType,
+			Key:        key,
+			ClientIP:   clientIP,
+			Failures:   attempt.Failures,
+			Until:      until,
+			OccurredAt: now,
+		})
+	}
+}
+
+// Success clears the account counter. The IP counter is kept, otherwise an
+// attacker could reset it by logging into an account of their own.
+func (t *LoginThrottle) Success(ctx context.Context, email string) {
+	if err := t.store.Reset(ctx, accountKey(ctx, email)); err != nil {
+		zap.L().Error("failed to reset login attempts", zap.Error(err))
+	}
+}
+
+// lockout doubles the base duration for every failure beyond the limit.
+func (t *LoginThrottle) lockout(excess int) time.Duration {
+	base := time.Duration(t.config.SecondsOfBaseLockout) * time.Second
+	max := time.Duration(t.config.MinutesOfMaxLockout) * time.Minute
+
+	lockout := base
+	for i := 0; i < excess && lockout < max; i++ {
+		lockout *= 2
+	}
+	return min(lockout, max)
+}
+
+func (t *LoginThrottle) keys(ctx context.Context, email string, clientIP string) []string {
+	keys := []string{accountKey(ctx, email)}
+	if clientIP != "" {
+		keys = append(keys, clientKey(clientIP))
+	}
+	return keys
+}
+
+// accountKey includes the tenant, the same email may belong to an account
+// in each of them.
+func accountKey(ctx context.Context, email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if id, ok := tenant.FromContext(ctx); ok {
+		return "account:" + id + "/" + email
+	}
+	return "account:" + email
+}
+
+func clientKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+type MfaConfirmRequest struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// MfaConfirmResponse returns the recovery codes in plain text. They are only
+// stored hashed and cannot be shown again.
+type MfaConfirmResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MfaConfirmHandler struct {
+	repository             domain.UserRepository
+	recoveryCodeRepository domain.RecoveryCodeRepository
+	secondFactor           *secondFactor
+	config                 config.SecurityConfig
+}
+
+func NewMfaConfirmHandler(repository domain.UserRepository, recoveryCodeRepository domain.RecoveryCodeRepository, config config.SecurityConfig) *MfaConfirmHandler {
+	return &MfaConfirmHandler{
+		repository:             repository,
+		recoveryCodeRepository: recoveryCodeRepository,
+		secondFactor:           &secondFactor{repository: repository, recoveryCodeRepository: recoveryCodeRepository, config: config},
+		config:                 config,
+	}
+}
+
+func (h *MfaConfirmHandler) Handle(ctx context.Context, request *MfaConfirmRequest) (*MfaConfirmResponse, error) {
+	userId, err := userIdFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.repository.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MfaEnabled {
+		return nil, ErrMfaAlreadyEnabled
+	}
+
+	if err := h.secondFactor.verifyTOTP(ctx, user, request.Code); err != nil {
+		return nil, err
+	}
+
+	codes, err := security.GenerateRecoveryCodes(h.config.Mfa.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes := make([]domain.RecoveryCode, len(codes))
+	for i, code := range codes {
+		recoveryCodes[i] = domain.RecoveryCode{
+			Id:       uuid.New().String(),
+			CodeHash: security.HashRecoveryCode(h.config.Mfa.EncryptionKey, code),
+			UserId:   user.Id,
+		}
+	}
+
+	if err := h.recoveryCodeRepository.Replace(ctx, user.Id, recoveryCodes); err != nil {
+		return nil, err
+	}
+
+	user.MfaEnabled = true
+	if err := h.repository.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &MfaConfirmResponse{RecoveryCodes: codes}, nil
+}
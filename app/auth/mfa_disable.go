@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+// MfaDisableRequest re-authenticates the user with the password and a second
+// factor, so a stolen access token alone cannot turn MFA off.
+type MfaDisableRequest struct {
+	Password     string `json:"password" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recoveryCode" validate:"required_without=Code"`
+}
+
+type MfaDisableResponse struct{}
+
+type MfaDisableHandler struct {
+	repository             domain.UserRepository
+	recoveryCodeRepository domain.RecoveryCodeRepository
+	hasher                 security.PasswordHasher
+	secondFactor           *secondFactor
+	throttle               *LoginThrottle
+}
+
+func NewMfaDisableHandler(repository domain.UserRepository, recoveryCodeRepository domain.RecoveryCodeRepository, hasher security.PasswordHasher, throttle *LoginThrottle, config config.SecurityConfig) *MfaDisableHandler {
+	return &MfaDisableHandler{
+		repository:             repository,
+		recoveryCodeRepository: recoveryCodeRepository,
+		hasher:                 hasher,
+		secondFactor:           &secondFactor{repository: repository, recoveryCodeRepository: recoveryCodeRepository, config: config},
+		throttle:               throttle,
+	}
+}
+
+func (h *MfaDisableHandler) Handle(ctx context.Context, request *MfaDisableRequest) (*MfaDisableResponse, error) {
+	userId, err := userIdFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.repository.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.MfaEnabled {
+		return nil, ErrMfaNotEnabled
+	}
+
+	// Both factors are guessable with a stolen access token, so failures
+	// count towards the same lockout as wrong passwords at login.
+	clientIP := requestctx.ClientIP(ctx)
+	if err := h.throttle.Check(ctx, user.Email, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := h.hasher.Verify(request.Password, user.Password); err != nil {
+		if !errors.Is(err, security.ErrPasswordMismatch) {
+			logUnverifiableHash(user, err)
+		}
+		h.throttle.Failure(ctx, user.Email, clientIP)
+		return nil, ErrInvalidMfaApproval
+	}
+
+	if err := h.secondFactor.verify(ctx, user, request.Code, request.RecoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidMfaCode) {
+			h.throttle.Failure(ctx, user.Email, clientIP)
+			return nil, ErrInvalidMfaApproval
+		}
+		return nil, err
+	}
+	h.throttle.Success(ctx, user.Email)
+
+	if err := h.recoveryCodeRepository.DeleteByUser(ctx, user.Id); err != nil {
+		return nil, err
+	}
+
+	user.MfaEnabled = false
+	user.TotpSecret = ""
+	user.TotpLastCounter = 0
+	if err := h.repository.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &MfaDisableResponse{}, nil
+}
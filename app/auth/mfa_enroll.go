@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+type MfaEnrollRequest struct{}
+
+type MfaEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningUri string `json:"provisioningUri"`
+}
+
+type MfaEnrollHandler struct {
+	repository domain.UserRepository
+	config     config.SecurityConfig
+}
+
+func NewMfaEnrollHandler(repository domain.UserRepository, config config.SecurityConfig) *MfaEnrollHandler {
+	return &MfaEnrollHandler{repository: repository, config: config}
+}
+
+// Handle starts a TOTP enrollment. MFA stays disabled until the secret is
+// confirmed with a code, so an abandoned enrollment cannot lock a user out.
+func (h *MfaEnrollHandler) Handle(ctx context.Context, request *MfaEnrollRequest) (*MfaEnrollResponse, error) {
+	userId, err := userIdFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.repository.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.MfaEnabled {
+		return nil, ErrMfaAlreadyEnabled
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := security.EncryptSecret(h.config.Mfa.EncryptionKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TotpSecret = encrypted
+	user.TotpLastCounter = 0
+	if err := h.repository.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &MfaEnrollResponse{
+		Secret:          secret,
+		ProvisioningUri: security.TOTPProvisioningURI(h.config.Mfa.Issuer, user.Email, secret),
+	}, nil
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+var (
+	ErrInvalidMfaChallenge = apperror.New(apperror.CodeUnauthorized, "invalid or expired mfa challenge")
+)
+
+type MfaVerifyRequest struct {
+	MfaToken     string `json:"mfaToken" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recoveryCode" validate:"required_without=Code"`
+}
+
+type MfaVerifyHandler struct {
+	repository   domain.UserRepository
+	challenges   domain.UsedMfaChallengeRepository
+	issuer       *TokenIssuer
+	throttle     *LoginThrottle
+	secondFactor *secondFactor
+	config       config.SecurityConfig
+}
+
+func NewMfaVerifyHandler(repository domain.UserRepository, recoveryCodeRepository domain.RecoveryCodeRepository, challenges domain.UsedMfaChallengeRepository, issuer *TokenIssuer, throttle *LoginThrottle, config config.SecurityConfig) *MfaVerifyHandler {
+	return &MfaVerifyHandler{
+		repository:   repository,
+		challenges:   challenges,
+		issuer:       issuer,
+		throttle:     throttle,
+		secondFactor: &secondFactor{repository: repository, recoveryCodeRepository: recoveryCodeRepository, config: config},
+		config:       config,
+	}
+}
+
+// Handle completes a login that LoginHandler answered with mfaRequired.
+func (h *MfaVerifyHandler) Handle(ctx context.Context, request *MfaVerifyRequest) (*LoginResponse, error) {
+	claims, err := security.ParsePurposeToken(h.config.JwtSecretKey, security.PurposeMfaChallenge, request.MfaToken)
+	if err != nil || claims.ID == "" {
+		return nil, ErrInvalidMfaChallenge
+	}
+	ctx = withPurposeTenant(ctx, claims)
+
+	user, err := h.repository.Get(ctx, claims.Subject)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, ErrInvalidMfaChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.MfaEnabled {
+		return nil, ErrInvalidMfaChallenge
+	}
+
+	// Codes are guessable within a challenge's lifetime, so failures count
+	// towards the same lockout as wrong passwords.
+	clientIP := requestctx.ClientIP(ctx)
+	if err := h.throttle.Check(ctx, user.Email, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := h.secondFactor.verify(ctx, user, request.Code, request.RecoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidMfaCode) {
+			h.throttle.Failure(ctx, user.Email, clientIP)
+		}
+		return nil, err
+	}
+	h.throttle.Success(ctx, user.Email)
+
+	// A challenge completes one login only, even when it is answered again
+	// with the next code before it expires.
+	err = h.challenges.Use(ctx, claims.ID, claims.ExpiresAt.Time)
+	if errors.Is(err, domain.ErrAlreadyExists) {
+		return nil, ErrInvalidMfaChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return h.issuer.Issue(ctx, user)
+}
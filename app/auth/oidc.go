@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownIdentityProvider = apperror.New(apperror.CodeNotFound, "unknown identity provider")
+	ErrInvalidOidcState        = apperror.New(apperror.CodeInvalidArgument, "invalid or expired login state")
+	ErrExternalLoginDenied     = apperror.New(apperror.CodeUnauthorized, "external login was denied")
+	ErrExternalLoginFailed     = apperror.New(apperror.CodeUnauthorized, "external login failed")
+	ErrExternalAccountUnlinked = apperror.New(apperror.CodeConflict, "an account with this email already exists and cannot be linked automatically")
+	ErrExternalLoginNoAccount  = apperror.New(apperror.CodeForbidden, "no account is linked to this external identity")
+)
+
+// OidcStateCookie holds the state of a login in the browser that started
+// it. The callback only completes a login in that browser, so a callback URL
+// that leaks or is planted in another browser is of no use.
+const OidcStateCookie = "oidc_state"
+
+type OidcLoginRequest struct {
+	Provider string `params:"provider" validate:"required"`
+}
+
+type OidcLoginResponse struct {
+	AuthorizationUrl string       `json:"authorizationUrl"`
+	StateCookie      *http.Cookie `json:"-"`
+}
+
+// RedirectURL sends the browser straight to the provider.
+func (r *OidcLoginResponse) RedirectURL() string {
+	return r.AuthorizationUrl
+}
+
+func (r *OidcLoginResponse) Cookies() []*http.Cookie {
+	return []*http.Cookie{r.StateCookie}
+}
+
+type OidcLoginHandler struct {
+	providers  map[string]domain.IdentityProvider
+	repository domain.OidcLoginStateRepository
+	config     config.OidcConfig
+}
+
+func NewOidcLoginHandler(providers map[string]domain.IdentityProvider, repository domain.OidcLoginStateRepository, config config.OidcConfig) *OidcLoginHandler {
+	return &OidcLoginHandler{providers: providers, repository: repository, config: config}
+}
+
+func (h *OidcLoginHandler) Handle(ctx context.Context, request *OidcLoginRequest) (*OidcLoginResponse, error) {
+	provider, ok := h.providers[request.Provider]
+	if !ok {
+		return nil, ErrUnknownIdentityProvider
+	}
+
+	state, err := security.RandomURLToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := security.RandomURLToken(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := security.GeneratePKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	authorizationUrl, err := provider.AuthorizationURL(ctx, state, nonce, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := time.Duration(h.config.MinutesOfStateExpiration) * time.Minute
+	err = h.repository.Create(ctx, &domain.OidcLoginState{
+		State:        state,
+		Provider:     request.Provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Lax, because the provider sends the browser back with a top-level
+	// GET from its own site.
+	return &OidcLoginResponse{
+		AuthorizationUrl: authorizationUrl,
+		StateCookie: &http.Cookie{
+			Name:     OidcStateCookie,
+			Value:    state,
+			Path:     "/",
+			MaxAge:   int(ttl.Seconds()),
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}, nil
+}
+
+type OidcCallbackRequest struct {
+	Provider    string `params:"provider" validate:"required"`
+	State       string `query:"state" validate:"required"`
+	Code        string `query:"code" validate:"required_without=Error"`
+	Error       string `query:"error"`
+	StateCookie string `cookie:"oidc_state"`
+}
+
+// OidcCallbackHandler completes the authorization code flow and logs the
+// user in, linking or provisioning a local account on the first login.
+type OidcCallbackHandler struct {
+	providers          map[string]domain.IdentityProvider
+	stateRepository    domain.OidcLoginStateRepository
+	identityRepository domain.ExternalIdentityRepository
+	userRepository     domain.UserRepository
+	hasher             security.PasswordHasher
+	issuer             *TokenIssuer
+	config             config.SecurityConfig
+}
+
+func NewOidcCallbackHandler(providers map[string]domain.IdentityProvider, stateRepository domain.OidcLoginStateRepository, identityRepository domain.ExternalIdentityRepository, userRepository domain.UserRepository, hasher security.PasswordHasher, issuer *TokenIssuer, config config.SecurityConfig) *OidcCallbackHandler {
+	return &OidcCallbackHandler{
+		providers:          providers,
+		stateRepository:    stateRepository,
+		identityRepository: identityRepository,
+		userRepository:     userRepository,
+		hasher:             hasher,
+		issuer:             issuer,
+		config:             config,
+	}
+}
+
+func (h *OidcCallbackHandler) Handle(ctx context.Context, request *OidcCallbackRequest) (*LoginResponse, error) {
+	provider, ok := h.providers[request.Provider]
+	if !ok {
+		return nil, ErrUnknownIdentityProvider
+	}
+
+	// Checked before the state is consumed, so replaying a callback URL in
+	// another browser does not spoil the login of the one that started it.
+	if subtle.ConstantTimeCompare([]byte(request.StateCookie), []byte(request.State)) != 1 {
+		return nil, ErrInvalidOidcState
+	}
+
+	// The state is consumed before anything else so that a denied or failed
+	// attempt cannot be retried with it. The provider redirects back without
+	// a tenant, it is restored from the state instead.
+	state, err := h.stateRepository.Consume(tenant.AllTenants(ctx), request.State)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, ErrInvalidOidcState
+	}
+	if err != nil {
+		return nil, err
+	}
+	if state.Provider != request.Provider || time.Now().After(state.ExpiresAt) {
+		return nil, ErrInvalidOidcState
+	}
+	ctx = tenant.WithTenant(ctx, state.TenantId, tenant.SourceToken)
+
+	if request.Error != "" {
+		return nil, ErrExternalLoginDenied
+	}
+
+	claims, err := provider.Authenticate(ctx, request.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		zap.L().Warn("external login failed", zap.String("provider", request.Provider), zap.Error(err))
+		return nil, ErrExternalLoginFailed
+	}
+
+	user, err := h.resolveUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.config.EmailVerification.Required && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	if user.MfaEnabled {
+		return mfaChallenge(h.config, user)
+	}
+
+	return h.issuer.Issue(ctx, user)
+}
+
+// resolveUser finds the user linked to the external identity, linking or
+// provisioning one on the first login as configured.
+func (h *OidcCallbackHandler) resolveUser(ctx context.Context, claims *domain.ExternalIdentityClaims) (*domain.User, error) {
+	identity, err := h.identityRepository.GetByIssuerSubject(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		if err := h.identityRepository.TouchLastLogin(ctx, identity.Id, time.Now()); err != nil {
+			zap.L().Error("failed to record external login", zap.String("identityId", identity.Id), zap.Error(err))
+		}
+		return h.userRepository.Get(ctx, identity.UserId)
+	}
+	if !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+
+	user, err := h.userForNewIdentity(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	err = h.identityRepository.Create(ctx, &domain.ExternalIdentity{
+		Id:          uuid.New().String(),
+		Issuer:      claims.Issuer,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+		UserId:      user.Id,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (h *OidcCallbackHandler) userForNewIdentity(ctx context.Context, claims *domain.ExternalIdentityClaims) (*domain.User, error) {
+	if claims.Email == "" {
+		return nil, ErrExternalLoginNoAccount
+	}
+
+	existing, err := h.userRepository.GetByEmail(ctx, claims.Email)
+	if err == nil {
+		// Linking on an unverified email would let anyone who registers the
+		// address at the provider take over the local account.
+		if !h.config.Oidc.LinkByVerifiedEmail || !claims.EmailVerified {
+			return nil, ErrExternalAccountUnlinked
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, domain.ErrNotFound) {
+		return nil, err
+	}
+
+	if !h.config.Oidc.AutoProvision {
+		return nil, ErrExternalLoginNoAccount
+	}
+
+	// The account can only be used through the provider until a password
+	// is set, so it gets a hash of a random value nobody knows.
+	hashed, err := h.hasher.Hash(uuid.New().String())
+	if err != nil {
+		return nil, err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := &domain.User{
+		Id:            uuid.New().String(),
+		FirstName:     firstName,
+		LastName:      lastName,
+		Email:         claims.Email,
+		Password:      hashed,
+		EmailVerified: claims.EmailVerified,
+	}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	if err := h.userRepository.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,560 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure/oidc"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+const (
+	stubClientId     = "app"
+	stubClientSecret = "app-secret"
+	stubRedirectUrl  = "https://app.example/auth/oidc/stub/callback"
+)
+
+// stubIdP is an OpenID Connect provider serving discovery, its JWKS and a
+// token endpoint that checks the PKCE verifier of each code it handed out.
+type stubIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]stubGrant
+}
+
+type stubGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIdP{key: key, grants: make(map[string]stubGrant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the user logging in at the provider: it checks the
+// authorization request and returns the code and state of the redirect back.
+// Claims override those of the ID token, the nonce included.
+func (idp *stubIdP) authorize(t *testing.T, authorizationUrl string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+	parsed, err := url.Parse(authorizationUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("response_type") != "code" || query.Get("client_id") != stubClientId || query.Get("redirect_uri") != stubRedirectUrl {
+		t.Fatalf("unexpected authorization request %s", authorizationUrl)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request without a PKCE challenge: %s", authorizationUrl)
+	}
+
+	idTokenClaims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   stubClientId,
+		"sub":   "external-subject",
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idTokenClaims[name] = value
+	}
+
+	code := "code-" + query.Get("state")
+	idp.mu.Lock()
+	idp.grants[code] = stubGrant{challenge: query.Get("code_challenge"), claims: idTokenClaims}
+	idp.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientId, secret, ok := r.BasicAuth()
+	if !ok || clientId != stubClientId || secret != stubClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != stubRedirectUrl {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "stub"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": idToken})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+type oidcTest struct {
+	idp           *stubIdP
+	states        *fakeLoginStates
+	identities    *fakeExternalIdentities
+	users         *fakeUsers
+	refreshTokens *fakeRefreshTokens
+	login         *OidcLoginHandler
+	callback      *OidcCallbackHandler
+}
+
+func newOidcTest(t *testing.T, oidcConfig config.OidcConfig) *oidcTest {
+	t.Helper()
+	idp := newStubIdP(t)
+	providers := make(map[string]domain.IdentityProvider)
+	for _, name := range []string{"stub", "other"} {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       idp.server.URL,
+			ClientId:     stubClientId,
+			ClientSecret: stubClientSecret,
+			RedirectUrl:  stubRedirectUrl,
+			Scopes:       []string{"openid", "email", "profile"},
+		}, idp.server.Client())
+		t.Cleanup(provider.Close)
+		providers[name] = provider
+	}
+
+	oidcConfig.MinutesOfStateExpiration = 10
+	securityConfig := config.SecurityConfig{
+		JwtSecretKey:                  "test-secret",
+		MinutesOfJwtExpiration:        15,
+		HoursOfRefreshTokenExpiration: 24,
+		Mfa:                           config.MfaConfig{MinutesOfChallengeExpiration: 5},
+		Oidc:                          oidcConfig,
+	}
+
+	test := &oidcTest{
+		idp:           idp,
+		states:        &fakeLoginStates{states: make(map[string]*domain.OidcLoginState)},
+		identities:    &fakeExternalIdentities{},
+		users:         &fakeUsers{users: make(map[string]*domain.User)},
+		refreshTokens: &fakeRefreshTokens{},
+	}
+	test.login = NewOidcLoginHandler(providers, test.states, oidcConfig)
+	test.callback = NewOidcCallbackHandler(providers, test.states, test.identities, test.users, fakeHasher{}, NewTokenIssuer(test.refreshTokens, securityConfig), securityConfig)
+	return test
+}
+
+// start begins a login with the stub provider and has the user authorize
+// it, returning the callback request the browser would send.
+func (o *oidcTest) start(t *testing.T, claims jwt.MapClaims) *OidcCallbackRequest {
+	t.Helper()
+	response, err := o.login.Handle(tenantContext(), &OidcLoginRequest{Provider: "stub"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	code, state := o.idp.authorize(t, response.RedirectURL(), claims)
+	return &OidcCallbackRequest{Provider: "stub", State: state, Code: code, StateCookie: response.StateCookie.Value}
+}
+
+func tenantContext() context.Context {
+	return tenant.WithTenant(context.Background(), "default", tenant.SourceDefault)
+}
+
+func TestOidcLoginSetsStateCookie(t *testing.T) {
+	o := newOidcTest(t, config.OidcConfig{})
+	response, err := o.login.Handle(tenantContext(), &OidcLoginRequest{Provider: "stub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(response.RedirectURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := parsed.Query().Get("state")
+	cookie := response.StateCookie
+	if cookie.Name != OidcStateCookie || cookie.Value != state {
+		t.Fatalf("cookie %s=%s, want %s=%s", cookie.Name, cookie.Value, OidcStateCookie, state)
+	}
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge != 600 {
+		t.Fatalf("cookie attributes %+v", cookie)
+	}
+
+	stored := o.states.states[state]
+	if stored == nil || stored.TenantId != "default" || stored.Provider != "stub" {
+		t.Fatalf("stored state %+v", stored)
+	}
+	sum := sha256.Sum256([]byte(stored.CodeVerifier))
+	if parsed.Query().Get("code_challenge") != base64.RawURLEncoding.EncodeToString(sum[:]) {
+		t.Fatal("code challenge does not match the stored verifier")
+	}
+
+	if _, err := o.login.Handle(tenantContext(), &OidcLoginRequest{Provider: "unknown"}); !errors.Is(err, ErrUnknownIdentityProvider) {
+		t.Fatalf("unknown provider: err = %v", err)
+	}
+}
+
+func TestOidcCallbackExchangesCodeWithPKCE(t *testing.T) {
+	o := newOidcTest(t, config.OidcConfig{})
+	o.users.add(&domain.User{Id: "user-1", TenantId: "default", Email: "ada@example.com"})
+	o.identities.identities = append(o.identities.identities, domain.ExternalIdentity{Id: "identity-1", Issuer: o.idp.server.URL, Subject: "external-subject", UserId: "user-1"})
+
+	response, err := o.callback.Handle(context.Background(), o.start(t, nil))
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if response.Token == "" || response.RefreshToken == "" || response.MfaRequired {
+		t.Fatalf("response %+v", response)
+	}
+	if len(o.refreshTokens.tokens) != 1 || o.refreshTokens.tokens[0].UserId != "user-1" {
+		t.Fatalf("refresh tokens %+v", o.refreshTokens.tokens)
+	}
+	if o.identities.identities[0].LastLoginAt == nil {
+		t.Fatal("last login of the identity was not recorded")
+	}
+}
+
+func TestOidcCallbackRejectsWrongCodeVerifier(t *testing.T) {
+	o := newOidcTest(t, config.OidcConfig{AutoProvision: true})
+	request := o.start(t, jwt.MapClaims{"email": "ada@example.com", "email_verified": true})
+	o.states.states[request.State].CodeVerifier = "not-the-verifier"
+
+	if _, err := o.callback.Handle(context.Background(), request); !errors.Is(err, ErrExternalLoginFailed) {
+		t.Fatalf("err = %v, want %v", err, ErrExternalLoginFailed)
+	}
+	if len(o.users.users) != 0 {
+		t.Fatal("a user was provisioned without a code exchange")
+	}
+}
+
+func TestOidcCallbackRejectsInvalidState(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(o *oidcTest, request *OidcCallbackRequest)
+		want   error
+	}{
+		{"state cookie of another browser", func(o *oidcTest, request *OidcCallbackRequest) {
+			request.StateCookie = "another-browser"
+		}, ErrInvalidOidcState},
+		{"no state cookie", func(o *oidcTest, request *OidcCallbackRequest) {
+			request.StateCookie = ""
+		}, ErrInvalidOidcState},
+		{"unknown state", func(o *oidcTest, request *OidcCallbackRequest) {
+			request.State, request.StateCookie = "unknown", "unknown"
+		}, ErrInvalidOidcState},
+		{"provider mismatch", func(o *oidcTest, request *OidcCallbackRequest) {
+			request.Provider = "other"
+		}, ErrInvalidOidcState},
+		{"unknown provider", func(o *oidcTest, request *OidcCallbackRequest) {
+			request.Provider = "unknown"
+		}, ErrUnknownIdentityProvider},
+		{"expired state", func(o *oidcTest, request *OidcCallbackRequest) {
+			o.states.states[request.State].ExpiresAt = time.Now().Add(-time.Second)
+		}, ErrInvalidOidcState},
+		{"denied at the provider", func(o *oidcTest, request *OidcCallbackRequest) {
+			request.Code, request.Error = "", "access_denied"
+		}, ErrExternalLoginDenied},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOidcTest(t, config.OidcConfig{AutoProvision: true})
+			request := o.start(t, jwt.MapClaims{"email": "ada@example.com", "email_verified": true})
+			test.tamper(o, request)
+
+			if _, err := o.callback.Handle(context.Background(), request); !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			if len(o.users.users) != 0 || len(o.refreshTokens.tokens) != 0 {
+				t.Fatal("login completed with an invalid state")
+			}
+		})
+	}
+}
+
+func TestOidcCallbackKeepsStateForTheBrowserThatStartedTheLogin(t *testing.T) {
+	o := newOidcTest(t, config.OidcConfig{AutoProvision: true})
+	request := o.start(t, jwt.MapClaims{"email": "ada@example.com", "email_verified": true})
+
+	replayed := *request
+	replayed.StateCookie = ""
+	if _, err := o.callback.Handle(context.Background(), &replayed); !errors.Is(err, ErrInvalidOidcState) {
+		t.Fatalf("replayed callback: err = %v, want %v", err, ErrInvalidOidcState)
+	}
+
+	if _, err := o.callback.Handle(context.Background(), request); err != nil {
+		t.Fatalf("callback in the starting browser: %v", err)
+	}
+	if _, err := o.callback.Handle(context.Background(), request); !errors.Is(err, ErrInvalidOidcState) {
+		t.Fatalf("second callback: err = %v, want %v", err, ErrInvalidOidcState)
+	}
+}
+
+func TestOidcCallbackRejectsNonceMismatch(t *testing.T) {
+	o := newOidcTest(t, config.OidcConfig{AutoProvision: true})
+	request := o.start(t, jwt.MapClaims{"nonce": "replayed-id-token", "email": "ada@example.com", "email_verified": true})
+
+	if _, err := o.callback.Handle(context.Background(), request); !errors.Is(err, ErrExternalLoginFailed) {
+		t.Fatalf("err = %v, want %v", err, ErrExternalLoginFailed)
+	}
+	if len(o.users.users) != 0 {
+		t.Fatal("a user was provisioned from an ID token with another nonce")
+	}
+}
+
+func TestOidcCallbackLinksByEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		linkByEmail   bool
+		emailVerified bool
+		want          error
+	}{
+		{"verified email", true, true, nil},
+		{"unverified email", true, false, ErrExternalAccountUnlinked},
+		{"linking disabled", false, true, ErrExternalAccountUnlinked},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOidcTest(t, config.OidcConfig{LinkByVerifiedEmail: test.linkByEmail, AutoProvision: true})
+			o.users.add(&domain.User{Id: "user-1", TenantId: "default", Email: "ada@example.com"})
+			request := o.start(t, jwt.MapClaims{"email": "ada@example.com", "email_verified": test.emailVerified})
+
+			_, err := o.callback.Handle(context.Background(), request)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+			if test.want != nil {
+				if len(o.identities.identities) != 0 || len(o.refreshTokens.tokens) != 0 {
+					t.Fatal("identity linked to an account it could not be linked to")
+				}
+				return
+			}
+			if len(o.identities.identities) != 1 || o.identities.identities[0].UserId != "user-1" {
+				t.Fatalf("identities %+v", o.identities.identities)
+			}
+			if len(o.users.users) != 1 {
+				t.Fatal("a user was provisioned instead of linked")
+			}
+		})
+	}
+}
+
+func TestOidcCallbackProvisionsUsers(t *testing.T) {
+	o := newOidcTest(t, config.OidcConfig{AutoProvision: true})
+	request := o.start(t, jwt.MapClaims{"email": "ada@example.com", "email_verified": true, "given_name": "Ada", "family_name": "Lovelace"})
+
+	response, err := o.callback.Handle(context.Background(), request)
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if response.Token == "" {
+		t.Fatalf("response %+v", response)
+	}
+
+	user, err := o.users.GetByEmail(context.Background(), "ada@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.FirstName != "Ada" || user.LastName != "Lovelace" || !user.EmailVerified || user.EmailVerifiedAt == nil || user.TenantId != "default" {
+		t.Fatalf("provisioned user %+v", user)
+	}
+	if len(o.identities.identities) != 1 || o.identities.identities[0].UserId != user.Id || o.identities.identities[0].Issuer != o.idp.server.URL {
+		t.Fatalf("identities %+v", o.identities.identities)
+	}
+}
+
+func TestOidcCallbackWithoutAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+	}{
+		{"provisioning disabled", jwt.MapClaims{"email": "ada@example.com", "email_verified": true}},
+		{"no email", jwt.MapClaims{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			o := newOidcTest(t, config.OidcConfig{AutoProvision: test.claims["email"] == nil})
+			if _, err := o.callback.Handle(context.Background(), o.start(t, test.claims)); !errors.Is(err, ErrExternalLoginNoAccount) {
+				t.Fatalf("err = %v, want %v", err, ErrExternalLoginNoAccount)
+			}
+			if len(o.users.users) != 0 {
+				t.Fatal("a user was provisioned")
+			}
+		})
+	}
+}
+
+func TestOidcCallbackRequiresSecondFactor(t *testing.T) {
+	o := newOidcTest(t, config.OidcConfig{})
+	o.users.add(&domain.User{Id: "user-1", TenantId: "default", Email: "ada@example.com", MfaEnabled: true})
+	o.identities.identities = append(o.identities.identities, domain.ExternalIdentity{Id: "identity-1", Issuer: o.idp.server.URL, Subject: "external-subject", UserId: "user-1"})
+
+	response, err := o.callback.Handle(context.Background(), o.start(t, nil))
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if !response.MfaRequired || response.MfaToken == "" || response.Token != "" || response.RefreshToken != "" {
+		t.Fatalf("response %+v", response)
+	}
+	if len(o.refreshTokens.tokens) != 0 {
+		t.Fatal("tokens were issued before the second factor")
+	}
+}
+
+type fakeLoginStates struct {
+	states map[string]*domain.OidcLoginState
+}
+
+func (f *fakeLoginStates) Create(ctx context.Context, state *domain.OidcLoginState) error {
+	state.TenantId, _ = tenant.FromContext(ctx)
+	f.states[state.State] = state
+	return nil
+}
+
+func (f *fakeLoginStates) Consume(ctx context.Context, state string) (*domain.OidcLoginState, error) {
+	stored, ok := f.states[state]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	delete(f.states, state)
+	return stored, nil
+}
+
+func (f *fakeLoginStates) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+type fakeExternalIdentities struct {
+	identities []domain.ExternalIdentity
+}
+
+func (f *fakeExternalIdentities) Create(ctx context.Context, identity *domain.ExternalIdentity) error {
+	f.identities = append(f.identities, *identity)
+	return nil
+}
+
+func (f *fakeExternalIdentities) GetByIssuerSubject(ctx context.Context, issuer string, subject string) (*domain.ExternalIdentity, error) {
+	for i := range f.identities {
+		if f.identities[i].Issuer == issuer && f.identities[i].Subject == subject {
+			return &f.identities[i], nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (f *fakeExternalIdentities) TouchLastLogin(ctx context.Context, id string, at time.Time) error {
+	for i := range f.identities {
+		if f.identities[i].Id == id {
+			f.identities[i].LastLoginAt = &at
+		}
+	}
+	return nil
+}
+
+type fakeUsers struct {
+	domain.UserRepository
+	users map[string]*domain.User
+}
+
+func (f *fakeUsers) add(user *domain.User) {
+	f.users[user.Id] = user
+}
+
+func (f *fakeUsers) Create(ctx context.Context, user *domain.User) error {
+	user.TenantId, _ = tenant.FromContext(ctx)
+	f.users[user.Id] = user
+	return nil
+}
+
+func (f *fakeUsers) Get(ctx context.Context, id string) (*domain.User, error) {
+	if user, ok := f.users[id]; ok {
+		return user, nil
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (f *fakeUsers) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+type fakeRefreshTokens struct {
+	domain.RefreshTokenRepository
+	tokens []domain.RefreshToken
+}
+
+func (f *fakeRefreshTokens) Create(ctx context.Context, refreshToken *domain.RefreshToken) error {
+	f.tokens = append(f.tokens, *refreshToken)
+	return nil
+}
+
+type fakeHasher struct{}
+
+func (fakeHasher) Hash(password string) (string, error) {
+	return "hashed:" + password, nil
+}
+
+func (fakeHasher) Verify(password string, encoded string) error {
+	return nil
+}
+
+func (fakeHasher) NeedsRehash(encoded string) bool {
+	return false
+}
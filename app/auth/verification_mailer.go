@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+// VerificationMailer issues email verification tokens and mails them to the
+// user. It is shared by user creation and the resend command.
+type VerificationMailer struct {
+	repository domain.UserRepository
+	notifier   domain.Notifier
+	config     config.SecurityConfig
+}
+
+func NewVerificationMailer(repository domain.UserRepository, notifier domain.Notifier, config config.SecurityConfig) *VerificationMailer {
+	return &VerificationMailer{repository: repository, notifier: notifier, config: config}
+}
+
+func (m *VerificationMailer) SendVerification(ctx context.Context, user *domain.User) error {
+	ttl := time.Duration(m.config.EmailVerification.HoursOfTokenExpiration) * time.Hour
+	token, err := security.SignPurposeToken(m.config.JwtSecretKey, security.PurposeClaims{
+		Purpose: security.PurposeEmailVerification,
+		Email:   user.Email,
+		Tenant:  user.TenantId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject: user.Id,
+		},
+	}, ttl)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s?token=%s", m.config.EmailVerification.VerifyUrl, url.QueryEscape(token))
+	err = m.notifier.Notify(ctx, domain.Notification{
+		To:       user.Email,
+		Template: domain.TemplateEmailVerification,
+		Locale:   user.Locale,
+		Data: map[string]any{
+			"FirstName": user.FirstName,
+			"Link":      link,
+			"Hours":     m.config.EmailVerification.HoursOfTokenExpiration,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	user.VerificationSentAt = &now
+	return m.repository.Update(ctx, user)
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidVerificationToken = apperror.New(apperror.CodeInvalidArgument, "invalid or expired verification token")
+)
+
+type VerifyEmailRequest struct {
+	Token string `query:"token" validate:"required"`
+}
+
+type VerifyEmailResponse struct {
+	Verified bool `json:"verified"`
+}
+
+type VerifyEmailHandler struct {
+	repository domain.UserRepository
+	config     config.SecurityConfig
+}
+
+func NewVerifyEmailHandler(repository domain.UserRepository, config config.SecurityConfig) *VerifyEmailHandler {
+	return &VerifyEmailHandler{repository: repository, config: config}
+}
+
+func (h *VerifyEmailHandler) Handle(ctx context.Context, request *VerifyEmailRequest) (*VerifyEmailResponse, error) {
+	claims, err := security.ParsePurposeToken(h.config.JwtSecretKey, security.PurposeEmailVerification, request.Token)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	ctx = withPurposeTenant(ctx, claims)
+
+	user, err := h.repository.Get(ctx, claims.Subject)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A token issued for a previous address must not verify the current one.
+	if user.Email != claims.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if user.EmailVerified {
+		return &VerifyEmailResponse{Verified: true}, nil
+	}
+
+	now := time.Now()
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	if err := h.repository.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &VerifyEmailResponse{Verified: true}, nil
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResendVerificationResponse struct{}
+
+type ResendVerificationHandler struct {
+	repository domain.UserRepository
+	mailer     *VerificationMailer
+	config     config.SecurityConfig
+}
+
+func NewResendVerificationHandler(repository domain.UserRepository, mailer *VerificationMailer, config config.SecurityConfig) *ResendVerificationHandler {
+	return &ResendVerificationHandler{repository: repository, mailer: mailer, config: config}
+}
+
+// Handle answers the same way whether the address is unknown, already
+// verified or throttled, so the endpoint cannot be used to probe accounts.
+func (h *ResendVerificationHandler) Handle(ctx context.Context, request *ResendVerificationRequest) (*ResendVerificationResponse, error) {
+	user, err := h.repository.GetByEmail(ctx, request.Email)
+	if errors.Is(err, domain.ErrNotFound) {
+		return &ResendVerificationResponse{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerified {
+		return &ResendVerificationResponse{}, nil
+	}
+
+	cooldown := time.Duration(h.config.EmailVerification.SecondsOfResendCooldown) * time.Second
+	if user.VerificationSentAt != nil && time.Since(*user.VerificationSentAt) < cooldown {
+		zap.L().Info("verification resend throttled", zap.String("userId", user.Id))
+		return &ResendVerificationResponse{}, nil
+	}
+
+	if err := h.mailer.SendVerification(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return &ResendVerificationResponse{}, nil
+}
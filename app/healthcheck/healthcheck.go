@@ -1,6 +1,10 @@
 package healthcheck
 
-import "context"
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/health"
+)
 
 type Status string
 
@@ -11,16 +15,30 @@ const (
 
 type HealthCheckRequest struct{}
 
+// HealthCheckResponse is the full readiness report, with how long each check
+// took, when it ran and why it failed. Probes only get the status of each
+// check, as the errors may tell hosts of the dependencies.
 type HealthCheckResponse struct {
-	Status Status `json:"status"`
+	Status Status                        `json:"status"`
+	Reason string                        `json:"reason,omitempty"`
+	Checks map[string]health.CheckResult `json:"checks,omitempty"`
 }
 
-type HealthCheckHandler struct{}
+// HealthCheckHandler reports the readiness of the service to clients of
+// the API. Probes use the unauthenticated /health endpoints instead.
+type HealthCheckHandler struct {
+	registry *health.Registry
+}
 
-func NewHealthCheckHandler() *HealthCheckHandler {
-	return &HealthCheckHandler{}
+func NewHealthCheckHandler(registry *health.Registry) *HealthCheckHandler {
+	return &HealthCheckHandler{registry: registry}
 }
 
 func (h *HealthCheckHandler) Handle(ctx context.Context, req *HealthCheckRequest) (*HealthCheckResponse, error) {
-	return &HealthCheckResponse{Status: StatusOK}, nil
+	report := h.registry.Ready(ctx)
+	response := &HealthCheckResponse{Status: StatusOK, Reason: report.Reason, Checks: report.Checks}
+	if report.Status == health.StatusDown {
+		response.Status = StatusDown
+	}
+	return response, nil
 }
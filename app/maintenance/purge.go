@@ -0,0 +1,74 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+// SoftDeletePurge deletes for good the credentials that were only marked
+// as revoked: API keys revoked or expired, and OAuth clients revoked, longer
+// than the retention ago. Until then they are kept for audits.
+type SoftDeletePurge struct {
+	apiKeys      domain.ApiKeyRepository
+	oauthClients domain.OAuthClientRepository
+	retention    time.Duration
+}
+
+func NewSoftDeletePurge(apiKeys domain.ApiKeyRepository, oauthClients domain.OAuthClientRepository, retention time.Duration) *SoftDeletePurge {
+	return &SoftDeletePurge{apiKeys: apiKeys, oauthClients: oauthClients, retention: retention}
+}
+
+func (t *SoftDeletePurge) Run(ctx context.Context) (int64, error) {
+	ctx = tenant.AllTenants(ctx)
+	before := time.Now().Add(-t.retention)
+	return sum(
+		func() (int64, error) { return t.apiKeys.DeleteRevoked(ctx, before) },
+		func() (int64, error) { return t.oauthClients.DeleteRevoked(ctx, before) },
+	)
+}
+
+// HistoryPurge deletes the records of finished background work older than
+// the retention: jobs that are done or dead, user imports with their
+// reports, and the runs of scheduled tasks. User imports created longer
+// than the retention ago that never finished are deleted as well, so the
+// passwords in their data are not kept indefinitely.
+type HistoryPurge struct {
+	jobs      domain.JobRepository
+	imports   domain.UserImportRepository
+	taskRuns  domain.TaskRunRepository
+	retention time.Duration
+}
+
+func NewHistoryPurge(jobs domain.JobRepository, imports domain.UserImportRepository, taskRuns domain.TaskRunRepository, retention time.Duration) *HistoryPurge {
+	return &HistoryPurge{jobs: jobs, imports: imports, taskRuns: taskRuns, retention: retention}
+}
+
+func (t *HistoryPurge) Run(ctx context.Context) (int64, error) {
+	ctx = tenant.AllTenants(ctx)
+	before := time.Now().Add(-t.retention)
+	return sum(
+		func() (int64, error) { return t.jobs.DeleteFinished(ctx, before) },
+		func() (int64, error) { return t.imports.DeleteFinished(ctx, before) },
+		func() (int64, error) { return t.imports.DeleteUnfinished(ctx, before) },
+		func() (int64, error) { return t.taskRuns.DeleteStarted(ctx, before) },
+	)
+}
+
+// sum runs every step, even after one failed, so a broken table does not
+// keep the others from being cleaned up.
+func sum(steps ...func() (int64, error)) (int64, error) {
+	var (
+		total int64
+		errs  []error
+	)
+	for _, step := range steps {
+		affected, err := step()
+		total += affected
+		errs = append(errs, err)
+	}
+	return total, errors.Join(errs...)
+}
@@ -0,0 +1,27 @@
+// Package maintenance holds the recurring tasks that keep tables from
+// growing without bound. They run on the scheduler, across all tenants.
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+// RefreshTokenCleanup deletes refresh tokens that can no longer be
+// exchanged: used and revoked ones, and those that expired longer than the
+// retention ago.
+type RefreshTokenCleanup struct {
+	repository domain.RefreshTokenRepository
+	retention  time.Duration
+}
+
+func NewRefreshTokenCleanup(repository domain.RefreshTokenRepository, retention time.Duration) *RefreshTokenCleanup {
+	return &RefreshTokenCleanup{repository: repository, retention: retention}
+}
+
+func (t *RefreshTokenCleanup) Run(ctx context.Context) (int64, error) {
+	return t.repository.DeleteStale(tenant.AllTenants(ctx), time.Now().Add(-t.retention))
+}
@@ -0,0 +1,55 @@
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+// SessionWindows are how long the short lived state of logins and requests
+// has an effect.
+type SessionWindows struct {
+	// LoginFailures is the window failed logins are counted in.
+	LoginFailures time.Duration
+	// RateLimit is the longest window of the rate limits, after which every
+	// bucket is full again.
+	RateLimit time.Duration
+}
+
+// StaleSessionPruning deletes the state of logins and requests that no
+// longer has any effect: OIDC logins that were abandoned, MFA challenges
+// that expired, failed login counters that expired, full rate limit buckets
+// and expired idempotency records.
+type StaleSessionPruning struct {
+	loginStates   domain.OidcLoginStateRepository
+	mfaChallenges domain.UsedMfaChallengeRepository
+	loginAttempts domain.LoginAttemptStore
+	rateLimits    domain.RateLimitStore
+	idempotency   domain.IdempotencyStore
+	windows       SessionWindows
+}
+
+func NewStaleSessionPruning(loginStates domain.OidcLoginStateRepository, mfaChallenges domain.UsedMfaChallengeRepository, loginAttempts domain.LoginAttemptStore, rateLimits domain.RateLimitStore, idempotency domain.IdempotencyStore, windows SessionWindows) *StaleSessionPruning {
+	return &StaleSessionPruning{
+		loginStates:   loginStates,
+		mfaChallenges: mfaChallenges,
+		loginAttempts: loginAttempts,
+		rateLimits:    rateLimits,
+		idempotency:   idempotency,
+		windows:       windows,
+	}
+}
+
+func (t *StaleSessionPruning) Run(ctx context.Context) (int64, error) {
+	ctx = tenant.AllTenants(ctx)
+	now := time.Now()
+	return sum(
+		func() (int64, error) { return t.loginStates.DeleteExpired(ctx, now) },
+		func() (int64, error) { return t.mfaChallenges.DeleteExpired(ctx, now) },
+		func() (int64, error) { return t.loginAttempts.DeleteStale(ctx, now, t.windows.LoginFailures) },
+		func() (int64, error) { return t.rateLimits.DeleteStale(ctx, now, t.windows.RateLimit) },
+		func() (int64, error) { return t.idempotency.DeleteExpired(ctx, now) },
+	)
+}
@@ -0,0 +1,63 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+type ClientCreateRequest struct {
+	TenantId string   `json:"tenantId" validate:"required,max=63"`
+	Name     string   `json:"name" validate:"required,min=2,max=100"`
+	Scopes   []string `json:"scopes" validate:"required,min=1,dive,required,max=64,excludesall= "`
+}
+
+// ClientCreateResponse is the only place the client secret is ever shown.
+type ClientCreateResponse struct {
+	Client       Client `json:"client"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+type ClientCreateHandler struct {
+	repository domain.OAuthClientRepository
+	tenants    domain.TenantRepository
+}
+
+func NewClientCreateHandler(repository domain.OAuthClientRepository, tenants domain.TenantRepository) *ClientCreateHandler {
+	return &ClientCreateHandler{repository: repository, tenants: tenants}
+}
+
+// Handle registers a client in the tenant its tokens will be bound to.
+func (h *ClientCreateHandler) Handle(ctx context.Context, request *ClientCreateRequest) (*ClientCreateResponse, error) {
+	_, err := h.tenants.Get(ctx, request.TenantId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, tenant.ErrUnknownTenant
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx = tenant.WithTenant(ctx, request.TenantId, tenant.SourceDefault)
+
+	clientId, secret, err := security.GenerateClientCredentials()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &domain.OAuthClient{
+		Id:         uuid.New().String(),
+		ClientId:   clientId,
+		Name:       request.Name,
+		SecretHash: security.HashClientSecret(secret),
+		Scopes:     request.Scopes,
+	}
+
+	if err := h.repository.Create(ctx, client); err != nil {
+		return nil, err
+	}
+
+	return &ClientCreateResponse{Client: NewClient(client), ClientSecret: secret}, nil
+}
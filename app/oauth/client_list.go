@@ -0,0 +1,35 @@
+package oauth
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+type ClientListRequest struct{}
+
+type ClientListResponse struct {
+	Clients []Client `json:"clients"`
+}
+
+type ClientListHandler struct {
+	repository domain.OAuthClientRepository
+}
+
+func NewClientListHandler(repository domain.OAuthClientRepository) *ClientListHandler {
+	return &ClientListHandler{repository: repository}
+}
+
+// Handle lists the clients of every tenant, for operators.
+func (h *ClientListHandler) Handle(ctx context.Context, request *ClientListRequest) (*ClientListResponse, error) {
+	clients, err := h.repository.List(tenant.AllTenants(ctx))
+	if err != nil {
+		return nil, err
+	}
+	response := &ClientListResponse{Clients: make([]Client, len(clients))}
+	for i := range clients {
+		response.Clients[i] = NewClient(&clients[i])
+	}
+	return response, nil
+}
@@ -0,0 +1,31 @@
+package oauth
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+type ClientRevokeRequest struct {
+	ClientId string `json:"clientId" validate:"required"`
+}
+
+type ClientRevokeResponse struct{}
+
+type ClientRevokeHandler struct {
+	repository domain.OAuthClientRepository
+}
+
+func NewClientRevokeHandler(repository domain.OAuthClientRepository) *ClientRevokeHandler {
+	return &ClientRevokeHandler{repository: repository}
+}
+
+// Handle revokes the client in whichever tenant it is, client ids are unique
+// across them.
+func (h *ClientRevokeHandler) Handle(ctx context.Context, request *ClientRevokeRequest) (*ClientRevokeResponse, error) {
+	if err := h.repository.Revoke(tenant.AllTenants(ctx), request.ClientId); err != nil {
+		return nil, err
+	}
+	return &ClientRevokeResponse{}, nil
+}
@@ -0,0 +1,31 @@
+package oauth
+
+import (
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+// Client is an OAuth client as operators see it, without the hash of its
+// secret.
+type Client struct {
+	Id        string     `json:"id"`
+	TenantId  string     `json:"tenantId"`
+	ClientId  string     `json:"clientId"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+func NewClient(client *domain.OAuthClient) Client {
+	return Client{
+		Id:        client.Id,
+		TenantId:  client.TenantId,
+		ClientId:  client.ClientId,
+		Name:      client.Name,
+		Scopes:    client.Scopes,
+		CreatedAt: client.CreatedAt,
+		RevokedAt: client.RevokedAt,
+	}
+}
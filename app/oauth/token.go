@@ -0,0 +1,123 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/knetic0/production-ready-go-cqrs/app/auth"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+const grantTypeClientCredentials = "client_credentials"
+
+// Error messages are the error codes of RFC 6749 section 5.2.
+var (
+	ErrInvalidClient        = apperror.New(apperror.CodeUnauthorized, "invalid_client")
+	ErrInvalidScope         = apperror.New(apperror.CodeInvalidArgument, "invalid_scope")
+	ErrUnsupportedGrantType = apperror.New(apperror.CodeInvalidArgument, "unsupported_grant_type")
+)
+
+// TokenRequest accepts client credentials either in the form body or with
+// HTTP Basic authentication, as RFC 6749 section 2.3.1 allows.
+type TokenRequest struct {
+	GrantType     string `json:"grant_type" form:"grant_type" validate:"required"`
+	ClientId      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+	Scope         string `json:"scope" form:"scope"`
+	Authorization string `reqHeader:"Authorization"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+type TokenHandler struct {
+	repository domain.OAuthClientRepository
+	issuer     *auth.TokenIssuer
+}
+
+func NewTokenHandler(repository domain.OAuthClientRepository, issuer *auth.TokenIssuer) *TokenHandler {
+	return &TokenHandler{repository: repository, issuer: issuer}
+}
+
+func (h *TokenHandler) Handle(ctx context.Context, request *TokenRequest) (*TokenResponse, error) {
+	if request.GrantType != grantTypeClientCredentials {
+		return nil, ErrUnsupportedGrantType
+	}
+
+	clientId, secret := credentials(request)
+	if clientId == "" || secret == "" {
+		return nil, ErrInvalidClient
+	}
+
+	// Client ids are unique across tenants and the client decides the
+	// tenant of its tokens, so the lookup cannot be scoped to one.
+	client, err := h.repository.GetByClientId(tenant.AllTenants(ctx), clientId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, ErrInvalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.RevokedAt != nil || subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(security.HashClientSecret(secret))) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	// A tenant asked for by header or subdomain has to be the client's.
+	if requested, ok := tenant.FromContext(ctx); ok && tenant.SourceOf(ctx) != tenant.SourceDefault && requested != client.TenantId {
+		return nil, ErrInvalidClient
+	}
+
+	// Without a requested scope the client gets every scope it is allowed.
+	scopes := client.Scopes
+	if request.Scope != "" {
+		scopes = strings.Fields(request.Scope)
+		for _, scope := range scopes {
+			if !client.AllowsScope(scope) {
+				return nil, ErrInvalidScope
+			}
+		}
+	}
+
+	token, ttl, err := h.issuer.IssueServiceToken(client, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(ttl.Seconds()),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+func credentials(request *TokenRequest) (string, string) {
+	const basic = "Basic "
+	if len(request.Authorization) > len(basic) && strings.EqualFold(request.Authorization[:len(basic)], basic) {
+		decoded, err := base64.StdEncoding.DecodeString(request.Authorization[len(basic):])
+		if err != nil {
+			return "", ""
+		}
+		id, secret, found := strings.Cut(string(decoded), ":")
+		if !found {
+			return "", ""
+		}
+		// Basic credentials are form-urlencoded before being base64 encoded.
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		return id, secret
+	}
+	return request.ClientId, request.ClientSecret
+}
@@ -0,0 +1,41 @@
+package tenant
+
+import (
+	"context"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+// TenantCreateRequest restricts ids to DNS labels, since they are also
+// resolved from subdomains.
+type TenantCreateRequest struct {
+	Id   string `json:"id" validate:"required,max=63,lowercase,hostname_rfc1123,excludesall=."`
+	Name string `json:"name" validate:"required,min=2,max=100"`
+}
+
+type TenantCreateResponse struct {
+	Tenant Tenant `json:"tenant"`
+}
+
+type TenantCreateHandler struct {
+	repository domain.TenantRepository
+}
+
+func NewTenantCreateHandler(repository domain.TenantRepository) *TenantCreateHandler {
+	return &TenantCreateHandler{repository: repository}
+}
+
+func (h *TenantCreateHandler) Handle(ctx context.Context, request *TenantCreateRequest) (*TenantCreateResponse, error) {
+	tenant := &domain.Tenant{
+		Id:        request.Id,
+		Name:      request.Name,
+		CreatedAt: time.Now(),
+	}
+
+	if err := h.repository.Create(ctx, tenant); err != nil {
+		return nil, err
+	}
+
+	return &TenantCreateResponse{Tenant: NewTenant(tenant)}, nil
+}
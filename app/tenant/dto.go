@@ -0,0 +1,21 @@
+package tenant
+
+import (
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+type Tenant struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func NewTenant(tenant *domain.Tenant) Tenant {
+	return Tenant{
+		Id:        tenant.Id,
+		Name:      tenant.Name,
+		CreatedAt: tenant.CreatedAt,
+	}
+}
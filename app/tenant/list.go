@@ -0,0 +1,33 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+type TenantListRequest struct{}
+
+type TenantListResponse struct {
+	Tenants []Tenant `json:"tenants"`
+}
+
+type TenantListHandler struct {
+	repository domain.TenantRepository
+}
+
+func NewTenantListHandler(repository domain.TenantRepository) *TenantListHandler {
+	return &TenantListHandler{repository: repository}
+}
+
+func (h *TenantListHandler) Handle(ctx context.Context, request *TenantListRequest) (*TenantListResponse, error) {
+	tenants, err := h.repository.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response := &TenantListResponse{Tenants: make([]Tenant, len(tenants))}
+	for i := range tenants {
+		response.Tenants[i] = NewTenant(&tenants[i])
+	}
+	return response, nil
+}
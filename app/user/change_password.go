@@ -0,0 +1,100 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/passwordpolicy"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidCurrentPassword = apperror.New(apperror.CodeUnauthorized, "current password is incorrect")
+)
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,nefield=CurrentPassword"`
+}
+
+type ChangePasswordResponse struct{}
+
+// passwordThrottle counts wrong current passwords against the same account
+// and client lockout as the login, so a stolen access token cannot be used
+// to guess the password.
+type passwordThrottle interface {
+	Check(ctx context.Context, email string, clientIP string) error
+	Failure(ctx context.Context, email string, clientIP string)
+	Success(ctx context.Context, email string)
+}
+
+type ChangePasswordHandler struct {
+	repository             domain.UserRepository
+	refreshTokenRepository domain.RefreshTokenRepository
+	hasher                 security.PasswordHasher
+	policy                 *passwordpolicy.Policy
+	throttle               passwordThrottle
+}
+
+func NewChangePasswordHandler(repository domain.UserRepository, refreshTokenRepository domain.RefreshTokenRepository, hasher security.PasswordHasher, policy *passwordpolicy.Policy, throttle passwordThrottle) *ChangePasswordHandler {
+	return &ChangePasswordHandler{
+		repository:             repository,
+		refreshTokenRepository: refreshTokenRepository,
+		hasher:                 hasher,
+		policy:                 policy,
+		throttle:               throttle,
+	}
+}
+
+// Handle replaces the password and revokes all refresh tokens, signing the
+// user out of every other session.
+func (h *ChangePasswordHandler) Handle(ctx context.Context, request *ChangePasswordRequest) (*ChangePasswordResponse, error) {
+	userId, ok := auth.UserId(ctx)
+	if !ok {
+		return nil, ErrUnauthorized
+	}
+
+	user, err := h.repository.Get(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	clientIP := requestctx.ClientIP(ctx)
+	if err := h.throttle.Check(ctx, user.Email, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := h.hasher.Verify(request.CurrentPassword, user.Password); err != nil {
+		if !errors.Is(err, security.ErrPasswordMismatch) {
+			zap.L().Error("stored password hash cannot be verified", zap.String("userId", user.Id), zap.Error(err))
+		}
+		h.throttle.Failure(ctx, user.Email, clientIP)
+		return nil, ErrInvalidCurrentPassword
+	}
+	h.throttle.Success(ctx, user.Email)
+
+	if err := h.policy.Check("newPassword", request.NewPassword, user.Email, user.FirstName, user.LastName); err != nil {
+		return nil, err
+	}
+
+	hashed, err := h.hasher.Hash(request.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = hashed
+	if err := h.repository.Update(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := h.refreshTokenRepository.RevokeByUser(ctx, user.Id); err != nil {
+		return nil, err
+	}
+
+	return &ChangePasswordResponse{}, nil
+}
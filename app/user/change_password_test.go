@@ -0,0 +1,82 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/knetic0/production-ready-go-cqrs/app/auth"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/passwordpolicy"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+type fakeAccount struct {
+	domain.UserRepository
+	user domain.User
+}
+
+func (r *fakeAccount) Get(ctx context.Context, id string) (*domain.User, error) {
+	user := r.user
+	return &user, nil
+}
+
+func (r *fakeAccount) Update(ctx context.Context, user *domain.User) error {
+	r.user = *user
+	return nil
+}
+
+type fakeRefreshTokens struct {
+	domain.RefreshTokenRepository
+}
+
+func (fakeRefreshTokens) RevokeByUser(ctx context.Context, userId string) error {
+	return nil
+}
+
+// matchingHasher verifies against the hashes fakeHasher produces.
+type matchingHasher struct {
+	fakeHasher
+}
+
+func (matchingHasher) Verify(password string, hash string) error {
+	if hash != "hashed:"+password {
+		return security.ErrPasswordMismatch
+	}
+	return nil
+}
+
+func TestChangePasswordLocksOutAfterWrongCurrentPasswords(t *testing.T) {
+	const current = "orbital-meadow-61"
+	users := &fakeAccount{user: domain.User{Id: "user-1", Email: "ada@example.com", Password: "hashed:" + current}}
+	throttle := auth.NewLoginThrottle(infrastructure.NewLoginAttemptMemoryStore(), infrastructure.NewLogSecurityEventPublisher(), config.LoginThrottleConfig{
+		MaxFailuresPerAccount:  3,
+		MaxFailuresPerIp:       100,
+		MinutesOfFailureWindow: 15,
+		SecondsOfBaseLockout:   60,
+		MinutesOfMaxLockout:    15,
+	})
+	handler := NewChangePasswordHandler(users, fakeRefreshTokens{}, matchingHasher{}, passwordpolicy.New(passwordpolicy.Config{}, nil), throttle)
+
+	ctx := pkgauth.WithPrincipal(context.Background(), &pkgauth.Principal{Kind: pkgauth.KindUser, Subject: "user-1"})
+	ctx = requestctx.WithClientIP(ctx, "203.0.113.7")
+
+	for i := range 3 {
+		request := &ChangePasswordRequest{CurrentPassword: "guess-" + string(rune('a'+i)), NewPassword: "violet-harbor-28"}
+		if _, err := handler.Handle(ctx, request); !errors.Is(err, ErrInvalidCurrentPassword) {
+			t.Fatalf("guess %d: err = %v, want %v", i+1, err, ErrInvalidCurrentPassword)
+		}
+	}
+
+	request := &ChangePasswordRequest{CurrentPassword: current, NewPassword: "violet-harbor-28"}
+	if _, err := handler.Handle(ctx, request); !errors.Is(err, auth.ErrTooManyLoginAttempts) {
+		t.Fatalf("correct password while locked: err = %v, want %v", err, auth.ErrTooManyLoginAttempts)
+	}
+	if users.user.Password != "hashed:"+current {
+		t.Fatal("password changed while the account is locked out")
+	}
+}
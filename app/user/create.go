@@ -5,45 +5,78 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/passwordpolicy"
 	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"go.uber.org/zap"
 )
 
 type UserCreateRequest struct {
 	FirstName string `json:"firstName" validate:"required,min=2"`
 	LastName  string `json:"lastName" validate:"required,min=2"`
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required,min=6"`
+	Password  string `json:"password" validate:"required"`
+	Locale    string `json:"locale" validate:"omitempty,bcp47_language_tag"`
 }
 
 type UserCreateResponse struct{}
 
+type verificationSender interface {
+	SendVerification(ctx context.Context, user *domain.User) error
+}
+
 type UserCreateHandler struct {
 	repository domain.UserRepository
+	hasher     security.PasswordHasher
+	policy     *passwordpolicy.Policy
+	verifier   verificationSender
 }
 
-func NewUserCreateHandler(repository domain.UserRepository) *UserCreateHandler {
+func NewUserCreateHandler(repository domain.UserRepository, hasher security.PasswordHasher, policy *passwordpolicy.Policy, verifier verificationSender) *UserCreateHandler {
 	return &UserCreateHandler{
 		repository: repository,
+		hasher:     hasher,
+		policy:     policy,
+		verifier:   verifier,
 	}
 }
 
 func (h *UserCreateHandler) Handle(ctx context.Context, request *UserCreateRequest) (*UserCreateResponse, error) {
-	hashed, err := security.HashPassw(request.Password)
+	user, err := newUser(h.policy, h.hasher, request)
 	if err != nil {
 		return nil, err
 	}
 
-	user := &domain.User{
-		Id:        uuid.New().String(),
-		FirstName: request.FirstName,
-		LastName:  request.LastName,
-		Email:     request.Email,
-		Password:  hashed,
-	}
-
 	if err := h.repository.Create(ctx, user); err != nil {
 		return nil, err
 	}
 
+	// The account exists at this point; a failed mail can be retried through
+	// the resend endpoint, so it must not fail the registration.
+	if err := h.verifier.SendVerification(ctx, user); err != nil {
+		zap.L().Error("failed to send verification mail", zap.String("userId", user.Id), zap.Error(err))
+	}
+
 	return &UserCreateResponse{}, nil
 }
+
+// newUser checks the password of the request against the policy and builds
+// the user it registers, for the create handler and the importer alike.
+func newUser(policy *passwordpolicy.Policy, hasher security.PasswordHasher, request *UserCreateRequest) (*domain.User, error) {
+	if err := policy.Check("password", request.Password, request.Email, request.FirstName, request.LastName); err != nil {
+		return nil, err
+	}
+
+	hashed, err := hasher.Hash(request.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.User{
+		Id:        uuid.New().String(),
+		FirstName: request.FirstName,
+		LastName:  request.LastName,
+		Email:     request.Email,
+		Password:  hashed,
+		Locale:    request.Locale,
+	}, nil
+}
@@ -0,0 +1,150 @@
+package user
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+)
+
+var exportColumns = []string{"id", "firstName", "lastName", "email", "locale", "emailVerifiedAt", "mfaEnabled"}
+
+type UserExportRequest struct {
+	Format        string `query:"format" validate:"omitempty,oneof=ndjson csv"`
+	Email         string `query:"email" validate:"omitempty,max=255"`
+	Locale        string `query:"locale" validate:"omitempty,max=35"`
+	EmailVerified *bool  `query:"emailVerified"`
+	MfaEnabled    *bool  `query:"mfaEnabled"`
+}
+
+// UserExportResponse streams the users matching the request in rows shaped
+// like UserV2. Nothing is read until the body is streamed, after the
+// handler has returned.
+type UserExportResponse struct {
+	repository domain.UserRepository
+	filter     domain.UserFilter
+	format     string
+}
+
+type UserExportHandler struct {
+	repository domain.UserRepository
+}
+
+func NewUserExportHandler(repository domain.UserRepository) *UserExportHandler {
+	return &UserExportHandler{repository: repository}
+}
+
+func (h *UserExportHandler) Handle(ctx context.Context, request *UserExportRequest) (*UserExportResponse, error) {
+	format := request.Format
+	if format == "" {
+		format = ExportFormatNDJSON
+	}
+
+	return &UserExportResponse{
+		repository: h.repository,
+		filter: domain.UserFilter{
+			Email:         request.Email,
+			Locale:        request.Locale,
+			EmailVerified: request.EmailVerified,
+			MfaEnabled:    request.MfaEnabled,
+		},
+		format: format,
+	}, nil
+}
+
+// MediaTypes returns the media types the export can be streamed in.
+func (r *UserExportResponse) MediaTypes() []string {
+	return []string{"application/x-ndjson", "text/csv"}
+}
+
+func (r *UserExportResponse) ContentType() string {
+	if r.format == ExportFormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Stream writes the users to w as they are read. A failing write, as once
+// the client has gone away, stops the export along with its query.
+func (r *UserExportResponse) Stream(ctx context.Context, w io.Writer) (err error) {
+	tracer := otel.Tracer("app-go/user.export")
+	ctx, span := tracer.Start(ctx, "UserExport.Stream")
+	defer span.End()
+
+	start, rows := time.Now(), 0
+	defer func() {
+		span.SetAttributes(
+			attribute.String("export.format", r.format),
+			attribute.Int("export.rows", rows),
+			attribute.Int64("export.duration_ms", time.Since(start).Milliseconds()),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "export failed")
+			return
+		}
+		span.SetStatus(codes.Ok, "exported")
+	}()
+
+	write, flush := r.rowWriter(w)
+	if err := r.repository.Stream(ctx, r.filter, func(user *domain.User) error {
+		rows++
+		return write(NewUserV2(user))
+	}); err != nil {
+		return err
+	}
+	return flush()
+}
+
+func (r *UserExportResponse) rowWriter(w io.Writer) (func(UserV2) error, func() error) {
+	if r.format != ExportFormatCSV {
+		encoder := json.NewEncoder(w)
+		return func(user UserV2) error { return encoder.Encode(user) }, func() error { return nil }
+	}
+
+	writer := csv.NewWriter(w)
+	// Write errors stick to the writer and are returned by Error.
+	_ = writer.Write(exportColumns)
+	write := func(user UserV2) error {
+		emailVerifiedAt := ""
+		if user.EmailVerifiedAt != nil {
+			emailVerifiedAt = user.EmailVerifiedAt.UTC().Format(time.RFC3339)
+		}
+		return writer.Write([]string{
+			user.Id,
+			csvCell(user.FirstName),
+			csvCell(user.LastName),
+			csvCell(user.Email),
+			user.Locale,
+			emailVerifiedAt,
+			strconv.FormatBool(user.MfaEnabled),
+		})
+	}
+	flush := func() error {
+		writer.Flush()
+		return writer.Error()
+	}
+	return write, flush
+}
+
+// csvCell keeps spreadsheets from evaluating user supplied values as
+// formulas.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
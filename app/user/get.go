@@ -7,11 +7,13 @@ import (
 )
 
 type UserGetRequest struct {
-	Id string `json:"id" validate:"required,uuid4"`
+	Id string `params:"id" validate:"required,uuid4"`
 }
 
+// UserGetResponse is rendered by each API version with its own DTO, see
+// UserResponseV1 and UserResponseV2.
 type UserGetResponse struct {
-	User *domain.User `json:"user"`
+	User *domain.User
 }
 
 type UserGetHandler struct {
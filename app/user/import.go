@@ -0,0 +1,266 @@
+package user
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+var ErrUnsupportedImport = apperror.New(apperror.CodeUnsupportedMediaType, "imports are uploaded as text/csv or application/x-ndjson")
+
+// importColumns are the CSV columns of an import, named like the fields of
+// UserCreateRequest. Locale is optional.
+var importColumns = []string{"firstName", "lastName", "email", "password", "locale"}
+
+// UserImportRequest takes the uploaded file as the body, in the format its
+// content type names.
+type UserImportRequest struct {
+	format string
+	data   []byte
+}
+
+// MediaTypes returns the content types an import can be uploaded in.
+func (r *UserImportRequest) MediaTypes() []string {
+	return []string{"text/csv", "application/x-ndjson"}
+}
+
+func (r *UserImportRequest) SetBody(contentType string, body []byte) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		r.format = ImportFormatCSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		r.format = ImportFormatNDJSON
+	default:
+		return ErrUnsupportedImport
+	}
+	// The body is only valid during the request, the import outlives it.
+	r.data = bytes.Clone(body)
+	return nil
+}
+
+// UserImport is the status of an import and the outcome of the rows it has
+// processed so far.
+type UserImport struct {
+	Id         string          `json:"id"`
+	Status     string          `json:"status"`
+	Format     string          `json:"format"`
+	Total      int             `json:"total"`
+	Processed  int             `json:"processed"`
+	Created    int             `json:"created"`
+	Duplicates int             `json:"duplicates"`
+	Invalid    int             `json:"invalid"`
+	Error      string          `json:"error,omitempty"`
+	Rows       []UserImportRow `json:"rows"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	StartedAt  *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+}
+
+type UserImportRow struct {
+	Line    int                   `json:"line"`
+	Email   string                `json:"email,omitempty"`
+	Outcome string                `json:"outcome"`
+	Reasons []apperror.FieldError `json:"reasons,omitempty"`
+}
+
+func NewUserImport(userImport *domain.UserImport) UserImport {
+	rows := make([]UserImportRow, len(userImport.Rows))
+	for i, row := range userImport.Rows {
+		rows[i] = UserImportRow{Line: row.Line, Email: row.Email, Outcome: string(row.Outcome)}
+		for _, reason := range row.Reasons {
+			rows[i].Reasons = append(rows[i].Reasons, apperror.FieldError(reason))
+		}
+	}
+	return UserImport{
+		Id:         userImport.Id,
+		Status:     string(userImport.Status),
+		Format:     userImport.Format,
+		Total:      userImport.Total,
+		Processed:  userImport.Processed,
+		Created:    userImport.Created,
+		Duplicates: userImport.Duplicates,
+		Invalid:    userImport.Invalid,
+		Error:      userImport.Error,
+		Rows:       rows,
+		CreatedAt:  userImport.CreatedAt,
+		StartedAt:  userImport.StartedAt,
+		FinishedAt: userImport.FinishedAt,
+	}
+}
+
+type UserImportResponse struct {
+	Import UserImport `json:"import"`
+}
+
+// UserImportHandler checks that an upload is well formed and queues it to
+// be imported in the background. Rows are validated by the importer, which
+// reports them one by one instead of rejecting the upload.
+type UserImportHandler struct {
+	repository domain.UserImportRepository
+	queue      domain.JobQueue
+	maxRows    int
+}
+
+func NewUserImportHandler(repository domain.UserImportRepository, queue domain.JobQueue, maxRows int) *UserImportHandler {
+	return &UserImportHandler{repository: repository, queue: queue, maxRows: maxRows}
+}
+
+func (h *UserImportHandler) Handle(ctx context.Context, request *UserImportRequest) (*UserImportResponse, error) {
+	if request.format == "" {
+		return nil, ErrUnsupportedImport
+	}
+
+	total := 0
+	if err := readImportRows(request.format, request.data, func(int, *UserCreateRequest) error {
+		total++
+		return nil
+	}); err != nil {
+		return nil, apperror.Validation(apperror.FieldError{Field: "body", Rule: request.format, Message: err.Error()})
+	}
+	if total == 0 {
+		return nil, apperror.Validation(apperror.FieldError{Field: "body", Rule: "required", Message: "has no rows"})
+	}
+	if h.maxRows > 0 && total > h.maxRows {
+		return nil, apperror.Validation(apperror.FieldError{
+			Field:   "body",
+			Rule:    "max",
+			Message: fmt.Sprintf("has %d rows, at most %d can be imported at once", total, h.maxRows),
+		})
+	}
+
+	userImport := &domain.UserImport{
+		Id:     uuid.New().String(),
+		Format: request.format,
+		Status: domain.UserImportPending,
+		Data:   request.data,
+		Total:  total,
+	}
+	if err := h.repository.Create(ctx, userImport); err != nil {
+		return nil, err
+	}
+	if err := h.queue.Enqueue(ctx, &UserImportJob{ImportId: userImport.Id}, domain.JobOptions{UniqueKey: "user-import:" + userImport.Id}); err != nil {
+		return nil, err
+	}
+
+	return &UserImportResponse{Import: NewUserImport(userImport)}, nil
+}
+
+type UserImportGetRequest struct {
+	Id string `params:"id" validate:"required,uuid4"`
+}
+
+type UserImportGetHandler struct {
+	repository domain.UserImportRepository
+}
+
+func NewUserImportGetHandler(repository domain.UserImportRepository) *UserImportGetHandler {
+	return &UserImportGetHandler{repository: repository}
+}
+
+func (h *UserImportGetHandler) Handle(ctx context.Context, request *UserImportGetRequest) (*UserImportResponse, error) {
+	userImport, err := h.repository.Get(ctx, request.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &UserImportResponse{Import: NewUserImport(userImport)}, nil
+}
+
+// readImportRows calls fn with each row of an upload and the line it starts
+// on. A malformed file stops it with an error naming the line; rows that
+// parse but break the rules of UserCreateRequest are left to fn.
+func readImportRows(format string, data []byte, fn func(line int, request *UserCreateRequest) error) error {
+	// Spreadsheets like to prepend a byte order mark.
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	if format == ImportFormatCSV {
+		return readCSVRows(data, fn)
+	}
+	return readNDJSONRows(data, fn)
+}
+
+func readCSVRows(data []byte, fn func(int, *UserCreateRequest) error) error {
+	reader := csv.NewReader(bytes.NewReader(data))
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if !slices.Contains(importColumns, name) {
+			return fmt.Errorf("line 1: unknown column %q, columns are %s", name, strings.Join(importColumns, ", "))
+		}
+		columns[name] = i
+	}
+	for _, name := range importColumns[:4] {
+		if _, ok := columns[name]; !ok {
+			return fmt.Errorf("line 1: missing column %q", name)
+		}
+	}
+
+	cell := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		if err := fn(line, &UserCreateRequest{
+			FirstName: cell(record, "firstName"),
+			LastName:  cell(record, "lastName"),
+			Email:     cell(record, "email"),
+			Password:  record[columns["password"]],
+			Locale:    cell(record, "locale"),
+		}); err != nil {
+			return err
+		}
+	}
+}
+
+func readNDJSONRows(data []byte, fn func(int, *UserCreateRequest) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var request UserCreateRequest
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(line, &request); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
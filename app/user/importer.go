@@ -0,0 +1,298 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/passwordpolicy"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+// UserImportJob is the job that runs an import.
+type UserImportJob struct {
+	ImportId string `json:"importId"`
+}
+
+type ImportConfig struct {
+	// BatchSize is how many users are inserted with one statement.
+	BatchSize int
+	// BatchesPerTransaction is how many batches are committed together. Zero
+	// commits the whole import at once, so it is created entirely or not at
+	// all.
+	BatchesPerTransaction int
+	// SendVerification mails the created users their verification link, as
+	// registering does.
+	SendVerification bool
+}
+
+// UserImporter creates the users of an import, validating each row the way
+// UserCreateRequest is validated when registering.
+type UserImporter struct {
+	users    domain.UserRepository
+	imports  domain.UserImportRepository
+	hasher   security.PasswordHasher
+	policy   *passwordpolicy.Policy
+	verifier verificationSender
+	validate func(request any) error
+	config   ImportConfig
+}
+
+func NewUserImporter(users domain.UserRepository, imports domain.UserImportRepository, hasher security.PasswordHasher, policy *passwordpolicy.Policy, verifier verificationSender, validate func(request any) error, config ImportConfig) *UserImporter {
+	return &UserImporter{
+		users:    users,
+		imports:  imports,
+		hasher:   hasher,
+		policy:   policy,
+		verifier: verifier,
+		validate: validate,
+		config:   config,
+	}
+}
+
+// importedUser is a user waiting in a batch, along with the index of its
+// row in the report.
+type importedUser struct {
+	row  int
+	user *domain.User
+}
+
+// Handle runs the import of the job. A job retried after the import has
+// finished, as after a failure to record the outcome, does nothing.
+func (i *UserImporter) Handle(ctx context.Context, job *UserImportJob) error {
+	return i.Run(ctx, job.ImportId)
+}
+
+// Run imports the users of the import with the given id. An import that
+// has already finished is left alone. Progress is saved after every
+// transaction, and the report once the import has finished, failed or not.
+// A cancelled import, as on shutdown, is left pending with the rows it has
+// committed, and the next run resumes after them.
+func (i *UserImporter) Run(ctx context.Context, id string) (err error) {
+	tracer := otel.Tracer("app-go/user.import")
+	ctx, span := tracer.Start(ctx, "UserImporter.Run")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("import.id", id))
+
+	userImport, err := i.imports.Get(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "get failed")
+		return err
+	}
+	if userImport.IsFinished() {
+		span.SetStatus(codes.Ok, "already finished")
+		return nil
+	}
+
+	if userImport.StartedAt == nil {
+		started := time.Now()
+		userImport.StartedAt = &started
+	}
+	userImport.Status = domain.UserImportRunning
+	if err := i.imports.UpdateProgress(ctx, userImport); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "update failed")
+		return err
+	}
+
+	var (
+		rows      = slices.Clone(userImport.Rows)
+		batch     []importedUser
+		batches   [][]importedUser
+		seen      = make(map[string]bool)
+		resumed   = len(rows)
+		committed = resumed
+		skipped   int
+	)
+	// Rows that were not invalid took their email, whether the user was
+	// created or found to be a duplicate.
+	for _, row := range rows {
+		if row.Outcome != domain.UserImportInvalid {
+			seen[row.Email] = true
+		}
+	}
+
+	commit := func() error {
+		if len(batch) > 0 {
+			batches, batch = append(batches, batch), nil
+		}
+		if len(batches) > 0 {
+			if err := i.create(ctx, rows, batches); err != nil {
+				return err
+			}
+			batches = nil
+		}
+		committed = len(rows)
+		userImport.Rows = rows[:committed]
+		tally(userImport, userImport.Rows)
+		return i.imports.UpdateProgress(ctx, userImport)
+	}
+
+	err = readImportRows(userImport.Format, userImport.Data, func(line int, request *UserCreateRequest) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// Committed by a previous run.
+		if skipped < resumed {
+			skipped++
+			return nil
+		}
+
+		row := domain.UserImportRow{Line: line, Email: request.Email}
+		user, err := i.newUser(request)
+		switch {
+		case apperror.CodeOf(err) == apperror.CodeInvalidArgument:
+			row.Outcome = domain.UserImportInvalid
+			for _, field := range apperror.FieldsOf(err) {
+				row.Reasons = append(row.Reasons, domain.UserImportReason(field))
+			}
+		case err != nil:
+			return err
+		case seen[request.Email]:
+			row.Outcome = domain.UserImportDuplicate
+		default:
+			seen[request.Email] = true
+			batch = append(batch, importedUser{row: len(rows), user: user})
+		}
+		rows = append(rows, row)
+
+		if len(batch) < i.config.BatchSize {
+			return nil
+		}
+		batches, batch = append(batches, batch), nil
+		if i.config.BatchesPerTransaction > 0 && len(batches) >= i.config.BatchesPerTransaction {
+			return commit()
+		}
+		return nil
+	})
+	if err == nil {
+		err = commit()
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// The job is released and run again, so the data is kept for it.
+		userImport.Rows, userImport.Status = rows[:committed], domain.UserImportPending
+		tally(userImport, userImport.Rows)
+		if updateErr := i.imports.Update(context.WithoutCancel(ctx), userImport); updateErr != nil {
+			err = errors.Join(err, updateErr)
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "import cancelled")
+		return err
+	}
+
+	finished := time.Now()
+	userImport.Rows, userImport.Data, userImport.FinishedAt = rows[:committed], nil, &finished
+	tally(userImport, userImport.Rows)
+	userImport.Status = domain.UserImportCompleted
+	if err != nil {
+		userImport.Status, userImport.Error = domain.UserImportFailed, err.Error()
+	}
+	if updateErr := i.imports.Update(context.WithoutCancel(ctx), userImport); updateErr != nil {
+		err = errors.Join(err, updateErr)
+	}
+
+	span.SetAttributes(
+		attribute.Int("import.rows", userImport.Processed),
+		attribute.Int("import.created", userImport.Created),
+		attribute.Int("import.duplicates", userImport.Duplicates),
+		attribute.Int("import.invalid", userImport.Invalid),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "import failed")
+		return err
+	}
+	span.SetStatus(codes.Ok, "imported")
+	return nil
+}
+
+// Bury fails the import of a job that was given up on, dropping its data
+// rather than keeping the passwords in it for a run that will not come.
+func (i *UserImporter) Bury(ctx context.Context, job *UserImportJob, reason string) error {
+	userImport, err := i.imports.Get(ctx, job.ImportId)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if userImport.IsFinished() {
+		return nil
+	}
+
+	finished := time.Now()
+	userImport.Status, userImport.Error = domain.UserImportFailed, reason
+	userImport.Data, userImport.FinishedAt = nil, &finished
+	return i.imports.Update(ctx, userImport)
+}
+
+func (i *UserImporter) newUser(request *UserCreateRequest) (*domain.User, error) {
+	if err := i.validate(request); err != nil {
+		return nil, err
+	}
+	return newUser(i.policy, i.hasher, request)
+}
+
+// create inserts the batches in one transaction and reports each of their
+// rows as created or, when the email was taken, as a duplicate.
+func (i *UserImporter) create(ctx context.Context, rows []domain.UserImportRow, batches [][]importedUser) error {
+	users := make([][]*domain.User, len(batches))
+	for b, batch := range batches {
+		users[b] = make([]*domain.User, len(batch))
+		for u, imported := range batch {
+			users[b][u] = imported.user
+		}
+	}
+
+	created, err := i.users.CreateMissing(ctx, users)
+	if err != nil {
+		return err
+	}
+	isCreated := make(map[string]bool, len(created))
+	for _, id := range created {
+		isCreated[id] = true
+	}
+
+	for _, batch := range batches {
+		for _, imported := range batch {
+			if !isCreated[imported.user.Id] {
+				rows[imported.row].Outcome = domain.UserImportDuplicate
+				continue
+			}
+			rows[imported.row].Outcome = domain.UserImportCreated
+			if !i.config.SendVerification {
+				continue
+			}
+			// As when registering, a failed mail can be retried through the
+			// resend endpoint and does not fail the import.
+			if err := i.verifier.SendVerification(ctx, imported.user); err != nil {
+				zap.L().Error("failed to send verification mail", zap.String("userId", imported.user.Id), zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+func tally(userImport *domain.UserImport, rows []domain.UserImportRow) {
+	userImport.Processed, userImport.Created, userImport.Duplicates, userImport.Invalid = len(rows), 0, 0, 0
+	for _, row := range rows {
+		switch row.Outcome {
+		case domain.UserImportCreated:
+			userImport.Created++
+		case domain.UserImportDuplicate:
+			userImport.Duplicates++
+		case domain.UserImportInvalid:
+			userImport.Invalid++
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/passwordpolicy"
+)
+
+type fakeUsers struct {
+	domain.UserRepository
+	created []string
+	// afterCreate is called once each transaction has been committed.
+	afterCreate func()
+}
+
+func (r *fakeUsers) CreateMissing(ctx context.Context, batches [][]*domain.User) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, batch := range batches {
+		for _, user := range batch {
+			if slices.Contains(r.created, user.Email) {
+				continue
+			}
+			r.created = append(r.created, user.Email)
+			ids = append(ids, user.Id)
+		}
+	}
+	if r.afterCreate != nil {
+		r.afterCreate()
+	}
+	return ids, nil
+}
+
+type fakeImports struct {
+	domain.UserImportRepository
+	userImport domain.UserImport
+	// updateErr fails Update, as when the process dies before saving.
+	updateErr error
+	// afterProgress is called once each progress update has been saved.
+	afterProgress func()
+}
+
+func (r *fakeImports) Get(ctx context.Context, id string) (*domain.UserImport, error) {
+	userImport := r.userImport
+	userImport.Rows = slices.Clone(r.userImport.Rows)
+	return &userImport, nil
+}
+
+func (r *fakeImports) Update(ctx context.Context, userImport *domain.UserImport) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.updateErr != nil {
+		return r.updateErr
+	}
+	r.userImport = *userImport
+	return nil
+}
+
+// UpdateProgress saves the same columns as the database adapter.
+func (r *fakeImports) UpdateProgress(ctx context.Context, userImport *domain.UserImport) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.userImport.Status = userImport.Status
+	r.userImport.Processed = userImport.Processed
+	r.userImport.Created = userImport.Created
+	r.userImport.Duplicates = userImport.Duplicates
+	r.userImport.Invalid = userImport.Invalid
+	r.userImport.StartedAt = userImport.StartedAt
+	r.userImport.Rows = slices.Clone(userImport.Rows)
+	if r.afterProgress != nil {
+		r.afterProgress()
+	}
+	return nil
+}
+
+type fakeHasher struct{}
+
+func (fakeHasher) Hash(password string) (string, error) {
+	return "hashed:" + password, nil
+}
+
+func (fakeHasher) Verify(password string, hash string) error {
+	return nil
+}
+
+func (fakeHasher) NeedsRehash(hash string) bool {
+	return false
+}
+
+type fakeVerifier struct{}
+
+func (fakeVerifier) SendVerification(ctx context.Context, user *domain.User) error {
+	return nil
+}
+
+const importData = "firstName,lastName,email,password\n" +
+	"Ada,Lovelace,ada@example.com,orbital-meadow-61\n" +
+	"Grace,Hopper,grace@example.com,orbital-meadow-61\n" +
+	"Ada,Lovelace,ada@example.com,orbital-meadow-61\n" +
+	"Linus,Torvalds,linus@example.com,orbital-meadow-61\n"
+
+func TestUserImporterResumesAfterCancel(t *testing.T) {
+	data := importData
+	users := &fakeUsers{}
+	imports := &fakeImports{userImport: domain.UserImport{
+		Id:     "import-1",
+		Format: ImportFormatCSV,
+		Status: domain.UserImportPending,
+		Data:   []byte(data),
+		Total:  4,
+	}}
+	importer := NewUserImporter(users, imports, fakeHasher{}, passwordpolicy.New(passwordpolicy.Config{}, nil), fakeVerifier{}, func(any) error { return nil }, ImportConfig{BatchSize: 1, BatchesPerTransaction: 1})
+
+	// Shut down once the first row has been committed.
+	ctx, cancel := context.WithCancel(context.Background())
+	users.afterCreate = cancel
+	if err := importer.Run(ctx, "import-1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled run: err = %v, want %v", err, context.Canceled)
+	}
+	cancelled := imports.userImport
+	if cancelled.Status != domain.UserImportPending || string(cancelled.Data) != data || cancelled.FinishedAt != nil {
+		t.Fatalf("cancelled import: status %q, %d bytes of data, finished %v, want pending with its data", cancelled.Status, len(cancelled.Data), cancelled.FinishedAt)
+	}
+	if len(cancelled.Rows) != 1 || cancelled.Created != 1 {
+		t.Fatalf("cancelled import: %d rows, %d created, want the committed row", len(cancelled.Rows), cancelled.Created)
+	}
+
+	users.afterCreate = nil
+	if err := importer.Run(context.Background(), "import-1"); err != nil {
+		t.Fatal(err)
+	}
+	resumed := imports.userImport
+	if resumed.Status != domain.UserImportCompleted || resumed.Data != nil {
+		t.Fatalf("resumed import: status %q, %d bytes of data, want completed without data", resumed.Status, len(resumed.Data))
+	}
+	if resumed.Processed != 4 || resumed.Created != 3 || resumed.Duplicates != 1 {
+		t.Fatalf("resumed import: %d processed, %d created, %d duplicates, want 4, 3 and 1", resumed.Processed, resumed.Created, resumed.Duplicates)
+	}
+	outcomes := make([]domain.UserImportOutcome, len(resumed.Rows))
+	for i, row := range resumed.Rows {
+		outcomes[i] = row.Outcome
+	}
+	want := []domain.UserImportOutcome{domain.UserImportCreated, domain.UserImportCreated, domain.UserImportDuplicate, domain.UserImportCreated}
+	if !slices.Equal(outcomes, want) {
+		t.Fatalf("outcomes = %v, want %v", outcomes, want)
+	}
+	if !slices.Equal(users.created, []string{"ada@example.com", "grace@example.com", "linus@example.com"}) {
+		t.Fatalf("created %v", users.created)
+	}
+}
+
+// A process that dies mid-import does not get to save the whole import, so
+// the next run has only the progress updates to resume from.
+func TestUserImporterResumesFromProgress(t *testing.T) {
+	users := &fakeUsers{}
+	imports := &fakeImports{userImport: domain.UserImport{
+		Id:     "import-1",
+		Format: ImportFormatCSV,
+		Status: domain.UserImportPending,
+		Data:   []byte(importData),
+		Total:  4,
+	}}
+	importer := NewUserImporter(users, imports, fakeHasher{}, passwordpolicy.New(passwordpolicy.Config{}, nil), fakeVerifier{}, func(any) error { return nil }, ImportConfig{BatchSize: 1, BatchesPerTransaction: 1})
+
+	// Die once the first row has been committed and its progress saved,
+	// after the update marking the import as running.
+	ctx, cancel := context.WithCancel(context.Background())
+	updates := 0
+	imports.afterProgress = func() {
+		if updates++; updates == 2 {
+			cancel()
+		}
+	}
+	imports.updateErr = errors.New("connection reset")
+	if err := importer.Run(ctx, "import-1"); err == nil {
+		t.Fatal("interrupted run succeeded")
+	}
+	if len(imports.userImport.Rows) != 1 || imports.userImport.Created != 1 {
+		t.Fatalf("interrupted import: %d rows, %d created, want the committed row", len(imports.userImport.Rows), imports.userImport.Created)
+	}
+
+	imports.afterProgress, imports.updateErr = nil, nil
+	if err := importer.Run(context.Background(), "import-1"); err != nil {
+		t.Fatal(err)
+	}
+	resumed := imports.userImport
+	outcomes := make([]domain.UserImportOutcome, len(resumed.Rows))
+	for i, row := range resumed.Rows {
+		outcomes[i] = row.Outcome
+	}
+	want := []domain.UserImportOutcome{domain.UserImportCreated, domain.UserImportCreated, domain.UserImportDuplicate, domain.UserImportCreated}
+	if !slices.Equal(outcomes, want) {
+		t.Fatalf("outcomes = %v, want %v", outcomes, want)
+	}
+	if resumed.Processed != 4 || resumed.Created != 3 || resumed.Duplicates != 1 {
+		t.Fatalf("resumed import: %d processed, %d created, %d duplicates, want 4, 3 and 1", resumed.Processed, resumed.Created, resumed.Duplicates)
+	}
+}
+
+func TestUserImporterBuryDropsData(t *testing.T) {
+	imports := &fakeImports{userImport: domain.UserImport{
+		Id:     "import-1",
+		Format: ImportFormatCSV,
+		Status: domain.UserImportPending,
+		Data:   []byte(importData),
+		Total:  4,
+	}}
+	importer := NewUserImporter(&fakeUsers{}, imports, fakeHasher{}, passwordpolicy.New(passwordpolicy.Config{}, nil), fakeVerifier{}, func(any) error { return nil }, ImportConfig{})
+
+	if err := importer.Bury(context.Background(), &UserImportJob{ImportId: "import-1"}, "out of attempts"); err != nil {
+		t.Fatal(err)
+	}
+	buried := imports.userImport
+	if buried.Status != domain.UserImportFailed || buried.Error != "out of attempts" || buried.Data != nil || buried.FinishedAt == nil {
+		t.Fatalf("buried import: status %q, error %q, %d bytes of data, finished %v, want failed without data", buried.Status, buried.Error, len(buried.Data), buried.FinishedAt)
+	}
+}
@@ -8,8 +8,10 @@ import (
 
 type UserListRequest struct{}
 
+// UserListResponse is rendered by each API version with its own DTO, see
+// UserListResponseV1 and UserListResponseV2.
 type UserListResponse struct {
-	Users []domain.User `json:"users"`
+	Users []domain.User
 }
 
 type UserListHandler struct {
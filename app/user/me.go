@@ -2,19 +2,21 @@ package user
 
 import (
 	"context"
-	"errors"
 
 	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/auth"
 )
 
 var (
-	ErrUnauthorized = errors.New("unauthorized")
+	ErrUnauthorized = apperror.New(apperror.CodeUnauthorized, "unauthorized")
 )
 
 type MeRequest struct{}
 
+// MeResponse is rendered like UserGetResponse.
 type MeResponse struct {
-	User *domain.User `json:"user"`
+	User *domain.User
 }
 
 type MeHandler struct {
@@ -28,7 +30,7 @@ func NewMeHandler(repository domain.UserRepository) *MeHandler {
 }
 
 func (h *MeHandler) Handle(ctx context.Context, request *MeRequest) (*MeResponse, error) {
-	userId, ok := ctx.Value("userId").(string)
+	userId, ok := auth.UserId(ctx)
 	if !ok {
 		return nil, ErrUnauthorized
 	}
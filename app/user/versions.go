@@ -0,0 +1,105 @@
+package user
+
+import (
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+// UserV1 is a user the way version 1 of the API renders it. It only gains
+// fields; anything breaking goes into a new version.
+type UserV1 struct {
+	Id              string     `json:"id"`
+	FirstName       string     `json:"firstName"`
+	LastName        string     `json:"lastName"`
+	Email           string     `json:"email"`
+	Locale          string     `json:"locale"`
+	EmailVerified   bool       `json:"emailVerified"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty"`
+	MfaEnabled      bool       `json:"mfaEnabled"`
+}
+
+// UserV2 drops emailVerified, which emailVerifiedAt being set already
+// tells.
+type UserV2 struct {
+	Id              string     `json:"id"`
+	FirstName       string     `json:"firstName"`
+	LastName        string     `json:"lastName"`
+	Email           string     `json:"email"`
+	Locale          string     `json:"locale"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	MfaEnabled      bool       `json:"mfaEnabled"`
+}
+
+type UserResponseV1 struct {
+	User UserV1 `json:"user"`
+}
+
+type UserListResponseV1 struct {
+	Users []UserV1 `json:"users"`
+}
+
+type UserResponseV2 struct {
+	User UserV2 `json:"user"`
+}
+
+type UserListResponseV2 struct {
+	Users []UserV2 `json:"users"`
+}
+
+func NewUserV1(user *domain.User) UserV1 {
+	return UserV1{
+		Id:              user.Id,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		Locale:          user.Locale,
+		EmailVerified:   user.EmailVerified,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		MfaEnabled:      user.MfaEnabled,
+	}
+}
+
+func NewUserV2(user *domain.User) UserV2 {
+	return UserV2{
+		Id:              user.Id,
+		FirstName:       user.FirstName,
+		LastName:        user.LastName,
+		Email:           user.Email,
+		Locale:          user.Locale,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		MfaEnabled:      user.MfaEnabled,
+	}
+}
+
+func (r *UserGetResponse) V1() *UserResponseV1 {
+	return &UserResponseV1{User: NewUserV1(r.User)}
+}
+
+func (r *UserGetResponse) V2() *UserResponseV2 {
+	return &UserResponseV2{User: NewUserV2(r.User)}
+}
+
+func (r *MeResponse) V1() *UserResponseV1 {
+	return &UserResponseV1{User: NewUserV1(r.User)}
+}
+
+func (r *MeResponse) V2() *UserResponseV2 {
+	return &UserResponseV2{User: NewUserV2(r.User)}
+}
+
+func (r *UserListResponse) V1() *UserListResponseV1 {
+	users := make([]UserV1, len(r.Users))
+	for i := range r.Users {
+		users[i] = NewUserV1(&r.Users[i])
+	}
+	return &UserListResponseV1{Users: users}
+}
+
+func (r *UserListResponse) V2() *UserListResponseV2 {
+	users := make([]UserV2, len(r.Users))
+	for i := range r.Users {
+		users[i] = NewUserV2(&r.Users[i])
+	}
+	return &UserListResponseV2{Users: users}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	jwtware "github.com/gofiber/contrib/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/knetic0/production-ready-go-cqrs/app/apikey"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyScheme = "ApiKey "
+)
+
+var (
+	errInvalidToken             = apperror.New(apperror.CodeUnauthorized, "invalid or expired token")
+	errInteractiveLoginRequired = apperror.New(apperror.CodeForbidden, "managing credentials needs a user's access token, not an api key or service token")
+	errInsufficientScope        = apperror.New(apperror.CodeForbidden, "the service token lacks the scope this operation needs")
+)
+
+// AuthenticationMiddleware accepts an API key, from "Authorization: ApiKey"
+// or X-API-Key, and falls back to bearer JWTs otherwise. Either way the
+// caller ends up as a pkg/auth Principal in the request context.
+func AuthenticationMiddleware(securityConfig config.SecurityConfig, apiKeys *apikey.Authenticator) fiber.Handler {
+	bearer := jwtware.New(jwtware.Config{
+		SigningKey: jwtware.SigningKey{
+			JWTAlg: jwtware.HS256,
+			Key:    []byte(securityConfig.JwtSecretKey),
+		},
+		SuccessHandler: func(c *fiber.Ctx) error {
+			token := c.Locals("user").(*jwt.Token)
+			claims := token.Claims.(jwt.MapClaims)
+			sub, err := claims.GetSubject()
+			if err != nil {
+				return c.Next()
+			}
+
+			return authenticated(c, principalFromClaims(sub, claims))
+		},
+	})
+
+	return func(c *fiber.Ctx) error {
+		key, ok := apiKeyFrom(c)
+		if !ok {
+			return bearer(c)
+		}
+
+		ctx := c.UserContext()
+		apiKey, err := apiKeys.Authenticate(ctx, key, c.Method(), requestctx.ClientIP(ctx))
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(errorBody(err))
+		}
+
+		return authenticated(c, apiKeyPrincipal(apiKey))
+	}
+}
+
+// InteractiveMiddleware guards the routes that manage credentials. Only a
+// user's access token passes, so a leaked API key cannot mint further keys,
+// change the password or turn off MFA.
+func InteractiveMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := requireInteractive(c.UserContext()); err != nil {
+			return c.Status(errorStatus(err)).JSON(errorBody(err))
+		}
+		return c.Next()
+	}
+}
+
+func requireInteractive(ctx context.Context) error {
+	principal, ok := pkgauth.FromContext(ctx)
+	if !ok {
+		return errMissingCredentials
+	}
+	if !principal.IsUser() || principal.Method != pkgauth.MethodBearerToken {
+		return errInteractiveLoginRequired
+	}
+	return nil
+}
+
+// ServiceScopeMiddleware lets service accounts through only with the scope
+// the route asks for. Routes without a scope are closed to them. Users are
+// not affected; what they may do follows from who they are.
+func ServiceScopeMiddleware(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := requireServiceScope(c.UserContext(), scope); err != nil {
+			return c.Status(errorStatus(err)).JSON(errorBody(err))
+		}
+		return c.Next()
+	}
+}
+
+func requireServiceScope(ctx context.Context, scope string) error {
+	principal, ok := pkgauth.FromContext(ctx)
+	if !ok || principal.IsUser() {
+		return nil
+	}
+	if scope == "" || !principal.HasScope(scope) {
+		return errInsufficientScope
+	}
+	return nil
+}
+
+func apiKeyPrincipal(apiKey *domain.ApiKey) *pkgauth.Principal {
+	return &pkgauth.Principal{
+		Kind:     pkgauth.KindUser,
+		Subject:  apiKey.UserId,
+		Scopes:   apiKey.Scopes,
+		Method:   pkgauth.MethodApiKey,
+		TokenId:  apiKey.Id,
+		TenantId: apiKey.TenantId,
+	}
+}
+
+// parseBearerToken verifies an access token the way the bearer middleware
+// does, for transports that do not go through Fiber.
+func parseBearerToken(securityConfig config.SecurityConfig, raw string) (*pkgauth.Principal, error) {
+	token, err := jwt.Parse(raw, func(*jwt.Token) (any, error) {
+		return []byte(securityConfig.JwtSecretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, errInvalidToken
+	}
+	return principalFromClaims(sub, claims), nil
+}
+
+func authenticated(c *fiber.Ctx, principal *pkgauth.Principal) error {
+	ctx, err := scopeToPrincipal(c.UserContext(), principal.TenantId)
+	if err != nil {
+		return c.Status(errorStatus(err)).JSON(errorBody(err))
+	}
+
+	c.SetUserContext(pkgauth.WithPrincipal(ctx, principal))
+	return c.Next()
+}
+
+// principalFromClaims treats tokens without a "principal" claim as user
+// tokens, as they were issued before service accounts existed, and tokens
+// without a "tenant" claim as tokens of the default tenant, as they were
+// issued before tenants existed.
+func principalFromClaims(sub string, claims jwt.MapClaims) *pkgauth.Principal {
+	principal := &pkgauth.Principal{
+		Kind:    pkgauth.KindUser,
+		Subject: sub,
+		Method:  pkgauth.MethodBearerToken,
+		Roles:   claimStrings(claims["roles"]),
+	}
+	principal.TokenId, _ = claims["jti"].(string)
+	principal.TenantId, _ = claims["tenant"].(string)
+	if principal.TenantId == "" {
+		principal.TenantId = infrastructure.DefaultTenantId
+	}
+
+	if kind, _ := claims["principal"].(string); kind == string(pkgauth.KindService) {
+		principal.Kind = pkgauth.KindService
+		scope, _ := claims["scope"].(string)
+		principal.Scopes = strings.Fields(scope)
+		return principal
+	}
+
+	principal.Email, _ = claims["email"].(string)
+	principal.FullName, _ = claims["fullName"].(string)
+	return principal
+}
+
+func claimStrings(claim any) []string {
+	values, _ := claim.([]any)
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+	return strs
+}
+
+func apiKeyFrom(c *fiber.Ctx) (string, bool) {
+	if key := c.Get(apiKeyHeader); key != "" {
+		return key, true
+	}
+
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if len(authorization) > len(apiKeyScheme) && strings.EqualFold(authorization[:len(apiKeyScheme)], apiKeyScheme) {
+		return strings.TrimSpace(authorization[len(apiKeyScheme):]), true
+	}
+	return "", false
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+func TestInteractiveMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *pkgauth.Principal
+		want      int
+	}{
+		{"user access token", &pkgauth.Principal{Kind: pkgauth.KindUser, Method: pkgauth.MethodBearerToken}, fiber.StatusOK},
+		{"api key", &pkgauth.Principal{Kind: pkgauth.KindUser, Method: pkgauth.MethodApiKey, Scopes: []string{"write"}}, fiber.StatusForbidden},
+		{"service token", &pkgauth.Principal{Kind: pkgauth.KindService, Method: pkgauth.MethodBearerToken}, fiber.StatusForbidden},
+		{"anonymous", nil, fiber.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if test.principal != nil {
+					c.SetUserContext(pkgauth.WithPrincipal(c.UserContext(), test.principal))
+				}
+				return c.Next()
+			})
+			app.Post("/user/api-keys", InteractiveMiddleware(), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodPost, "/user/api-keys", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, test.want)
+			}
+		})
+	}
+}
+
+func TestServiceScopeMiddleware(t *testing.T) {
+	service := &pkgauth.Principal{Kind: pkgauth.KindService, Scopes: []string{pkgauth.ScopeUsersRead}}
+	tests := []struct {
+		name      string
+		principal *pkgauth.Principal
+		scope     string
+		want      int
+	}{
+		{"service with the scope", service, pkgauth.ScopeUsersRead, fiber.StatusOK},
+		{"service without the scope", service, pkgauth.ScopeUsersWrite, fiber.StatusForbidden},
+		{"service on a route for users", service, "", fiber.StatusForbidden},
+		{"user on a route for users", &pkgauth.Principal{Kind: pkgauth.KindUser}, "", fiber.StatusOK},
+		{"user without the scope", &pkgauth.Principal{Kind: pkgauth.KindUser}, pkgauth.ScopeUsersWrite, fiber.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				c.SetUserContext(pkgauth.WithPrincipal(c.UserContext(), test.principal))
+				return c.Next()
+			})
+			app.Get("/users/", ServiceScopeMiddleware(test.scope), func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/users/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != test.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, test.want)
+			}
+		})
+	}
+}
+
+func TestServiceTokenTenant(t *testing.T) {
+	claims := jwt.MapClaims{"principal": string(pkgauth.KindService), "scope": pkgauth.ScopeUsersRead, "tenant": "acme"}
+	principal := principalFromClaims("billing", claims)
+	if principal.TenantId != "acme" {
+		t.Fatalf("tenant = %q, want acme", principal.TenantId)
+	}
+
+	ctx, err := scopeToPrincipal(tenant.WithTenant(context.Background(), "acme", tenant.SourceHeader), principal.TenantId)
+	if err != nil {
+		t.Fatalf("own tenant: %v", err)
+	}
+	if id, _ := tenant.FromContext(ctx); id != "acme" {
+		t.Fatalf("scoped to %q, want acme", id)
+	}
+
+	_, err = scopeToPrincipal(tenant.WithTenant(context.Background(), "globex", tenant.SourceHeader), principal.TenantId)
+	if !errors.Is(err, tenant.ErrTenantMismatch) {
+		t.Fatalf("other tenant: err = %v, want %v", err, tenant.ErrTenantMismatch)
+	}
+
+	delete(claims, "tenant")
+	if principal := principalFromClaims("billing", claims); principal.TenantId != "default" {
+		t.Fatalf("token without tenant claim: tenant = %q, want default", principal.TenantId)
+	}
+}
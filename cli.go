@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/app/oauth"
+	"github.com/knetic0/production-ready-go-cqrs/app/tenant"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+)
+
+var errUsage = errors.New(`usage:
+  main oauth-clients create [-tenant <tenant id>] -name <name> -scopes <scope,...>
+  main oauth-clients list
+  main oauth-clients revoke -client-id <client id>
+  main tenants create -id <id> -name <name>
+  main tenants list
+  main openapi [-output <file>]`)
+
+// runCommand executes an administrative command instead of starting the
+// server. Commands go through the same handlers and validation as HTTP
+// requests and print their response as JSON.
+func runCommand(applicationConfig *config.ApplicationConfig, args []string) error {
+	if len(args) > 0 && args[0] == "openapi" {
+		return runOpenAPICommand(applicationConfig, args[1:])
+	}
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	db := infrastructure.NewPostgreAdapter(applicationConfig.Postgre.DSN, postgreOptions(applicationConfig))
+	ctx := context.Background()
+	flags := flag.NewFlagSet(args[0]+" "+args[1], flag.ContinueOnError)
+
+	switch args[0] {
+	case "oauth-clients":
+		return runOAuthClientCommand(ctx, infrastructure.NewOAuthClientRepositoryAdapter(db), infrastructure.NewTenantRepositoryAdapter(db), flags, args[1:])
+	case "tenants":
+		return runTenantCommand(ctx, infrastructure.NewTenantRepositoryAdapter(db), flags, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+func runOAuthClientCommand(ctx context.Context, repository domain.OAuthClientRepository, tenants domain.TenantRepository, flags *flag.FlagSet, args []string) error {
+	switch args[0] {
+	case "create":
+		tenantId := flags.String("tenant", infrastructure.DefaultTenantId, "tenant the client's tokens act in")
+		name := flags.String("name", "", "name of the client")
+		scopes := flags.String("scopes", "", "comma separated scopes the client may request")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return execute(ctx, oauth.NewClientCreateHandler(repository, tenants), &oauth.ClientCreateRequest{
+			TenantId: *tenantId,
+			Name:     *name,
+			Scopes:   splitList(*scopes),
+		})
+	case "list":
+		return execute(ctx, oauth.NewClientListHandler(repository), &oauth.ClientListRequest{})
+	case "revoke":
+		clientId := flags.String("client-id", "", "client id to revoke")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return execute(ctx, oauth.NewClientRevokeHandler(repository), &oauth.ClientRevokeRequest{ClientId: *clientId})
+	default:
+		return errUsage
+	}
+}
+
+func runTenantCommand(ctx context.Context, repository domain.TenantRepository, flags *flag.FlagSet, args []string) error {
+	switch args[0] {
+	case "create":
+		id := flags.String("id", "", "tenant id, also used as its subdomain")
+		name := flags.String("name", "", "name of the tenant")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		return execute(ctx, tenant.NewTenantCreateHandler(repository), &tenant.TenantCreateRequest{Id: *id, Name: *name})
+	case "list":
+		return execute(ctx, tenant.NewTenantListHandler(repository), &tenant.TenantListRequest{})
+	default:
+		return errUsage
+	}
+}
+
+// runOpenAPICommand writes the OpenAPI document of the routes main
+// registers, without connecting to the database.
+func runOpenAPICommand(applicationConfig *config.ApplicationConfig, args []string) error {
+	flags := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	output := flags.String("output", "", "file to write the document to instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	document := newDocument(applicationConfig)
+	registerRoutes(fiber.New(), document, applicationConfig, nil, infrastructure.NewTenantRepositoryAdapter(nil), newHandlers(applicationConfig, nil, nil, initJobQueue(applicationConfig.Jobs, nil), nil, http.DefaultClient))
+
+	encoded, err := json.MarshalIndent(document.Document(), "", "  ")
+	if err != nil {
+		return err
+	}
+	encoded = append(encoded, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(encoded)
+		return err
+	}
+	return os.WriteFile(*output, encoded, 0o644)
+}
+
+func execute[TReq Request, TRes Response](ctx context.Context, handler HandlerInterface[TReq, TRes], request *TReq) error {
+	if err := validate.Struct(request); err != nil {
+		return validationError(err)
+	}
+
+	res, err := handler.Handle(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(res)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func printCommandError(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	for _, field := range apperror.FieldsOf(err) {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", field.Field, field.Message)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/knetic0/production-ready-go-cqrs/app/auth"
+	"github.com/knetic0/production-ready-go-cqrs/app/user"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/codec"
+	authv1 "github.com/knetic0/production-ready-go-cqrs/proto/auth/v1"
+	userv1 "github.com/knetic0/production-ready-go-cqrs/proto/user/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// codecs encode and decode bodies in the format clients negotiate, JSON
+// unless they ask for another. Error bodies are always JSON.
+var codecs = codec.NewRegistry(codec.JSON(), codec.MessagePack(), codec.CBOR(), newProtobufCodec())
+
+// newProtobufCodec registers the requests and responses that have a
+// message in the user.v1 and auth.v1 schemas.
+func newProtobufCodec() *codec.Protobuf {
+	protobuf := codec.NewProtobuf()
+
+	codec.RegisterDecoder(protobuf, func(message *userv1.CreateUserRequest, request *user.UserCreateRequest) {
+		*request = user.UserCreateRequest{
+			FirstName: message.GetFirstName(),
+			LastName:  message.GetLastName(),
+			Email:     message.GetEmail(),
+			Password:  message.GetPassword(),
+			Locale:    message.GetLocale(),
+		}
+	})
+	codec.RegisterDecoder(protobuf, func(message *authv1.LoginRequest, request *auth.LoginRequest) {
+		*request = auth.LoginRequest{Email: message.GetEmail(), Password: message.GetPassword()}
+	})
+
+	codec.RegisterEncoder(protobuf, func(res *user.UserResponseV1) proto.Message {
+		return &userv1.GetUserResponse{User: userV1Message(&res.User)}
+	})
+	codec.RegisterEncoder(protobuf, func(res *user.UserResponseV2) proto.Message {
+		return &userv1.GetUserResponse{User: userV2Message(&res.User)}
+	})
+	codec.RegisterEncoder(protobuf, func(res *user.UserListResponseV1) proto.Message {
+		users := make([]*userv1.User, len(res.Users))
+		for i := range res.Users {
+			users[i] = userV1Message(&res.Users[i])
+		}
+		return &userv1.ListUsersResponse{Users: users}
+	})
+	codec.RegisterEncoder(protobuf, func(res *user.UserListResponseV2) proto.Message {
+		users := make([]*userv1.User, len(res.Users))
+		for i := range res.Users {
+			users[i] = userV2Message(&res.Users[i])
+		}
+		return &userv1.ListUsersResponse{Users: users}
+	})
+	codec.RegisterEncoder(protobuf, func(res *auth.LoginResponse) proto.Message {
+		return loginMessage(res)
+	})
+	return protobuf
+}
+
+func userV1Message(u *user.UserV1) *userv1.User {
+	message := &userv1.User{
+		Id:            u.Id,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Email:         u.Email,
+		Locale:        u.Locale,
+		EmailVerified: u.EmailVerified,
+		MfaEnabled:    u.MfaEnabled,
+	}
+	if u.EmailVerifiedAt != nil {
+		message.EmailVerifiedAt = timestamppb.New(*u.EmailVerifiedAt)
+	}
+	return message
+}
+
+func userV2Message(u *user.UserV2) *userv1.User {
+	message := &userv1.User{
+		Id:            u.Id,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Email:         u.Email,
+		Locale:        u.Locale,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		MfaEnabled:    u.MfaEnabled,
+	}
+	if u.EmailVerifiedAt != nil {
+		message.EmailVerifiedAt = timestamppb.New(*u.EmailVerifiedAt)
+	}
+	return message
+}
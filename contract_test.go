@@ -0,0 +1,937 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/app/apikey"
+	"github.com/knetic0/production-ready-go-cqrs/app/auth"
+	"github.com/knetic0/production-ready-go-cqrs/app/healthcheck"
+	"github.com/knetic0/production-ready-go-cqrs/app/oauth"
+	"github.com/knetic0/production-ready-go-cqrs/app/user"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/health"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/openapi"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/openapi/openapitest"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
+)
+
+// TestContract mounts the routes of every version behind the contract
+// middleware and calls each documented operation into a success and an
+// error response, so every schema the document declares is checked against
+// a real response.
+func TestContract(t *testing.T) {
+	for _, version := range apiVersions {
+		t.Run(version, func(t *testing.T) {
+			f := newContractFixture(t)
+			for _, step := range f.steps(version) {
+				resp, err := f.app.Test(step.request(), -1)
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				body, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if resp.StatusCode != step.want {
+					t.Fatalf("%s: status = %d, want %d: %s", step.name, resp.StatusCode, step.want, body)
+				}
+				if step.then != nil {
+					step.then(resp, body)
+				}
+			}
+
+			for path, item := range f.document.Document().Paths {
+				if !strings.HasPrefix(path, "/"+version+"/") {
+					continue
+				}
+				for method := range item {
+					operation := strings.ToUpper(method) + " " + path
+					if !f.succeeded[operation] {
+						t.Errorf("%s has no test of a successful response", operation)
+					}
+					if !f.failed[operation] {
+						t.Errorf("%s has no test of an error response", operation)
+					}
+				}
+			}
+		})
+	}
+}
+
+// contractStep is one request of the contract test. Requests are built
+// when the step runs, so they can use what earlier steps returned.
+type contractStep struct {
+	name    string
+	request func() *http.Request
+	want    int
+	then    func(resp *http.Response, body []byte)
+}
+
+type contractFixture struct {
+	t        *testing.T
+	app      *fiber.App
+	document *openapi.Builder
+	config   *config.ApplicationConfig
+	hasher   security.PasswordHasher
+	issuer   *auth.TokenIssuer
+
+	users         *memoryUsers
+	apiKeys       *memoryApiKeys
+	recoveryCodes *memoryRecoveryCodes
+	imports       *memoryUserImports
+
+	clientId     string
+	clientSecret string
+
+	succeeded map[string]bool
+	failed    map[string]bool
+}
+
+const contractPassword = "lantern-quiet-7"
+
+var routeParameter = regexp.MustCompile(`:([A-Za-z0-9_]+)\??`)
+
+func newContractFixture(t *testing.T) *contractFixture {
+	t.Helper()
+	applicationConfig := config.Read()
+	// The hashes of the fixture do not need to resist anyone.
+	applicationConfig.Security.PasswordHashing.Argon2id = config.Argon2idConfig{MemoryKiB: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	applicationConfig.Security.Oidc.Providers = nil
+
+	f := &contractFixture{
+		t:             t,
+		config:        applicationConfig,
+		hasher:        initPasswordHasher(applicationConfig.Security.PasswordHashing),
+		users:         &memoryUsers{users: make(map[string]*domain.User)},
+		apiKeys:       &memoryApiKeys{},
+		recoveryCodes: &memoryRecoveryCodes{codes: make(map[string]string)},
+		imports:       &memoryUserImports{imports: make(map[string]*domain.UserImport)},
+		succeeded:     make(map[string]bool),
+		failed:        make(map[string]bool),
+	}
+
+	refreshTokens := &memoryRefreshTokens{}
+	oauthClients := &memoryOAuthClients{}
+	tenants := &memoryTenants{}
+	securityConfig := applicationConfig.Security
+	notifier := &discardNotifier{}
+	passwordPolicy := initPasswordPolicy(securityConfig.PasswordPolicy)
+	verificationMailer := auth.NewVerificationMailer(f.users, notifier, securityConfig)
+	loginThrottle := auth.NewLoginThrottle(infrastructure.NewLoginAttemptMemoryStore(), infrastructure.NewLogSecurityEventPublisher(), securityConfig.LoginThrottle)
+	identityProviders := map[string]domain.IdentityProvider{"stub": &stubIdentityProvider{}}
+	loginStates := &memoryLoginStates{states: make(map[string]*domain.OidcLoginState)}
+	externalIdentities := &memoryExternalIdentities{}
+	f.issuer = auth.NewTokenIssuer(refreshTokens, securityConfig)
+	registry := health.NewRegistry(health.Config{Timeout: time.Second})
+	registry.Register("postgres", true, health.CheckerFunc(func(ctx context.Context) error { return nil }))
+	registry.Register("otlp", false, health.CheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") }))
+
+	h := &handlers{
+		healthCheck:         healthcheck.NewHealthCheckHandler(registry),
+		userCreate:          user.NewUserCreateHandler(f.users, f.hasher, passwordPolicy, verificationMailer),
+		userGet:             user.NewUserGetHandler(f.users),
+		userList:            user.NewUserListHandler(f.users),
+		userExport:          user.NewUserExportHandler(f.users),
+		userImport:          user.NewUserImportHandler(f.imports, &discardJobQueue{}, applicationConfig.UserImport.MaxRows),
+		userImportGet:       user.NewUserImportGetHandler(f.imports),
+		me:                  user.NewMeHandler(f.users),
+		changePassword:      user.NewChangePasswordHandler(f.users, refreshTokens, f.hasher, passwordPolicy, loginThrottle),
+		login:               auth.NewLoginHandler(f.users, f.hasher, f.issuer, loginThrottle, securityConfig),
+		mfaVerify:           auth.NewMfaVerifyHandler(f.users, f.recoveryCodes, &memoryMfaChallenges{used: make(map[string]bool)}, f.issuer, loginThrottle, securityConfig),
+		mfaEnroll:           auth.NewMfaEnrollHandler(f.users, securityConfig),
+		mfaConfirm:          auth.NewMfaConfirmHandler(f.users, f.recoveryCodes, securityConfig),
+		mfaDisable:          auth.NewMfaDisableHandler(f.users, f.recoveryCodes, f.hasher, loginThrottle, securityConfig),
+		verifyEmail:         auth.NewVerifyEmailHandler(f.users, securityConfig),
+		resendVerification:  auth.NewResendVerificationHandler(f.users, verificationMailer, securityConfig),
+		oidcLogin:           auth.NewOidcLoginHandler(identityProviders, loginStates, securityConfig.Oidc),
+		oidcCallback:        auth.NewOidcCallbackHandler(identityProviders, loginStates, externalIdentities, f.users, f.hasher, f.issuer, securityConfig),
+		apiKeyAuthenticator: apikey.NewAuthenticator(f.apiKeys),
+		apiKeyCreate:        apikey.NewApiKeyCreateHandler(f.apiKeys),
+		apiKeyList:          apikey.NewApiKeyListHandler(f.apiKeys),
+		apiKeyRevoke:        apikey.NewApiKeyRevokeHandler(f.apiKeys),
+		oauthToken:          oauth.NewTokenHandler(oauthClients, f.issuer),
+	}
+
+	clientId, clientSecret, err := security.GenerateClientCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.clientId, f.clientSecret = clientId, clientSecret
+	oauthClients.clients = append(oauthClients.clients, domain.OAuthClient{
+		Id:         uuid.New().String(),
+		TenantId:   infrastructure.DefaultTenantId,
+		ClientId:   clientId,
+		Name:       "reporting",
+		SecretHash: security.HashClientSecret(clientSecret),
+		Scopes:     []string{pkgauth.ScopeUsersRead},
+		CreatedAt:  time.Now(),
+	})
+
+	f.document = newDocument(applicationConfig)
+	f.app = fiber.New()
+	f.app.Use(openapitest.ContractMiddleware(t, openapi.NewValidator(f.document.Document())))
+	f.app.Use(f.recordOutcome)
+	registerRoutes(f.app, f.document, applicationConfig, nil, tenants, h)
+	return f
+}
+
+// recordOutcome notes which operations answered with a success and which
+// with an error.
+func (f *contractFixture) recordOutcome(c *fiber.Ctx) error {
+	err := c.Next()
+	operation := c.Method() + " " + routeParameter.ReplaceAllString(c.Route().Path, "{$1}")
+	switch status := c.Response().StatusCode(); {
+	case status < 400:
+		f.succeeded[operation] = true
+	case status < 500:
+		f.failed[operation] = true
+	}
+	return err
+}
+
+// addUser stores a user of the default tenant with contractPassword.
+func (f *contractFixture) addUser(name string, configure func(u *domain.User)) *domain.User {
+	f.t.Helper()
+	hashed, err := f.hasher.Hash(contractPassword)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	u := &domain.User{
+		Id:            uuid.New().String(),
+		TenantId:      infrastructure.DefaultTenantId,
+		FirstName:     strings.ToUpper(name[:1]) + name[1:],
+		LastName:      "Tester",
+		Email:         name + "@example.com",
+		Password:      hashed,
+		Locale:        "en",
+		EmailVerified: true,
+	}
+	if configure != nil {
+		configure(u)
+	}
+	f.users.users[u.Id] = u
+	return u
+}
+
+// enrollTotp gives the user an encrypted TOTP secret and returns the
+// secret.
+func (f *contractFixture) enrollTotp(u *domain.User) string {
+	f.t.Helper()
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if u.TotpSecret, err = security.EncryptSecret(f.config.Security.Mfa.EncryptionKey, secret); err != nil {
+		f.t.Fatal(err)
+	}
+	return secret
+}
+
+func (f *contractFixture) accessToken(u *domain.User) string {
+	f.t.Helper()
+	res, err := f.issuer.Issue(context.Background(), u)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return res.Token
+}
+
+func (f *contractFixture) serviceToken(scopes ...string) string {
+	f.t.Helper()
+	token, _, err := f.issuer.IssueServiceToken(&domain.OAuthClient{ClientId: f.clientId, TenantId: infrastructure.DefaultTenantId}, scopes)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return token
+}
+
+func (f *contractFixture) apiKey(u *domain.User, scopes ...string) string {
+	f.t.Helper()
+	key, prefix, err := security.GenerateApiKey()
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	f.apiKeys.keys = append(f.apiKeys.keys, domain.ApiKey{
+		Id:        uuid.New().String(),
+		TenantId:  u.TenantId,
+		Name:      "ci",
+		Prefix:    prefix,
+		KeyHash:   security.HashApiKey(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		UserId:    u.Id,
+	})
+	return key
+}
+
+func (f *contractFixture) verificationToken(u *domain.User) string {
+	f.t.Helper()
+	token, err := security.SignPurposeToken(f.config.Security.JwtSecretKey, security.PurposeClaims{
+		Purpose:          security.PurposeEmailVerification,
+		Email:            u.Email,
+		Tenant:           u.TenantId,
+		RegisteredClaims: jwt.RegisteredClaims{Subject: u.Id},
+	}, time.Hour)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return token
+}
+
+func (f *contractFixture) steps(version string) []contractStep {
+	ada := f.addUser("ada", nil)
+	grace := f.addUser("grace", nil)
+	unverified := f.addUser("linus", func(u *domain.User) { u.EmailVerified = false })
+	challenged := f.addUser("barbara", func(u *domain.User) { u.MfaEnabled = true })
+	f.enrollTotp(challenged)
+	f.recoveryCodes.codes[security.HashRecoveryCode(f.config.Security.Mfa.EncryptionKey, "recovery-1")] = challenged.Id
+	disabling := f.addUser("frances", func(u *domain.User) { u.MfaEnabled = true })
+	disablingSecret := f.enrollTotp(disabling)
+	enrolling := f.addUser("hedy", nil)
+	confirming := f.addUser("radia", nil)
+	confirmingSecret := f.enrollTotp(confirming)
+
+	userImport := &domain.UserImport{
+		Id:        uuid.New().String(),
+		TenantId:  infrastructure.DefaultTenantId,
+		Format:    user.ImportFormatCSV,
+		Status:    domain.UserImportCompleted,
+		Total:     1,
+		Processed: 1,
+		Created:   1,
+		Rows:      []domain.UserImportRow{},
+		CreatedAt: time.Now(),
+	}
+	f.imports.imports[userImport.Id] = userImport
+
+	adaToken := f.accessToken(ada)
+	bearer := func(token string) http.Header {
+		return http.Header{fiber.HeaderAuthorization: {"Bearer " + token}}
+	}
+	asAda := bearer(adaToken)
+	adaKey := http.Header{"X-Api-Key": {f.apiKey(ada, domain.ApiKeyScopeWrite)}}
+	readService := bearer(f.serviceToken(pkgauth.ScopeUsersRead))
+	writeService := bearer(f.serviceToken(pkgauth.ScopeUsersWrite))
+
+	v := "/" + version
+	var mfaToken, oidcState, apiKeyId string
+	return []contractStep{
+		{
+			name:    "log in",
+			request: f.json(fiber.MethodPost, v+"/login/", nil, map[string]any{"email": ada.Email, "password": contractPassword}),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "log in with a wrong password",
+			request: f.json(fiber.MethodPost, v+"/login/", nil, map[string]any{"email": ada.Email, "password": "wrong-password-1"}),
+			want:    fiber.StatusUnauthorized,
+		},
+		{
+			name:    "log in with MFA",
+			request: f.json(fiber.MethodPost, v+"/login/", nil, map[string]any{"email": challenged.Email, "password": contractPassword}),
+			want:    fiber.StatusOK,
+			then: func(resp *http.Response, body []byte) {
+				var res auth.LoginResponse
+				if err := json.Unmarshal(body, &res); err != nil || res.MfaToken == "" {
+					f.t.Fatalf("log in with MFA: no challenge in %s", body)
+				}
+				mfaToken = res.MfaToken
+			},
+		},
+		{
+			name: "complete a login with a recovery code",
+			request: func() *http.Request {
+				return f.json(fiber.MethodPost, v+"/auth/mfa/verify", nil, map[string]any{"mfaToken": mfaToken, "recoveryCode": "recovery-1"})()
+			},
+			want: fiber.StatusOK,
+		},
+		{
+			name:    "complete a login with a bad challenge",
+			request: f.json(fiber.MethodPost, v+"/auth/mfa/verify", nil, map[string]any{"mfaToken": "not-a-token", "recoveryCode": "recovery-1"}),
+			want:    fiber.StatusUnauthorized,
+		},
+		{
+			name:    "verify an email",
+			request: f.empty(fiber.MethodGet, v+"/auth/verify-email?token="+url.QueryEscape(f.verificationToken(unverified)), nil),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "verify an email with a bad token",
+			request: f.empty(fiber.MethodGet, v+"/auth/verify-email?token=not-a-token", nil),
+			want:    fiber.StatusBadRequest,
+		},
+		{
+			name:    "resend the verification email",
+			request: f.json(fiber.MethodPost, v+"/auth/verify-email/resend", nil, map[string]any{"email": "nobody@example.com"}),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "resend the verification email to no address",
+			request: f.json(fiber.MethodPost, v+"/auth/verify-email/resend", nil, map[string]any{"email": "nobody"}),
+			want:    fiber.StatusBadRequest,
+		},
+		{
+			name:    "issue a service token",
+			request: f.form(v+"/oauth/token", url.Values{"grant_type": {"client_credentials"}, "client_id": {f.clientId}, "client_secret": {f.clientSecret}}),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "issue a service token with a wrong secret",
+			request: f.form(v+"/oauth/token", url.Values{"grant_type": {"client_credentials"}, "client_id": {f.clientId}, "client_secret": {"wrong"}}),
+			want:    fiber.StatusUnauthorized,
+		},
+		{
+			name:    "start an external login",
+			request: f.empty(fiber.MethodGet, v+"/auth/oidc/stub/login", nil),
+			want:    fiber.StatusFound,
+			then: func(resp *http.Response, body []byte) {
+				location, err := url.Parse(resp.Header.Get(fiber.HeaderLocation))
+				if err != nil || location.Query().Get("state") == "" {
+					f.t.Fatalf("start an external login: no state in %q", resp.Header.Get(fiber.HeaderLocation))
+				}
+				oidcState = location.Query().Get("state")
+			},
+		},
+		{
+			name:    "start an external login with an unknown provider",
+			request: f.empty(fiber.MethodGet, v+"/auth/oidc/unknown/login", nil),
+			want:    fiber.StatusNotFound,
+		},
+		{
+			name: "complete an external login from another browser",
+			request: func() *http.Request {
+				return f.empty(fiber.MethodGet, v+"/auth/oidc/stub/callback?code=code&state="+oidcState, http.Header{"Cookie": {auth.OidcStateCookie + "=other"}})()
+			},
+			want: fiber.StatusBadRequest,
+		},
+		{
+			name: "complete an external login",
+			request: func() *http.Request {
+				return f.empty(fiber.MethodGet, v+"/auth/oidc/stub/callback?code=code&state="+oidcState, http.Header{"Cookie": {auth.OidcStateCookie + "=" + oidcState}})()
+			},
+			want: fiber.StatusOK,
+		},
+		{
+			name:    "check the service",
+			request: f.empty(fiber.MethodGet, v+"/healthcheck", asAda),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "check the service as a service",
+			request: f.empty(fiber.MethodGet, v+"/healthcheck", readService),
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "create a user",
+			request: f.json(fiber.MethodPost, v+"/users/", writeService, map[string]any{"firstName": "Katherine", "lastName": "Johnson", "email": "katherine@example.com", "password": "orbital-meadow-61"}),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "create a user with a read only service token",
+			request: f.json(fiber.MethodPost, v+"/users/", readService, map[string]any{"firstName": "Dorothy", "lastName": "Vaughan", "email": "dorothy@example.com", "password": "orbital-meadow-61"}),
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "export users",
+			request: f.empty(fiber.MethodGet, v+"/users/export?format=ndjson", asAda),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "export users in an unknown format",
+			request: f.empty(fiber.MethodGet, v+"/users/export?format=xml", asAda),
+			want:    fiber.StatusBadRequest,
+		},
+		{
+			name:    "import users",
+			request: f.upload(v+"/users/imports", asAda, "firstName,lastName,email,password\nMary,Jackson,mary@example.com,orbital-meadow-61\n"),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "import no users",
+			request: f.upload(v+"/users/imports", asAda, "firstName,lastName,email,password\n"),
+			want:    fiber.StatusBadRequest,
+		},
+		{
+			name:    "get an import",
+			request: f.empty(fiber.MethodGet, v+"/users/imports/"+userImport.Id, asAda),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "get an unknown import",
+			request: f.empty(fiber.MethodGet, v+"/users/imports/"+uuid.New().String(), asAda),
+			want:    fiber.StatusNotFound,
+		},
+		{
+			name:    "get a user",
+			request: f.empty(fiber.MethodGet, v+"/users/"+ada.Id, readService),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "get an unknown user",
+			request: f.empty(fiber.MethodGet, v+"/users/"+uuid.New().String(), readService),
+			want:    fiber.StatusNotFound,
+		},
+		{
+			name:    "list users",
+			request: f.empty(fiber.MethodGet, v+"/users/", readService),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "list users with unknown fields",
+			request: f.empty(fiber.MethodGet, v+"/users/?fields=unknown", readService),
+			want:    fiber.StatusBadRequest,
+		},
+		{
+			name:    "get the authenticated user",
+			request: f.empty(fiber.MethodGet, v+"/user", asAda),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "get the authenticated user as a service",
+			request: f.empty(fiber.MethodGet, v+"/user", readService),
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "change the password with an api key",
+			request: f.json(fiber.MethodPut, v+"/user/password", adaKey, map[string]any{"currentPassword": contractPassword, "newPassword": "harbor-violet-93"}),
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "change the password",
+			request: f.json(fiber.MethodPut, v+"/user/password", bearer(f.accessToken(grace)), map[string]any{"currentPassword": contractPassword, "newPassword": "harbor-violet-93"}),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "create an api key",
+			request: f.json(fiber.MethodPost, v+"/user/api-keys", asAda, map[string]any{"name": "deploy", "scopes": []string{domain.ApiKeyScopeRead}}),
+			want:    fiber.StatusOK,
+			then: func(resp *http.Response, body []byte) {
+				var res apikey.ApiKeyCreateResponse
+				if err := json.Unmarshal(body, &res); err != nil {
+					f.t.Fatalf("create an api key: %v", err)
+				}
+				apiKeyId = res.ApiKey.Id
+			},
+		},
+		{
+			name:    "create an api key with an unknown scope",
+			request: f.json(fiber.MethodPost, v+"/user/api-keys", asAda, map[string]any{"name": "deploy", "scopes": []string{"admin"}}),
+			want:    fiber.StatusBadRequest,
+		},
+		{
+			name:    "list api keys",
+			request: f.empty(fiber.MethodGet, v+"/user/api-keys", asAda),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "list api keys with an api key",
+			request: f.empty(fiber.MethodGet, v+"/user/api-keys", adaKey),
+			want:    fiber.StatusForbidden,
+		},
+		{
+			name:    "revoke an api key",
+			request: func() *http.Request { return f.empty(fiber.MethodDelete, v+"/user/api-keys/"+apiKeyId, asAda)() },
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "revoke an unknown api key",
+			request: f.empty(fiber.MethodDelete, v+"/user/api-keys/"+uuid.New().String(), asAda),
+			want:    fiber.StatusNotFound,
+		},
+		{
+			name:    "start TOTP enrollment",
+			request: f.empty(fiber.MethodPost, v+"/user/mfa/totp", bearer(f.accessToken(enrolling))),
+			want:    fiber.StatusOK,
+		},
+		{
+			name:    "start TOTP enrollment with MFA enabled",
+			request: f.empty(fiber.MethodPost, v+"/user/mfa/totp", bearer(f.accessToken(challenged))),
+			want:    fiber.StatusConflict,
+		},
+		{
+			name: "confirm TOTP enrollment",
+			request: func() *http.Request {
+				return f.json(fiber.MethodPost, v+"/user/mfa/totp/confirm", bearer(f.accessToken(confirming)), map[string]any{"code": totpCode(f.t, confirmingSecret)})()
+			},
+			want: fiber.StatusOK,
+		},
+		{
+			name:    "confirm TOTP enrollment without starting it",
+			request: f.json(fiber.MethodPost, v+"/user/mfa/totp/confirm", asAda, map[string]any{"code": "123456"}),
+			want:    fiber.StatusConflict,
+		},
+		{
+			name: "disable TOTP",
+			request: func() *http.Request {
+				return f.json(fiber.MethodDelete, v+"/user/mfa/totp", bearer(f.accessToken(disabling)), map[string]any{"password": contractPassword, "code": totpCode(f.t, disablingSecret)})()
+			},
+			want: fiber.StatusOK,
+		},
+		{
+			name:    "disable TOTP without MFA enabled",
+			request: f.json(fiber.MethodDelete, v+"/user/mfa/totp", asAda, map[string]any{"password": contractPassword, "recoveryCode": "recovery-1"}),
+			want:    fiber.StatusConflict,
+		},
+	}
+}
+
+func (f *contractFixture) empty(method, target string, header http.Header) func() *http.Request {
+	return func() *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		return req
+	}
+}
+
+func (f *contractFixture) json(method, target string, header http.Header, body any) func() *http.Request {
+	return func() *http.Request {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		req := httptest.NewRequest(method, target, strings.NewReader(string(encoded)))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return req
+	}
+}
+
+func (f *contractFixture) form(target string, values url.Values) func() *http.Request {
+	return func() *http.Request {
+		req := httptest.NewRequest(fiber.MethodPost, target, strings.NewReader(values.Encode()))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		return req
+	}
+}
+
+func (f *contractFixture) upload(target string, header http.Header, csv string) func() *http.Request {
+	return func() *http.Request {
+		req := httptest.NewRequest(fiber.MethodPost, target, strings.NewReader(csv))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		req.Header.Set(fiber.HeaderContentType, "text/csv")
+		return req
+	}
+}
+
+// totpCode returns the current RFC 6238 code of an unpadded base32 secret.
+func totpCode(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+type memoryUsers struct {
+	domain.UserRepository
+	users map[string]*domain.User
+}
+
+func (r *memoryUsers) Create(ctx context.Context, u *domain.User) error {
+	if _, err := r.GetByEmail(ctx, u.Email); err == nil {
+		return domain.ErrAlreadyExists
+	}
+	stored := *u
+	r.users[u.Id] = &stored
+	return nil
+}
+
+func (r *memoryUsers) Update(ctx context.Context, u *domain.User) error {
+	stored := *u
+	r.users[u.Id] = &stored
+	return nil
+}
+
+func (r *memoryUsers) AdvanceTotpCounter(ctx context.Context, id string, counter int64) (bool, error) {
+	u, ok := r.users[id]
+	if !ok || u.TotpLastCounter >= counter {
+		return false, nil
+	}
+	u.TotpLastCounter = counter
+	return true, nil
+}
+
+func (r *memoryUsers) Get(ctx context.Context, id string) (*domain.User, error) {
+	u, ok := r.users[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	found := *u
+	return &found, nil
+}
+
+func (r *memoryUsers) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	for _, u := range r.users {
+		if u.Email == email {
+			found := *u
+			return &found, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *memoryUsers) List(ctx context.Context) ([]domain.User, error) {
+	users := make([]domain.User, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, *u)
+	}
+	slices.SortFunc(users, func(a, b domain.User) int { return strings.Compare(a.Id, b.Id) })
+	return users, nil
+}
+
+func (r *memoryUsers) Stream(ctx context.Context, filter domain.UserFilter, fn func(*domain.User) error) error {
+	users, _ := r.List(ctx)
+	for i := range users {
+		if err := fn(&users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryRefreshTokens struct {
+	domain.RefreshTokenRepository
+}
+
+func (r *memoryRefreshTokens) Create(ctx context.Context, refreshToken *domain.RefreshToken) error {
+	return nil
+}
+
+func (r *memoryRefreshTokens) RevokeByUser(ctx context.Context, userId string) error {
+	return nil
+}
+
+// memoryRecoveryCodes maps code hashes to the users they belong to.
+type memoryRecoveryCodes struct {
+	codes map[string]string
+}
+
+func (r *memoryRecoveryCodes) Replace(ctx context.Context, userId string, codes []domain.RecoveryCode) error {
+	_ = r.DeleteByUser(ctx, userId)
+	for _, code := range codes {
+		r.codes[code.CodeHash] = userId
+	}
+	return nil
+}
+
+func (r *memoryRecoveryCodes) Consume(ctx context.Context, userId string, codeHash string) error {
+	if r.codes[codeHash] != userId {
+		return domain.ErrNotFound
+	}
+	delete(r.codes, codeHash)
+	return nil
+}
+
+func (r *memoryRecoveryCodes) DeleteByUser(ctx context.Context, userId string) error {
+	for hash, owner := range r.codes {
+		if owner == userId {
+			delete(r.codes, hash)
+		}
+	}
+	return nil
+}
+
+type memoryMfaChallenges struct {
+	domain.UsedMfaChallengeRepository
+	used map[string]bool
+}
+
+func (r *memoryMfaChallenges) Use(ctx context.Context, id string, expiresAt time.Time) error {
+	if r.used[id] {
+		return domain.ErrAlreadyExists
+	}
+	r.used[id] = true
+	return nil
+}
+
+type memoryApiKeys struct {
+	domain.ApiKeyRepository
+	keys []domain.ApiKey
+}
+
+func (r *memoryApiKeys) Create(ctx context.Context, apiKey *domain.ApiKey) error {
+	r.keys = append(r.keys, *apiKey)
+	return nil
+}
+
+func (r *memoryApiKeys) ListByUser(ctx context.Context, userId string) ([]domain.ApiKey, error) {
+	var keys []domain.ApiKey
+	for _, key := range r.keys {
+		if key.UserId == userId {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memoryApiKeys) GetByPrefix(ctx context.Context, prefix string) (*domain.ApiKey, error) {
+	for _, key := range r.keys {
+		if key.Prefix == prefix {
+			return &key, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *memoryApiKeys) Revoke(ctx context.Context, userId string, id string) error {
+	for i := range r.keys {
+		if r.keys[i].Id == id && r.keys[i].UserId == userId && r.keys[i].RevokedAt == nil {
+			now := time.Now()
+			r.keys[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (r *memoryApiKeys) TouchLastUsed(ctx context.Context, id string, at time.Time, ip string) error {
+	return nil
+}
+
+type memoryOAuthClients struct {
+	domain.OAuthClientRepository
+	clients []domain.OAuthClient
+}
+
+func (r *memoryOAuthClients) GetByClientId(ctx context.Context, clientId string) (*domain.OAuthClient, error) {
+	for _, client := range r.clients {
+		if client.ClientId == clientId {
+			return &client, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+type memoryLoginStates struct {
+	domain.OidcLoginStateRepository
+	states map[string]*domain.OidcLoginState
+}
+
+func (r *memoryLoginStates) Create(ctx context.Context, state *domain.OidcLoginState) error {
+	r.states[state.State] = state
+	return nil
+}
+
+func (r *memoryLoginStates) Consume(ctx context.Context, state string) (*domain.OidcLoginState, error) {
+	found, ok := r.states[state]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	delete(r.states, state)
+	return found, nil
+}
+
+type memoryExternalIdentities struct {
+	identities []domain.ExternalIdentity
+}
+
+func (r *memoryExternalIdentities) Create(ctx context.Context, identity *domain.ExternalIdentity) error {
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *memoryExternalIdentities) GetByIssuerSubject(ctx context.Context, issuer string, subject string) (*domain.ExternalIdentity, error) {
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, domain.ErrNotFound
+}
+
+func (r *memoryExternalIdentities) TouchLastLogin(ctx context.Context, id string, at time.Time) error {
+	return nil
+}
+
+type memoryUserImports struct {
+	domain.UserImportRepository
+	imports map[string]*domain.UserImport
+}
+
+func (r *memoryUserImports) Create(ctx context.Context, userImport *domain.UserImport) error {
+	r.imports[userImport.Id] = userImport
+	return nil
+}
+
+func (r *memoryUserImports) Get(ctx context.Context, id string) (*domain.UserImport, error) {
+	userImport, ok := r.imports[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return userImport, nil
+}
+
+type memoryTenants struct {
+	domain.TenantRepository
+}
+
+func (r *memoryTenants) Get(ctx context.Context, id string) (*domain.Tenant, error) {
+	if id != infrastructure.DefaultTenantId {
+		return nil, domain.ErrNotFound
+	}
+	return &domain.Tenant{Id: id}, nil
+}
+
+type discardJobQueue struct{}
+
+func (q *discardJobQueue) Enqueue(ctx context.Context, payload any, options domain.JobOptions) error {
+	return nil
+}
+
+type discardNotifier struct{}
+
+func (n *discardNotifier) Notify(ctx context.Context, notification domain.Notification) error {
+	return nil
+}
+
+// stubIdentityProvider signs everyone in as ada, with a verified email so
+// the first login links to the local account.
+type stubIdentityProvider struct{}
+
+func (p *stubIdentityProvider) AuthorizationURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p *stubIdentityProvider) Authenticate(ctx context.Context, code string, codeVerifier string, nonce string) (*domain.ExternalIdentityClaims, error) {
+	return &domain.ExternalIdentityClaims{
+		Issuer:        "https://idp.example.com",
+		Subject:       "ada",
+		Email:         "ada@example.com",
+		EmailVerified: true,
+	}, nil
+}
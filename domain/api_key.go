@@ -0,0 +1,43 @@
+package domain
+
+import "time"
+
+const (
+	ApiKeyScopeRead  = "read"
+	ApiKeyScopeWrite = "write"
+)
+
+// ApiKey is a personal access key. Only a hash of the key is stored; Prefix
+// is the visible, non secret part used to look the key up and to let users
+// recognise it.
+type ApiKey struct {
+	Id         string   `gorm:"primaryKey;size:36"`
+	TenantId   string   `gorm:"size:63;not null;default:default;index"`
+	Name       string   `gorm:"size:100;not null"`
+	Prefix     string   `gorm:"size:16;not null;uniqueIndex"`
+	KeyHash    string   `gorm:"size:64;not null"`
+	Scopes     []string `gorm:"serializer:json;not null"`
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIp string `gorm:"size:45"`
+	CreatedAt  time.Time
+	UserId     string `gorm:"size:36;not null;index"`
+	User       User   `gorm:"foreignKey:UserId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+func (k *ApiKey) IsActive(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
+
+func (k *ApiKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
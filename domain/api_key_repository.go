@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type ApiKeyRepository interface {
+	Create(ctx context.Context, apiKey *ApiKey) error
+	ListByUser(ctx context.Context, userId string) ([]ApiKey, error)
+	GetByPrefix(ctx context.Context, prefix string) (*ApiKey, error)
+	// Revoke revokes the key of the user, returning ErrNotFound if the user
+	// has no such active key.
+	Revoke(ctx context.Context, userId string, id string) error
+	TouchLastUsed(ctx context.Context, id string, at time.Time, ip string) error
+	// DeleteRevoked deletes the keys that were revoked or expired before the
+	// given time.
+	DeleteRevoked(ctx context.Context, before time.Time) (int64, error)
+}
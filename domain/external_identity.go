@@ -0,0 +1,40 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// ExternalIdentity links an account of an external OpenID Connect provider,
+// identified by issuer and subject, to a local user.
+type ExternalIdentity struct {
+	Id          string `gorm:"primaryKey;size:36"`
+	TenantId    string `gorm:"size:63;not null;default:default;uniqueIndex:idx_external_identities_issuer_subject,priority:1"`
+	Issuer      string `gorm:"size:255;not null;uniqueIndex:idx_external_identities_issuer_subject,priority:2"`
+	Subject     string `gorm:"size:255;not null;uniqueIndex:idx_external_identities_issuer_subject,priority:3"`
+	Email       string `gorm:"size:255"`
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+	UserId      string `gorm:"size:36;not null;index"`
+	User        User   `gorm:"foreignKey:UserId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// ExternalIdentityClaims are the verified ID token claims of a completed
+// external login.
+type ExternalIdentityClaims struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// IdentityProvider is an external OpenID Connect provider acting as the
+// authorization server of the authorization code flow with PKCE.
+type IdentityProvider interface {
+	AuthorizationURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error)
+	// Authenticate exchanges the code and verifies the returned ID token,
+	// including its nonce.
+	Authenticate(ctx context.Context, code string, codeVerifier string, nonce string) (*ExternalIdentityClaims, error)
+}
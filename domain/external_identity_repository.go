@@ -0,0 +1,12 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type ExternalIdentityRepository interface {
+	Create(ctx context.Context, identity *ExternalIdentity) error
+	GetByIssuerSubject(ctx context.Context, issuer string, subject string) (*ExternalIdentity, error)
+	TouchLastLogin(ctx context.Context, id string, at time.Time) error
+}
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyProcessing IdempotencyStatus = "processing"
+	IdempotencyCompleted  IdempotencyStatus = "completed"
+)
+
+// IdempotencyRecord remembers the outcome of a command sent with an
+// Idempotency-Key, so a retry gets the original response instead of running
+// the command again. Keys are only unique per Scope, the caller that sent
+// them.
+type IdempotencyRecord struct {
+	Key                 string            `gorm:"primaryKey;size:255"`
+	Scope               string            `gorm:"primaryKey;size:255"`
+	RequestHash         string            `gorm:"size:64;not null"`
+	Status              IdempotencyStatus `gorm:"size:16;not null"`
+	ResponseStatus      int
+	ResponseContentType string `gorm:"size:255"`
+	ResponseBody        []byte
+	CreatedAt           time.Time
+	// ExpiresAt is the end of the lease of a record still processing, and
+	// of the whole expiry once it has completed.
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+type IdempotencyStore interface {
+	// Acquire stores record unless an unexpired record with the same key and
+	// scope exists, in which case it returns false and that record.
+	Acquire(ctx context.Context, record *IdempotencyRecord) (bool, *IdempotencyRecord, error)
+	Get(ctx context.Context, key string, scope string) (*IdempotencyRecord, error)
+	// Complete stores the response of the record along with its new expiry.
+	Complete(ctx context.Context, record *IdempotencyRecord) error
+	// Release forgets a record whose request failed, so it can be retried.
+	Release(ctx context.Context, key string, scope string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
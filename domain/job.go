@@ -0,0 +1,97 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued  JobStatus = "queued"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	// JobDead is a job that failed every attempt it was given. It is kept
+	// for inspection and not run again.
+	JobDead JobStatus = "dead"
+)
+
+// Job is a unit of background work of a registered kind, with the payload
+// its handler decodes. Jobs are shared by all tenants and replicas; Tenant
+// is the tenant the job was enqueued for, restored when it runs, and is
+// deliberately not named TenantId so the tenant callbacks leave the table
+// alone.
+type Job struct {
+	Id       string    `gorm:"primaryKey;size:36"`
+	Kind     string    `gorm:"size:100;not null;index:idx_jobs_kind_status"`
+	Payload  []byte    `gorm:"not null"`
+	Status   JobStatus `gorm:"size:16;not null;index:idx_jobs_kind_status;index:idx_jobs_due,priority:1"`
+	Priority int       `gorm:"not null;default:0;index:idx_jobs_due,priority:2,sort:desc"`
+	RunAt    time.Time `gorm:"not null;index:idx_jobs_due,priority:3"`
+	// UniqueKey keeps a second job with the same key from being enqueued
+	// while the first is queued or running.
+	UniqueKey   *string `gorm:"size:255;uniqueIndex:idx_jobs_unique_key,where:status IN ('queued'\\,'running')"`
+	Tenant      string  `gorm:"size:63"`
+	TraceParent string  `gorm:"size:64"`
+	Attempts    int     `gorm:"not null;default:0"`
+	MaxAttempts int     `gorm:"not null"`
+	LockedBy    string  `gorm:"size:128"`
+	LockedUntil *time.Time
+	LastError   string `gorm:"size:2048"`
+	CreatedAt   time.Time
+	FinishedAt  *time.Time
+}
+
+// JobOptions tune a single job. Zero values fall back to the defaults of
+// the queue and the job's kind.
+type JobOptions struct {
+	// Priority orders due jobs, higher first.
+	Priority int
+	// RunAt delays the job until the given time.
+	RunAt       time.Time
+	MaxAttempts int
+	UniqueKey   string
+}
+
+// JobQueue runs work in the background, on any replica. The kind of a job
+// is derived from the type of its payload, which is registered with the
+// handler that runs it.
+type JobQueue interface {
+	// Enqueue adds a job unless its unique key is taken by a job that is
+	// queued or running, which is not an error.
+	Enqueue(ctx context.Context, payload any, options JobOptions) error
+}
+
+// JobStats counts the jobs of one kind in one status. Oldest is the run
+// time of the longest waiting of them.
+type JobStats struct {
+	Kind   string
+	Status JobStatus
+	Count  int
+	Oldest time.Time
+}
+
+type JobRepository interface {
+	// Enqueue stores the job, returning false when its unique key is taken.
+	Enqueue(ctx context.Context, job *Job) (bool, error)
+	// Claim locks up to limit jobs of the given kinds for worker until
+	// lockedUntil and counts an attempt for each. Due jobs are claimed
+	// highest priority first, along with running jobs whose lock expired;
+	// jobs other workers are claiming are skipped rather than waited for.
+	Claim(ctx context.Context, kinds []string, worker string, limit int, now time.Time, lockedUntil time.Time) ([]Job, error)
+	// Extend keeps the lock of a running job, failing with ErrNotFound once
+	// another worker has taken it over.
+	Extend(ctx context.Context, id string, worker string, lockedUntil time.Time) error
+	Complete(ctx context.Context, id string, worker string) error
+	// Retry queues a failed job to run again at runAt.
+	Retry(ctx context.Context, id string, worker string, runAt time.Time, lastError string) error
+	Bury(ctx context.Context, id string, worker string, lastError string) error
+	// Release queues a job that was interrupted again without counting the
+	// attempt.
+	Release(ctx context.Context, id string, worker string) error
+	// DeleteFinished deletes the jobs, done or dead, that finished before
+	// the given time.
+	DeleteFinished(ctx context.Context, before time.Time) (int64, error)
+	// Stats counts the jobs that are not done.
+	Stats(ctx context.Context) ([]JobStats, error)
+}
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for a key such as an email
+// address or a client IP.
+type LoginAttempt struct {
+	Key           string    `gorm:"primaryKey;size:320"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null"`
+	LockedUntil   *time.Time
+}
+
+func (a *LoginAttempt) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type LoginAttemptStore interface {
+	// Get returns the attempt for key, or a zero attempt if there is none.
+	Get(ctx context.Context, key string) (*LoginAttempt, error)
+	// RegisterFailure increments the failure counter of key, restarting it
+	// when the previous failure is older than window.
+	RegisterFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*LoginAttempt, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+	// DeleteStale deletes the attempts that are not locked and whose last
+	// failure is older than window, which would restart their counter.
+	DeleteStale(ctx context.Context, now time.Time, window time.Duration) (int64, error)
+}
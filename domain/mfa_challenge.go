@@ -0,0 +1,22 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// UsedMfaChallenge records an MFA challenge that completed a login, so its
+// token cannot complete another one before it expires.
+type UsedMfaChallenge struct {
+	Id        string    `gorm:"primaryKey;size:36"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+type UsedMfaChallengeRepository interface {
+	// Use records the challenge as used. It returns ErrAlreadyExists when it
+	// was used before.
+	Use(ctx context.Context, id string, expiresAt time.Time) error
+	// DeleteExpired deletes the challenges whose tokens expired, which can
+	// no longer be replayed anyway.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "context"
+
+const (
+	TemplateEmailVerification = "email_verification"
+)
+
+// Notification is a message addressed to a single recipient. Template names
+// a message template and Data holds the values it is rendered with.
+type Notification struct {
+	To       string
+	Template string
+	Locale   string
+	Data     map[string]any
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// OAuthClient is a registered service account allowed to obtain tokens via
+// the client_credentials grant. Its tokens act in its tenant only.
+type OAuthClient struct {
+	Id         string   `gorm:"primaryKey;size:36"`
+	TenantId   string   `gorm:"size:63;not null;default:default;index"`
+	ClientId   string   `gorm:"size:64;not null;uniqueIndex"`
+	Name       string   `gorm:"size:100;not null"`
+	SecretHash string   `gorm:"size:64;not null"`
+	Scopes     []string `gorm:"serializer:json;not null"`
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+}
+
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *OAuthClient) error
+	List(ctx context.Context) ([]OAuthClient, error)
+	GetByClientId(ctx context.Context, clientId string) (*OAuthClient, error)
+	// Revoke returns ErrNotFound if there is no active client with clientId.
+	Revoke(ctx context.Context, clientId string) error
+	// DeleteRevoked deletes the clients revoked before the given time.
+	DeleteRevoked(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// OidcLoginState holds the secrets of an authorization request between the
+// redirect to the provider and the callback.
+type OidcLoginState struct {
+	State        string    `gorm:"primaryKey;size:64"`
+	TenantId     string    `gorm:"size:63;not null;default:default"`
+	Provider     string    `gorm:"size:64;not null"`
+	Nonce        string    `gorm:"size:64;not null"`
+	CodeVerifier string    `gorm:"size:128;not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
+
+type OidcLoginStateRepository interface {
+	Create(ctx context.Context, state *OidcLoginState) error
+	// Consume deletes and returns the state, so it can be used only once.
+	// It returns ErrNotFound for unknown or already used states.
+	Consume(ctx context.Context, state string) (*OidcLoginState, error)
+	// DeleteExpired deletes the states of abandoned logins.
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
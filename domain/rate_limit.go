@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// RateLimitPolicy allows Limit requests per Window, refilled continuously
+// as a token bucket, so a client may burst up to Limit and then continues at
+// the average rate.
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+}
+
+func (p RateLimitPolicy) ratePerSecond() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+// RateLimitBucket is the token bucket of a single key.
+type RateLimitBucket struct {
+	Key    string  `gorm:"primaryKey;size:255"`
+	Tokens float64 `gorm:"not null"`
+	// Allowed is the outcome of the last take.
+	Allowed    bool      `gorm:"not null"`
+	RefilledAt time.Time `gorm:"not null;index"`
+}
+
+// Take refills the bucket for the time passed since the last take and
+// removes one token if there is one.
+func (b *RateLimitBucket) Take(policy RateLimitPolicy, now time.Time) {
+	if b.RefilledAt.IsZero() {
+		b.Tokens = float64(policy.Limit)
+	} else {
+		b.Tokens = math.Min(float64(policy.Limit), b.Tokens+now.Sub(b.RefilledAt).Seconds()*policy.ratePerSecond())
+	}
+	b.RefilledAt = now
+
+	b.Allowed = b.Tokens >= 1
+	if b.Allowed {
+		b.Tokens--
+	}
+}
+
+// IsStale reports whether the bucket is full again, in which case dropping
+// it makes no difference.
+func (b *RateLimitBucket) IsStale(window time.Duration, now time.Time) bool {
+	return now.Sub(b.RefilledAt) >= window
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when
+	// this one was.
+	RetryAfter time.Duration
+}
+
+func (b *RateLimitBucket) Result(policy RateLimitPolicy) RateLimitResult {
+	rate := policy.ratePerSecond()
+	result := RateLimitResult{
+		Allowed:    b.Allowed,
+		Limit:      policy.Limit,
+		Remaining:  int(math.Floor(b.Tokens)),
+		ResetAfter: time.Duration((float64(policy.Limit) - b.Tokens) / rate * float64(time.Second)),
+	}
+	if !b.Allowed {
+		result.RetryAfter = time.Duration((1 - b.Tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+type RateLimitStore interface {
+	// Take counts a request against the bucket of key.
+	Take(ctx context.Context, key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error)
+	// DeleteStale deletes the buckets that are stale for window.
+	DeleteStale(ctx context.Context, now time.Time, window time.Duration) (int64, error)
+}
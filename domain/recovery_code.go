@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+type RecoveryCode struct {
+	Id       string `gorm:"primaryKey;size:36"`
+	TenantId string `gorm:"size:63;not null;default:default;index"`
+	CodeHash string `gorm:"size:64;not null;index"`
+	UsedAt   *time.Time
+	UserId   string `gorm:"size:36;not null;index"`
+	User     User   `gorm:"foreignKey:UserId;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
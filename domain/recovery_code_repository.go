@@ -0,0 +1,12 @@
+package domain
+
+import "context"
+
+type RecoveryCodeRepository interface {
+	// Replace deletes every recovery code of the user and stores codes.
+	Replace(ctx context.Context, userId string, codes []RecoveryCode) error
+	// Consume marks the unused code with the given hash as used, returning
+	// ErrNotFound if there is none.
+	Consume(ctx context.Context, userId string, codeHash string) error
+	DeleteByUser(ctx context.Context, userId string) error
+}
@@ -1,7 +1,14 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type RefreshTokenRepository interface {
 	Create(ctx context.Context, refreshToken *RefreshToken) error
+	RevokeByUser(ctx context.Context, userId string) error
+	// DeleteStale deletes the tokens that were used or revoked and those
+	// that expired before the given time.
+	DeleteStale(ctx context.Context, expiredBefore time.Time) (int64, error)
 }
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	SecurityEventAccountLocked = "account_locked"
+	SecurityEventClientLocked  = "client_locked"
+)
+
+type SecurityEvent struct {
+	Type       string
+	Key        string
+	ClientIP   string
+	Failures   int
+	Until      time.Time
+	OccurredAt time.Time
+}
+
+// SecurityEventPublisher forwards security relevant events to logging and
+// alerting. Publishing must not fail the operation that raised the event.
+type SecurityEventPublisher interface {
+	Publish(ctx context.Context, event SecurityEvent)
+}
@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type TaskRunStatus string
+
+const (
+	TaskRunning   TaskRunStatus = "running"
+	TaskSucceeded TaskRunStatus = "succeeded"
+	TaskFailed    TaskRunStatus = "failed"
+)
+
+// TaskRun is one run of a scheduled task. A task runs at most once per
+// scheduled time, on whichever replica leads the scheduler then.
+type TaskRun struct {
+	Id          string        `gorm:"primaryKey;size:36"`
+	Task        string        `gorm:"size:100;not null;uniqueIndex:idx_task_runs_task_scheduled_at,priority:1"`
+	ScheduledAt time.Time     `gorm:"not null;uniqueIndex:idx_task_runs_task_scheduled_at,priority:2"`
+	Status      TaskRunStatus `gorm:"size:16;not null"`
+	Instance    string        `gorm:"size:128;not null"`
+	// Affected is how many rows the task deleted or changed.
+	Affected   int64
+	Error      string `gorm:"size:2048"`
+	StartedAt  time.Time
+	FinishedAt *time.Time
+}
+
+type TaskRunRepository interface {
+	// Start records the run, returning false when the task already ran for
+	// the same scheduled time.
+	Start(ctx context.Context, run *TaskRun) (bool, error)
+	Finish(ctx context.Context, run *TaskRun) error
+	// DeleteStarted deletes the runs that started before the given time,
+	// including those a replica that died left running.
+	DeleteStarted(ctx context.Context, before time.Time) (int64, error)
+}
+
+// LeaderLock is held by at most one replica at a time.
+type LeaderLock interface {
+	// TryAcquire takes the lock if no other replica holds it, reporting
+	// whether this one does now.
+	TryAcquire(ctx context.Context) (bool, error)
+	// Check fails once the lock was lost, as when the connection holding it
+	// broke.
+	Check(ctx context.Context) error
+	Release(ctx context.Context) error
+}
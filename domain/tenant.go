@@ -0,0 +1,20 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// Tenant is a customer organisation. Its id doubles as the subdomain and
+// header value requests are resolved to it by.
+type Tenant struct {
+	Id        string `gorm:"primaryKey;size:63"`
+	Name      string `gorm:"size:100;not null"`
+	CreatedAt time.Time
+}
+
+type TenantRepository interface {
+	Create(ctx context.Context, tenant *Tenant) error
+	Get(ctx context.Context, id string) (*Tenant, error)
+	List(ctx context.Context) ([]Tenant, error)
+}
@@ -1,10 +1,23 @@
 package domain
 
+import "time"
+
 type User struct {
-	Id            string         `json:"-" gorm:"primaryKey;size:36"`
-	FirstName     string         `json:"firstName" gorm:"size:100;not null"`
-	LastName      string         `json:"lastName" gorm:"size:100;not null"`
-	Email         string         `json:"email" gorm:"uniqueIndex;size:255;not null"`
-	Password      string         `json:"-" gorm:"size:255;not null"`
-	RefreshTokens []RefreshToken `json:"-" gorm:"foreignKey:UserId"`
+	Id                 string `gorm:"primaryKey;size:36"`
+	TenantId           string `gorm:"size:63;not null;default:default;uniqueIndex:idx_users_tenant_email,priority:1"`
+	FirstName          string `gorm:"size:100;not null"`
+	LastName           string `gorm:"size:100;not null"`
+	Email              string `gorm:"uniqueIndex:idx_users_tenant_email,priority:2;size:255;not null"`
+	Password           string `gorm:"size:255;not null"`
+	Locale             string `gorm:"size:35;not null;default:en"`
+	EmailVerified      bool   `gorm:"not null;default:false"`
+	EmailVerifiedAt    *time.Time
+	VerificationSentAt *time.Time
+	MfaEnabled         bool           `gorm:"not null;default:false"`
+	TotpSecret         string         `gorm:"size:255"`
+	TotpLastCounter    int64          `gorm:"not null;default:0"`
+	CreatedBy          string         `gorm:"size:64"`
+	UpdatedBy          string         `gorm:"size:64"`
+	RefreshTokens      []RefreshToken `gorm:"foreignKey:UserId"`
+	RecoveryCodes      []RecoveryCode `gorm:"foreignKey:UserId"`
 }
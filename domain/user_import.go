@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type UserImportStatus string
+
+const (
+	UserImportPending   UserImportStatus = "pending"
+	UserImportRunning   UserImportStatus = "running"
+	UserImportCompleted UserImportStatus = "completed"
+	UserImportFailed    UserImportStatus = "failed"
+)
+
+type UserImportOutcome string
+
+const (
+	UserImportCreated   UserImportOutcome = "created"
+	UserImportDuplicate UserImportOutcome = "duplicate"
+	UserImportInvalid   UserImportOutcome = "invalid"
+)
+
+// UserImport is a bulk import of users from an uploaded CSV or NDJSON file,
+// run in the background. Data holds the upload until the import has
+// finished; it is dropped then, as it contains plain text passwords.
+type UserImport struct {
+	Id         string           `gorm:"primaryKey;size:36"`
+	TenantId   string           `gorm:"size:63;not null;default:default;index"`
+	Format     string           `gorm:"size:16;not null"`
+	Status     UserImportStatus `gorm:"size:16;not null"`
+	Data       []byte
+	Total      int `gorm:"not null;default:0"`
+	Processed  int `gorm:"not null;default:0"`
+	Created    int `gorm:"not null;default:0"`
+	Duplicates int `gorm:"not null;default:0"`
+	Invalid    int `gorm:"not null;default:0"`
+	// Rows reports the outcome of each processed row, in upload order.
+	Rows       []UserImportRow `gorm:"serializer:json"`
+	Error      string          `gorm:"size:1024"`
+	CreatedBy  string          `gorm:"size:64"`
+	UpdatedBy  string          `gorm:"size:64"`
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// UserImportRow is the outcome of one row of an import. Line is the line of
+// the upload the row starts on.
+type UserImportRow struct {
+	Line    int
+	Email   string
+	Outcome UserImportOutcome
+	// Reasons tell why an invalid row was rejected.
+	Reasons []UserImportReason
+}
+
+type UserImportReason struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+func (i *UserImport) IsFinished() bool {
+	return i.Status == UserImportCompleted || i.Status == UserImportFailed
+}
+
+type UserImportRepository interface {
+	Create(ctx context.Context, userImport *UserImport) error
+	Get(ctx context.Context, id string) (*UserImport, error)
+	// Update saves the whole import, including its rows and data.
+	Update(ctx context.Context, userImport *UserImport) error
+	// UpdateProgress saves the status, counters and committed rows of the
+	// import, leaving its data alone. The saved rows are where a run that
+	// did not get to save the whole import resumes.
+	UpdateProgress(ctx context.Context, userImport *UserImport) error
+	// DeleteFinished deletes the imports that finished before the given
+	// time, along with their reports.
+	DeleteFinished(ctx context.Context, before time.Time) (int64, error)
+	// DeleteUnfinished deletes the imports created before the given time
+	// that never finished, along with the data they still hold.
+	DeleteUnfinished(ctx context.Context, before time.Time) (int64, error)
+}
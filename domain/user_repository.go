@@ -4,7 +4,30 @@ import "context"
 
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
+	Update(ctx context.Context, user *User) error
+	// AdvanceTotpCounter records counter as the last TOTP time step the
+	// user signed in with. It returns false when that or a later step was
+	// recorded already, so each code is accepted once even when requests
+	// race.
+	AdvanceTotpCounter(ctx context.Context, id string, counter int64) (bool, error)
 	Get(ctx context.Context, id string) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	List(ctx context.Context) ([]User, error)
+	// Stream calls fn with each user matching filter, ordered by id, without
+	// holding more than a batch of them in memory. It stops at the first
+	// error fn returns.
+	Stream(ctx context.Context, filter UserFilter, fn func(*User) error) error
+	// CreateMissing inserts the batches of users in one transaction, one
+	// statement per batch, skipping users whose email is taken. It returns
+	// the ids of the users it inserted.
+	CreateMissing(ctx context.Context, batches [][]*User) ([]string, error)
+}
+
+// UserFilter narrows down users. Zero fields match every user.
+type UserFilter struct {
+	// Email matches users whose email contains it, ignoring case.
+	Email         string
+	Locale        string
+	EmailVerified *bool
+	MfaEnabled    *bool
 }
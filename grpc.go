@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/app/apikey"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	authv1 "github.com/knetic0/production-ready-go-cqrs/proto/auth/v1"
+	userv1 "github.com/knetic0/production-ready-go-cqrs/proto/user/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+const grpcApiKeyMetadata = "x-api-key"
+
+var grpcRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "grpc_request_duration_seconds",
+	Help:    "Duration of gRPC requests in seconds",
+	Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}, []string{"method", "code"})
+
+func init() {
+	prometheus.MustRegister(grpcRequestDuration)
+}
+
+// grpcPublicMethods are reachable without credentials, like the routes
+// registered in front of AuthenticationMiddleware.
+var grpcPublicMethods = map[string]bool{
+	authv1.AuthService_Login_FullMethodName:              true,
+	authv1.AuthService_VerifyMfa_FullMethodName:          true,
+	authv1.AuthService_VerifyEmail_FullMethodName:        true,
+	authv1.AuthService_ResendVerification_FullMethodName: true,
+}
+
+// grpcReadMethods only need the read scope of an API key, like GET routes.
+var grpcReadMethods = map[string]bool{
+	userv1.UserService_GetUser_FullMethodName:   true,
+	userv1.UserService_ListUsers_FullMethodName: true,
+	userv1.UserService_GetMe_FullMethodName:     true,
+}
+
+// grpcInteractiveMethods manage credentials and need a user's access token,
+// like the routes behind InteractiveMiddleware.
+var grpcInteractiveMethods = map[string]bool{
+	userv1.UserService_ChangePassword_FullMethodName: true,
+}
+
+// grpcServiceScopes are the methods service accounts may call and the scope
+// each needs, like the routes registered with forServices.
+var grpcServiceScopes = map[string]string{
+	userv1.UserService_CreateUser_FullMethodName: pkgauth.ScopeUsersWrite,
+	userv1.UserService_GetUser_FullMethodName:    pkgauth.ScopeUsersRead,
+	userv1.UserService_ListUsers_FullMethodName:  pkgauth.ScopeUsersRead,
+}
+
+var errMissingCredentials = apperror.New(apperror.CodeUnauthorized, "missing credentials")
+
+// newGRPCServer serves the user and auth services with the handler
+// instances of the HTTP API. The interceptors mirror its middleware, outer
+// to inner: metrics, error mapping, client IP, tenant and authentication.
+// Tracing hooks in as a stats handler.
+func newGRPCServer(applicationConfig *config.ApplicationConfig, h *handlers, tenants domain.TenantRepository) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			MetricsInterceptor(),
+			ErrorInterceptor(),
+			ClientIPInterceptor(),
+			TenantInterceptor(applicationConfig.Tenancy, tenants),
+			AuthenticationInterceptor(applicationConfig.Security, h.apiKeyAuthenticator),
+		),
+	)
+
+	userv1.RegisterUserServiceServer(server, &userService{handlers: h})
+	authv1.RegisterAuthServiceServer(server, &authService{handlers: h})
+	if applicationConfig.Grpc.Reflection {
+		reflection.Register(server)
+	}
+	return server
+}
+
+// serveGRPC listens on port and serves in the background. Errors once
+// serving are reported to fail; those of listening are returned.
+func serveGRPC(server *grpc.Server, port string, fail func(err error)) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", port))
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := server.Serve(listener); err != nil {
+			fail(err)
+		}
+	}()
+	return nil
+}
+
+// stopGRPC lets in-flight calls finish, cancelling them once ctx is done.
+func stopGRPC(server *grpc.Server) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			return nil
+		case <-ctx.Done():
+			server.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// dispatch is the gRPC counterpart of handle: the service has already
+// translated the message into the handler's request, which is validated
+// with the same rules before the handler runs.
+func dispatch[TReq Request, TRes Response](ctx context.Context, handler HandlerInterface[TReq, TRes], request *TReq) (*TRes, error) {
+	if err := validate.Struct(request); err != nil {
+		return nil, validationError(err)
+	}
+	return handler.Handle(ctx, request)
+}
+
+func MetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+		grpcRequestDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return res, err
+	}
+}
+
+// ErrorInterceptor turns handler errors into statuses with the codes
+// errorStatus picks for HTTP, and field errors into BadRequest details.
+func ErrorInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		res, err := handler(ctx, req)
+		if err == nil {
+			return res, nil
+		}
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+
+		httpStatus := errorStatus(err)
+		if httpStatus == fiber.StatusInternalServerError {
+			fields := []zap.Field{zap.String("method", info.FullMethod), zap.Error(err)}
+			if principal, ok := pkgauth.FromContext(ctx); ok {
+				fields = append(fields, principal.LogFields()...)
+			}
+			zap.L().Error("request failed", fields...)
+		}
+
+		st := status.New(grpcCode(httpStatus), err.Error())
+		if fieldErrors := apperror.FieldsOf(err); len(fieldErrors) > 0 {
+			violations := make([]*errdetails.BadRequest_FieldViolation, len(fieldErrors))
+			for i, field := range fieldErrors {
+				violations[i] = &errdetails.BadRequest_FieldViolation{Field: field.Field, Description: field.Message}
+			}
+			if detailed, detailErr := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); detailErr == nil {
+				st = detailed
+			}
+		}
+		return nil, st.Err()
+	}
+}
+
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case fiber.StatusBadRequest:
+		return codes.InvalidArgument
+	case fiber.StatusUnauthorized:
+		return codes.Unauthenticated
+	case fiber.StatusForbidden:
+		return codes.PermissionDenied
+	case fiber.StatusNotFound:
+		return codes.NotFound
+	case fiber.StatusConflict:
+		return codes.AlreadyExists
+	case fiber.StatusUnprocessableEntity:
+		return codes.FailedPrecondition
+	case fiber.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Internal
+	}
+}
+
+func ClientIPInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if p, ok := peer.FromContext(ctx); ok {
+			ip := p.Addr.String()
+			if host, _, err := net.SplitHostPort(ip); err == nil {
+				ip = host
+			}
+			ctx = requestctx.WithClientIP(ctx, ip)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TenantInterceptor is the gRPC counterpart of TenantMiddleware. Calls
+// carry no host name, so only the header resolver applies, as metadata.
+func TenantInterceptor(tenancyConfig config.TenancyConfig, tenants domain.TenantRepository) grpc.UnaryServerInterceptor {
+	known := &knownTenants{repository: tenants, expiresAt: make(map[string]time.Time)}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id, source := tenancyConfig.DefaultTenant, tenant.SourceDefault
+		for _, resolver := range tenancyConfig.Resolvers {
+			if resolver != "header" {
+				continue
+			}
+			if requested := strings.TrimSpace(firstMetadata(ctx, tenancyConfig.Header)); requested != "" {
+				id, source = requested, tenant.SourceHeader
+			}
+		}
+		if id == "" {
+			return nil, tenant.ErrUnknownTenant
+		}
+
+		if err := known.check(ctx, id); err != nil {
+			return nil, err
+		}
+		return handler(tenant.WithTenant(ctx, id, source), req)
+	}
+}
+
+// AuthenticationInterceptor accepts the credentials AuthenticationMiddleware
+// does, as "authorization" or "x-api-key" metadata, on every method but the
+// public ones.
+func AuthenticationInterceptor(securityConfig config.SecurityConfig, apiKeys *apikey.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if grpcPublicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		principal, err := grpcPrincipal(ctx, securityConfig, apiKeys, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		ctx, err = scopeToPrincipal(ctx, principal.TenantId)
+		if err != nil {
+			return nil, err
+		}
+		ctx = pkgauth.WithPrincipal(ctx, principal)
+		if grpcInteractiveMethods[info.FullMethod] {
+			if err := requireInteractive(ctx); err != nil {
+				return nil, err
+			}
+		}
+		if err := requireServiceScope(ctx, grpcServiceScopes[info.FullMethod]); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func grpcPrincipal(ctx context.Context, securityConfig config.SecurityConfig, apiKeys *apikey.Authenticator, method string) (*pkgauth.Principal, error) {
+	authorization := firstMetadata(ctx, "authorization")
+	key := firstMetadata(ctx, grpcApiKeyMetadata)
+	if key == "" && len(authorization) > len(apiKeyScheme) && strings.EqualFold(authorization[:len(apiKeyScheme)], apiKeyScheme) {
+		key = strings.TrimSpace(authorization[len(apiKeyScheme):])
+	}
+
+	if key != "" {
+		httpMethod := fiber.MethodPost
+		if grpcReadMethods[method] {
+			httpMethod = fiber.MethodGet
+		}
+		apiKey, err := apiKeys.Authenticate(ctx, key, httpMethod, requestctx.ClientIP(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return apiKeyPrincipal(apiKey), nil
+	}
+
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return nil, errMissingCredentials
+	}
+	return parseBearerToken(securityConfig, token)
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/app/auth"
+	"github.com/knetic0/production-ready-go-cqrs/app/user"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	authv1 "github.com/knetic0/production-ready-go-cqrs/proto/auth/v1"
+	userv1 "github.com/knetic0/production-ready-go-cqrs/proto/user/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// userService translates between the user.v1 messages and the requests
+// and responses of the app/user handlers.
+type userService struct {
+	userv1.UnimplementedUserServiceServer
+	handlers *handlers
+}
+
+func (s *userService) CreateUser(ctx context.Context, request *userv1.CreateUserRequest) (*userv1.CreateUserResponse, error) {
+	_, err := dispatch(ctx, s.handlers.userCreate, &user.UserCreateRequest{
+		FirstName: request.GetFirstName(),
+		LastName:  request.GetLastName(),
+		Email:     request.GetEmail(),
+		Password:  request.GetPassword(),
+		Locale:    request.GetLocale(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &userv1.CreateUserResponse{}, nil
+}
+
+func (s *userService) GetUser(ctx context.Context, request *userv1.GetUserRequest) (*userv1.GetUserResponse, error) {
+	res, err := dispatch(ctx, s.handlers.userGet, &user.UserGetRequest{Id: request.GetId()})
+	if err != nil {
+		return nil, err
+	}
+	return &userv1.GetUserResponse{User: userMessage(res.User)}, nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, request *userv1.ListUsersRequest) (*userv1.ListUsersResponse, error) {
+	res, err := dispatch(ctx, s.handlers.userList, &user.UserListRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]*userv1.User, len(res.Users))
+	for i := range res.Users {
+		users[i] = userMessage(&res.Users[i])
+	}
+	return &userv1.ListUsersResponse{Users: users}, nil
+}
+
+func (s *userService) GetMe(ctx context.Context, request *userv1.GetMeRequest) (*userv1.GetMeResponse, error) {
+	res, err := dispatch(ctx, s.handlers.me, &user.MeRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return &userv1.GetMeResponse{User: userMessage(res.User)}, nil
+}
+
+func (s *userService) ChangePassword(ctx context.Context, request *userv1.ChangePasswordRequest) (*userv1.ChangePasswordResponse, error) {
+	_, err := dispatch(ctx, s.handlers.changePassword, &user.ChangePasswordRequest{
+		CurrentPassword: request.GetCurrentPassword(),
+		NewPassword:     request.GetNewPassword(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &userv1.ChangePasswordResponse{}, nil
+}
+
+func userMessage(u *domain.User) *userv1.User {
+	if u == nil {
+		return nil
+	}
+
+	message := &userv1.User{
+		Id:            u.Id,
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+		Email:         u.Email,
+		Locale:        u.Locale,
+		EmailVerified: u.EmailVerified,
+		MfaEnabled:    u.MfaEnabled,
+	}
+	if u.EmailVerifiedAt != nil {
+		message.EmailVerifiedAt = timestamppb.New(*u.EmailVerifiedAt)
+	}
+	return message
+}
+
+// authService translates between the auth.v1 messages and the requests and
+// responses of the app/auth handlers.
+type authService struct {
+	authv1.UnimplementedAuthServiceServer
+	handlers *handlers
+}
+
+func (s *authService) Login(ctx context.Context, request *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+	res, err := dispatch(ctx, s.handlers.login, &auth.LoginRequest{
+		Email:    request.GetEmail(),
+		Password: request.GetPassword(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loginMessage(res), nil
+}
+
+func (s *authService) VerifyMfa(ctx context.Context, request *authv1.VerifyMfaRequest) (*authv1.LoginResponse, error) {
+	res, err := dispatch(ctx, s.handlers.mfaVerify, &auth.MfaVerifyRequest{
+		MfaToken:     request.GetMfaToken(),
+		Code:         request.GetCode(),
+		RecoveryCode: request.GetRecoveryCode(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loginMessage(res), nil
+}
+
+func (s *authService) VerifyEmail(ctx context.Context, request *authv1.VerifyEmailRequest) (*authv1.VerifyEmailResponse, error) {
+	res, err := dispatch(ctx, s.handlers.verifyEmail, &auth.VerifyEmailRequest{Token: request.GetToken()})
+	if err != nil {
+		return nil, err
+	}
+	return &authv1.VerifyEmailResponse{Verified: res.Verified}, nil
+}
+
+func (s *authService) ResendVerification(ctx context.Context, request *authv1.ResendVerificationRequest) (*authv1.ResendVerificationResponse, error) {
+	_, err := dispatch(ctx, s.handlers.resendVerification, &auth.ResendVerificationRequest{Email: request.GetEmail()})
+	if err != nil {
+		return nil, err
+	}
+	return &authv1.ResendVerificationResponse{}, nil
+}
+
+func loginMessage(res *auth.LoginResponse) *authv1.LoginResponse {
+	return &authv1.LoginResponse{
+		Token:        res.Token,
+		RefreshToken: res.RefreshToken,
+		MfaRequired:  res.MfaRequired,
+		MfaToken:     res.MfaToken,
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure/jobs"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/health"
+	"gorm.io/gorm"
+)
+
+// readiness is the body of the readiness probe. It is public, so it tells
+// the status of each check only; why a check failed is logged instead.
+type readiness struct {
+	Status health.Status            `json:"status"`
+	Reason string                   `json:"reason,omitempty"`
+	Checks map[string]health.Status `json:"checks,omitempty"`
+}
+
+// registerHealth serves the probes. They are registered ahead of the API,
+// so they need neither a tenant nor a token, and are not rate limited.
+func registerHealth(app *fiber.App, registry *health.Registry) {
+	app.Get("/health/live", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(registry.Live())
+	})
+	app.Get("/health/ready", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		report := registry.Ready(c.UserContext())
+		if report.Status == health.StatusDown {
+			c.Status(fiber.StatusServiceUnavailable)
+		}
+		body := readiness{Status: report.Status, Reason: report.Reason}
+		if len(report.Checks) > 0 {
+			body.Checks = make(map[string]health.Status, len(report.Checks))
+			for name, result := range report.Checks {
+				body.Checks[name] = result.Status
+			}
+		}
+		return c.JSON(body)
+	})
+}
+
+// initHealth registers the checks readiness depends on. Without Postgres
+// and its schema no request can be served; traces that cannot be exported
+// and jobs that wait too long degrade the service without taking it down.
+func initHealth(applicationConfig *config.ApplicationConfig, db *gorm.DB, queue *jobs.Queue) *health.Registry {
+	healthConfig := applicationConfig.Health
+	if healthConfig.MillisecondsOfTimeout < 1 {
+		log.Fatalf("health checks need a timeout")
+	}
+	registry := health.NewRegistry(health.Config{
+		CacheTTL: time.Duration(healthConfig.MillisecondsOfCache) * time.Millisecond,
+		Timeout:  time.Duration(healthConfig.MillisecondsOfTimeout) * time.Millisecond,
+	})
+
+	registry.Register("postgres", true, infrastructure.NewPostgresHealthChecker(db))
+	registry.Register("migrations", true, infrastructure.NewMigrationHealthChecker(db))
+	if endpoint := applicationConfig.OtelTraceEndpoint; endpoint != "" {
+		registry.Register("otlp", false, health.CheckerFunc(func(ctx context.Context) error {
+			return dial(ctx, endpoint)
+		}))
+	}
+	if healthConfig.SecondsOfMaxQueueLag > 0 {
+		maxLag := time.Duration(healthConfig.SecondsOfMaxQueueLag) * time.Second
+		registry.Register("jobQueue", false, health.CheckerFunc(func(ctx context.Context) error {
+			lag, err := queue.Lag(ctx)
+			if err != nil {
+				return err
+			}
+			if lag > maxLag {
+				return fmt.Errorf("the oldest due job has waited %s, longer than %s", lag.Round(time.Second), maxLag)
+			}
+			return nil
+		}))
+	}
+	return registry
+}
+
+// dial checks that the OTLP collector accepts connections. The exporter
+// talks HTTP to it, on port 4318 unless the endpoint names another.
+func dial(ctx context.Context, endpoint string) error {
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(endpoint, "4318")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/health"
+)
+
+func TestReadinessHidesCheckErrors(t *testing.T) {
+	const detail = "dial tcp 10.0.4.12:5432: password authentication failed for user \"app\""
+	registry := health.NewRegistry(health.Config{Timeout: time.Second})
+	registry.Register("postgres", true, health.CheckerFunc(func(ctx context.Context) error {
+		return errors.New(detail)
+	}))
+	registry.Register("otlp", false, health.CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}))
+	app := fiber.New()
+	registerHealth(app, registry)
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/health/ready", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusServiceUnavailable)
+	}
+	if strings.Contains(string(body), "10.0.4.12") || strings.Contains(string(body), "password") {
+		t.Fatalf("body tells the check error: %s", body)
+	}
+
+	var got readiness
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]health.Status{"postgres": health.StatusDown, "otlp": health.StatusUp}
+	if got.Status != health.StatusDown || !maps.Equal(got.Checks, want) {
+		t.Fatalf("body = %s, want DOWN with checks %v", body, want)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencyPollInterval  = 100 * time.Millisecond
+)
+
+var (
+	errInvalidIdempotencyKey  = apperror.New(apperror.CodeInvalidArgument, "Idempotency-Key must be at most 255 characters")
+	errIdempotencyKeyReused   = apperror.New(apperror.CodeUnprocessable, "Idempotency-Key was already used for a different request")
+	errIdempotencyKeyInFlight = apperror.New(apperror.CodeConflict, "a request with this Idempotency-Key is still being processed")
+)
+
+// IdempotencyMiddleware makes commands sent with an Idempotency-Key safe to
+// retry: the first request runs and its response is stored, later requests
+// with the same key get that response replayed. Keys belong to the
+// authenticated caller, so it runs after authentication and leaves anonymous
+// requests alone. Server errors and rate limited requests are not stored,
+// the command has not run and may be retried. While the first request runs
+// its key is only leased, for the request timeout and the wait of a
+// duplicate, so a replica that dies mid-request does not block retries until
+// the key expires.
+func IdempotencyMiddleware(idempotencyConfig config.IdempotencyConfig, store domain.IdempotencyStore) fiber.Handler {
+	if !idempotencyConfig.Enabled {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+
+	expiry := time.Duration(idempotencyConfig.HoursOfExpiry) * time.Hour
+	wait := time.Duration(idempotencyConfig.SecondsOfWait) * time.Second
+	lease := wait + time.Duration(idempotencyConfig.SecondsOfRequestTimeout)*time.Second
+
+	return func(c *fiber.Ctx) error {
+		key := c.Get(idempotencyKeyHeader)
+		if key == "" || !isCommand(c.Method()) {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return c.Status(errorStatus(errInvalidIdempotencyKey)).JSON(errorBody(errInvalidIdempotencyKey))
+		}
+
+		ctx := c.UserContext()
+		principal, ok := pkgauth.FromContext(ctx)
+		if !ok {
+			return c.Next()
+		}
+
+		now := time.Now()
+		record := &domain.IdempotencyRecord{
+			Key:         key,
+			Scope:       idempotencyScope(ctx, principal),
+			RequestHash: requestHash(c),
+			Status:      domain.IdempotencyProcessing,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(lease),
+		}
+
+		acquired, existing, err := store.Acquire(ctx, record)
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(errorBody(err))
+		}
+		if !acquired {
+			return replay(c, store, existing, record.RequestHash, wait)
+		}
+
+		if err := c.Next(); err != nil {
+			release(ctx, store, record)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError || status == fiber.StatusTooManyRequests {
+			release(ctx, store, record)
+			return nil
+		}
+
+		record.Status = domain.IdempotencyCompleted
+		record.ResponseStatus = status
+		record.ResponseContentType = string(c.Response().Header.ContentType())
+		record.ResponseBody = append([]byte(nil), c.Response().Body()...)
+		record.ExpiresAt = time.Now().Add(expiry)
+		if err := store.Complete(ctx, record); err != nil {
+			zap.L().Error("failed to store idempotent response", zap.String("key", key), zap.Error(err))
+		}
+		return nil
+	}
+}
+
+// replay answers a duplicate with the stored response, waiting for it while
+// the original request is still running.
+func replay(c *fiber.Ctx, store domain.IdempotencyStore, record *domain.IdempotencyRecord, hash string, wait time.Duration) error {
+	if record.RequestHash != hash {
+		return c.Status(errorStatus(errIdempotencyKeyReused)).JSON(errorBody(errIdempotencyKeyReused))
+	}
+
+	ctx := c.UserContext()
+	deadline := time.Now().Add(wait)
+	for record.Status != domain.IdempotencyCompleted {
+		if time.Now().After(deadline) {
+			return c.Status(errorStatus(errIdempotencyKeyInFlight)).JSON(errorBody(errIdempotencyKeyInFlight))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(idempotencyPollInterval):
+		}
+
+		var err error
+		record, err = store.Get(ctx, record.Key, record.Scope)
+		// The original request failed and released the key; the client
+		// may retry it.
+		if errors.Is(err, domain.ErrNotFound) {
+			return c.Status(errorStatus(errIdempotencyKeyInFlight)).JSON(errorBody(errIdempotencyKeyInFlight))
+		}
+		if err != nil {
+			return c.Status(errorStatus(err)).JSON(errorBody(err))
+		}
+	}
+
+	c.Set(idempotentReplayedHeader, "true")
+	if record.ResponseContentType != "" {
+		c.Set(fiber.HeaderContentType, record.ResponseContentType)
+	}
+	return c.Status(record.ResponseStatus).Send(record.ResponseBody)
+}
+
+func release(ctx context.Context, store domain.IdempotencyStore, record *domain.IdempotencyRecord) {
+	if err := store.Release(ctx, record.Key, record.Scope); err != nil {
+		zap.L().Error("failed to release idempotency key", zap.String("key", record.Key), zap.Error(err))
+	}
+}
+
+func idempotencyScope(ctx context.Context, principal *pkgauth.Principal) string {
+	id, _ := tenant.FromContext(ctx)
+	return id + "/" + string(principal.Kind) + ":" + principal.Subject
+}
+
+// requestHash identifies the request a key was first used with, so reusing
+// the key for a different payload is detected.
+func requestHash(c *fiber.Ctx) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Method()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.OriginalURL()))
+	hash.Write([]byte{0})
+	hash.Write(c.Body())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func isCommand(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
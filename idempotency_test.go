@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+)
+
+func TestIdempotencyLeasesKeysWhileProcessing(t *testing.T) {
+	const scope = "/user:user-1"
+	idempotencyConfig := config.IdempotencyConfig{Enabled: true, HoursOfExpiry: 24, SecondsOfWait: 1, SecondsOfRequestTimeout: 2}
+	lease := 3 * time.Second
+
+	store := infrastructure.NewIdempotencyMemoryStore()
+	// A replica died while processing the key; its lease has passed.
+	now := time.Now()
+	if _, _, err := store.Acquire(context.Background(), &domain.IdempotencyRecord{
+		Key:         "key-1",
+		Scope:       scope,
+		RequestHash: "request-of-the-dead-replica",
+		Status:      domain.IdempotencyProcessing,
+		CreatedAt:   now.Add(-time.Minute),
+		ExpiresAt:   now.Add(-time.Second),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(pkgauth.WithPrincipal(c.UserContext(), &pkgauth.Principal{Kind: pkgauth.KindUser, Subject: "user-1"}))
+		return c.Next()
+	})
+	runs := 0
+	app.Post("/users", IdempotencyMiddleware(idempotencyConfig, store), func(c *fiber.Ctx) error {
+		runs++
+		record, err := store.Get(c.UserContext(), "key-1", scope)
+		if err != nil {
+			return err
+		}
+		if record.Status != domain.IdempotencyProcessing || record.ExpiresAt.After(time.Now().Add(lease)) {
+			t.Errorf("processing record expires at %s, want within the lease of %s", record.ExpiresAt, lease)
+		}
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	for range 2 {
+		request := httptest.NewRequest(fiber.MethodPost, "/users", nil)
+		request.Header.Set(idempotencyKeyHeader, "key-1")
+		resp, err := app.Test(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusCreated {
+			t.Fatalf("status = %d, want %d", resp.StatusCode, fiber.StatusCreated)
+		}
+	}
+	if runs != 1 {
+		t.Fatalf("command ran %d times, want once and then replayed", runs)
+	}
+
+	record, err := store.Get(context.Background(), "key-1", scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != domain.IdempotencyCompleted || record.ExpiresAt.Before(time.Now().Add(23*time.Hour)) {
+		t.Fatalf("completed record %s expires at %s, want the full expiry", record.Status, record.ExpiresAt)
+	}
+}
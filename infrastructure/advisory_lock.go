@@ -0,0 +1,105 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var errLockNotHeld = errors.New("advisory lock is not held")
+
+// AdvisoryLock is a Postgres session level advisory lock. It is held by a
+// connection of its own, taken out of the pool, and is released by Postgres
+// when that connection closes, so a replica that dies gives the lock up
+// without a timeout.
+type AdvisoryLock struct {
+	db  *gorm.DB
+	key int64
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+// NewAdvisoryLock returns the lock named name. Replicas agree on the lock
+// by its name, which is hashed into the key Postgres locks.
+func NewAdvisoryLock(db *gorm.DB, name string) *AdvisoryLock {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return &AdvisoryLock{db: db, key: int64(hash.Sum64())}
+}
+
+func (l *AdvisoryLock) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn != nil {
+		return true, nil
+	}
+
+	pool, err := l.db.DB()
+	if err != nil {
+		return false, err
+	}
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, err
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// Check pings the connection that holds the lock. The lock lives exactly as
+// long as the session of that connection.
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return errLockNotHeld
+	}
+	if err := l.conn.PingContext(ctx); err != nil {
+		l.discard()
+		return err
+	}
+	return nil
+}
+
+func (l *AdvisoryLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	if _, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		l.discard()
+		return err
+	}
+	l.conn.Close()
+	l.conn = nil
+	return nil
+}
+
+// discard closes the connection holding the lock instead of returning it to
+// the pool, where it would keep holding the lock if its session were still
+// alive.
+func (l *AdvisoryLock) discard() {
+	_ = l.conn.Raw(func(any) error { return driver.ErrBadConn })
+	l.conn.Close()
+	l.conn = nil
+}
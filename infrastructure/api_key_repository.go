@@ -0,0 +1,70 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+)
+
+type ApiKeyRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewApiKeyRepositoryAdapter(db *gorm.DB) *ApiKeyRepositoryAdapter {
+	return &ApiKeyRepositoryAdapter{db: db}
+}
+
+func (r *ApiKeyRepositoryAdapter) Create(ctx context.Context, apiKey *domain.ApiKey) error {
+	return r.db.WithContext(ctx).Create(apiKey).Error
+}
+
+func (r *ApiKeyRepositoryAdapter) ListByUser(ctx context.Context, userId string) ([]domain.ApiKey, error) {
+	var apiKeys []domain.ApiKey
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userId).Order("created_at DESC").Find(&apiKeys).Error; err != nil {
+		return nil, err
+	}
+	return apiKeys, nil
+}
+
+func (r *ApiKeyRepositoryAdapter) GetByPrefix(ctx context.Context, prefix string) (*domain.ApiKey, error) {
+	var apiKey domain.ApiKey
+	err := r.db.WithContext(ctx).Where("prefix = ?", prefix).Take(&apiKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func (r *ApiKeyRepositoryAdapter) Revoke(ctx context.Context, userId string, id string) error {
+	result := r.db.WithContext(ctx).
+		Model(&domain.ApiKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *ApiKeyRepositoryAdapter) TouchLastUsed(ctx context.Context, id string, at time.Time, ip string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.ApiKey{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"last_used_at": at, "last_used_ip": ip}).Error
+}
+
+func (r *ApiKeyRepositoryAdapter) DeleteRevoked(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("revoked_at < ? OR expires_at < ?", before, before).
+		Delete(&domain.ApiKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,65 @@
+package infrastructure
+
+import (
+	"reflect"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"gorm.io/gorm"
+)
+
+const (
+	createdByField = "CreatedBy"
+	updatedByField = "UpdatedBy"
+)
+
+// registerAuditCallbacks fills the CreatedBy and UpdatedBy fields of any
+// model that has them with the subject of the principal in the statement
+// context. Writes without a principal, e.g. from the CLI, leave them as they
+// are.
+func registerAuditCallbacks(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("audit:create", auditCreate); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register("audit:update", auditUpdate)
+}
+
+// auditCreate sets the fields on every created record, since batch inserts
+// carry a slice that Statement.SetColumn would only update one element of.
+func auditCreate(db *gorm.DB) {
+	principal, ok := auditPrincipal(db)
+	if !ok {
+		return
+	}
+
+	for _, name := range []string{createdByField, updatedByField} {
+		field := db.Statement.Schema.LookUpField(name)
+		if field == nil {
+			continue
+		}
+
+		records := db.Statement.ReflectValue
+		switch records.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < records.Len(); i++ {
+				_ = field.Set(db.Statement.Context, reflect.Indirect(records.Index(i)), principal.Subject)
+			}
+		case reflect.Struct:
+			_ = field.Set(db.Statement.Context, records, principal.Subject)
+		}
+	}
+}
+
+func auditUpdate(db *gorm.DB) {
+	principal, ok := auditPrincipal(db)
+	if !ok || db.Statement.Schema.LookUpField(updatedByField) == nil {
+		return
+	}
+	db.Statement.SetColumn(updatedByField, principal.Subject, true)
+}
+
+func auditPrincipal(db *gorm.DB) (*auth.Principal, bool) {
+	if db.Statement.Schema == nil {
+		return nil, false
+	}
+	return auth.FromContext(db.Statement.Context)
+}
@@ -6,17 +6,56 @@ import (
 	"github.com/knetic0/production-ready-go-cqrs/domain"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-func NewPostgreAdapter(dsn string) *gorm.DB {
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// tenantOwnedModels are filtered by tenant and, with row-level security,
+// protected by a policy.
+var tenantOwnedModels = []any{&domain.User{}, &domain.RefreshToken{}, &domain.RecoveryCode{}, &domain.ApiKey{}, &domain.OAuthClient{}, &domain.ExternalIdentity{}, &domain.OidcLoginState{}, &domain.UserImport{}}
+
+var models = append([]any{&domain.Tenant{}, &domain.LoginAttempt{}, &domain.RateLimitBucket{}, &domain.IdempotencyRecord{}, &domain.Job{}, &domain.TaskRun{}, &domain.UsedMfaChallenge{}}, tenantOwnedModels...)
+
+type PostgreOptions struct {
+	// RowLevelSecurity backs the tenant filtering of the repositories with
+	// Postgres row-level security policies.
+	RowLevelSecurity bool
+}
+
+func NewPostgreAdapter(dsn string, options PostgreOptions) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		panic(fmt.Errorf("fatal error on postgre connection: %w", err))
 	}
 
-	if err := db.AutoMigrate(&domain.User{}, &domain.RefreshToken{}); err != nil {
+	if err := registerAuditCallbacks(db); err != nil {
+		panic(fmt.Errorf("fatal error registering audit callbacks: %w", err))
+	}
+
+	if err := registerTenantCallbacks(db, options.RowLevelSecurity); err != nil {
+		panic(fmt.Errorf("fatal error registering tenant callbacks: %w", err))
+	}
+
+	// The global email index predates tenants and would keep one email from
+	// registering with two of them.
+	if db.Migrator().HasIndex(&domain.User{}, "idx_users_email") {
+		if err := db.Migrator().DropIndex(&domain.User{}, "idx_users_email"); err != nil {
+			panic(fmt.Errorf("fatal error on postgre migration: %w", err))
+		}
+	}
+
+	if err := db.AutoMigrate(models...); err != nil {
 		panic(fmt.Errorf("fatal error on postgre migration: %w", err))
 	}
 
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&domain.Tenant{Id: DefaultTenantId, Name: "Default"}).Error; err != nil {
+		panic(fmt.Errorf("fatal error seeding default tenant: %w", err))
+	}
+
+	if options.RowLevelSecurity {
+		if err := enableRowLevelSecurity(db, tenantOwnedModels...); err != nil {
+			panic(fmt.Errorf("fatal error enabling row level security: %w", err))
+		}
+	}
+
 	return db
 }
@@ -0,0 +1,38 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+)
+
+type ExternalIdentityRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewExternalIdentityRepositoryAdapter(db *gorm.DB) *ExternalIdentityRepositoryAdapter {
+	return &ExternalIdentityRepositoryAdapter{db: db}
+}
+
+func (r *ExternalIdentityRepositoryAdapter) Create(ctx context.Context, identity *domain.ExternalIdentity) error {
+	return r.db.WithContext(ctx).Create(identity).Error
+}
+
+func (r *ExternalIdentityRepositoryAdapter) GetByIssuerSubject(ctx context.Context, issuer string, subject string) (*domain.ExternalIdentity, error) {
+	var identity domain.ExternalIdentity
+	err := r.db.WithContext(ctx).Where("issuer = ? AND subject = ?", issuer, subject).Take(&identity).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func (r *ExternalIdentityRepositoryAdapter) TouchLastLogin(ctx context.Context, id string, at time.Time) error {
+	return r.db.WithContext(ctx).Model(&domain.ExternalIdentity{}).Where("id = ?", id).Update("last_login_at", at).Error
+}
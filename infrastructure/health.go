@@ -0,0 +1,71 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// PostgresHealthChecker pings the database with a connection from the pool.
+type PostgresHealthChecker struct {
+	db *gorm.DB
+}
+
+func NewPostgresHealthChecker(db *gorm.DB) *PostgresHealthChecker {
+	return &PostgresHealthChecker{db: db}
+}
+
+func (c *PostgresHealthChecker) Check(ctx context.Context) error {
+	pool, err := c.db.DB()
+	if err != nil {
+		return err
+	}
+	return pool.PingContext(ctx)
+}
+
+// MigrationHealthChecker checks that the tables of every model exist, as
+// they would not when the schema was dropped or restored from a backup
+// older than the release.
+type MigrationHealthChecker struct {
+	db *gorm.DB
+}
+
+func NewMigrationHealthChecker(db *gorm.DB) *MigrationHealthChecker {
+	return &MigrationHealthChecker{db: db}
+}
+
+func (c *MigrationHealthChecker) Check(ctx context.Context) error {
+	tables := make([]string, 0, len(models))
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: c.db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		tables = append(tables, stmt.Schema.Table)
+	}
+
+	var existing []string
+	err := c.db.WithContext(ctx).
+		Raw("SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name IN ?", tables).
+		Scan(&existing).Error
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool, len(existing))
+	for _, table := range existing {
+		found[table] = true
+	}
+	var missing []string
+	for _, table := range tables {
+		if !found[table] {
+			missing = append(missing, table)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("tables are missing: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
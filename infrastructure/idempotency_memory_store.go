@@ -0,0 +1,87 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+// IdempotencyMemoryStore keeps idempotency records in process memory. It
+// only deduplicates retries that reach the same instance.
+type IdempotencyMemoryStore struct {
+	mu      sync.Mutex
+	records map[string]domain.IdempotencyRecord
+}
+
+func NewIdempotencyMemoryStore() *IdempotencyMemoryStore {
+	return &IdempotencyMemoryStore{records: make(map[string]domain.IdempotencyRecord)}
+}
+
+func idempotencyKey(key string, scope string) string {
+	return scope + "\x00" + key
+}
+
+func (s *IdempotencyMemoryStore) Acquire(ctx context.Context, record *domain.IdempotencyRecord) (bool, *domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if len(s.records) >= sweepThreshold {
+		s.sweep(now)
+	}
+
+	id := idempotencyKey(record.Key, record.Scope)
+	if existing, ok := s.records[id]; ok && now.Before(existing.ExpiresAt) {
+		return false, &existing, nil
+	}
+
+	s.records[id] = *record
+	return true, nil, nil
+}
+
+func (s *IdempotencyMemoryStore) Get(ctx context.Context, key string, scope string) (*domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[idempotencyKey(key, scope)]
+	if !ok || time.Now().After(record.ExpiresAt) {
+		return nil, domain.ErrNotFound
+	}
+	return &record, nil
+}
+
+func (s *IdempotencyMemoryStore) Complete(ctx context.Context, record *domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[idempotencyKey(record.Key, record.Scope)] = *record
+	return nil
+}
+
+func (s *IdempotencyMemoryStore) Release(ctx context.Context, key string, scope string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.records, idempotencyKey(key, scope))
+	return nil
+}
+
+func (s *IdempotencyMemoryStore) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sweep(now), nil
+}
+
+func (s *IdempotencyMemoryStore) sweep(now time.Time) int64 {
+	var deleted int64
+	for id, record := range s.records {
+		if now.After(record.ExpiresAt) {
+			delete(s.records, id)
+			deleted++
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,88 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IdempotencyRepositoryAdapter keeps idempotency records in Postgres, so a
+// retry is recognised whichever replica it reaches.
+type IdempotencyRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepositoryAdapter(db *gorm.DB) *IdempotencyRepositoryAdapter {
+	return &IdempotencyRepositoryAdapter{db: db}
+}
+
+// Acquire inserts the record, or takes over an expired one, in a single
+// statement so that of two concurrent duplicates exactly one wins. A record
+// still processing expires once its lease has passed.
+func (r *IdempotencyRepositoryAdapter) Acquire(ctx context.Context, record *domain.IdempotencyRecord) (bool, *domain.IdempotencyRecord, error) {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}, {Name: "scope"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"request_hash", "status", "response_status", "response_content_type", "response_body", "created_at", "expires_at",
+			}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Lt{Column: clause.Column{Table: "idempotency_records", Name: "expires_at"}, Value: time.Now()},
+			}},
+		}).
+		Create(record)
+	if result.Error != nil {
+		return false, nil, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return true, nil, nil
+	}
+
+	existing, err := r.Get(ctx, record.Key, record.Scope)
+	if err != nil {
+		return false, nil, err
+	}
+	return false, existing, nil
+}
+
+func (r *IdempotencyRepositoryAdapter) Get(ctx context.Context, key string, scope string) (*domain.IdempotencyRecord, error) {
+	var record domain.IdempotencyRecord
+	err := r.db.WithContext(ctx).
+		Where("key = ? AND scope = ? AND expires_at > ?", key, scope, time.Now()).
+		Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *IdempotencyRepositoryAdapter) Complete(ctx context.Context, record *domain.IdempotencyRecord) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.IdempotencyRecord{}).
+		Where("key = ? AND scope = ?", record.Key, record.Scope).
+		Updates(map[string]any{
+			"status":                record.Status,
+			"response_status":       record.ResponseStatus,
+			"response_content_type": record.ResponseContentType,
+			"response_body":         record.ResponseBody,
+			"expires_at":            record.ExpiresAt,
+		}).Error
+}
+
+func (r *IdempotencyRepositoryAdapter) Release(ctx context.Context, key string, scope string) error {
+	return r.db.WithContext(ctx).
+		Where("key = ? AND scope = ?", key, scope).
+		Delete(&domain.IdempotencyRecord{}).Error
+}
+
+func (r *IdempotencyRepositoryAdapter) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&domain.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
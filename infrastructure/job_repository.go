@@ -0,0 +1,142 @@
+package infrastructure
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type JobRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewJobRepositoryAdapter(db *gorm.DB) *JobRepositoryAdapter {
+	return &JobRepositoryAdapter{db: db}
+}
+
+func (r *JobRepositoryAdapter) Enqueue(ctx context.Context, job *domain.Job) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(job)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// Claim selects and locks the jobs in one statement. FOR UPDATE SKIP LOCKED
+// lets concurrent workers each claim different jobs without blocking on
+// one another. Running jobs whose lock expired are claimed again as another
+// attempt, which may be one beyond their last.
+func (r *JobRepositoryAdapter) Claim(ctx context.Context, kinds []string, worker string, limit int, now time.Time, lockedUntil time.Time) ([]domain.Job, error) {
+	var jobs []domain.Job
+	err := r.db.WithContext(ctx).Raw(`
+		UPDATE jobs SET status = ?, attempts = attempts + 1, locked_by = ?, locked_until = ?
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE kind IN ?
+			  AND ((status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?))
+			ORDER BY priority DESC, run_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		domain.JobRunning, worker, lockedUntil,
+		kinds,
+		domain.JobQueued, now, domain.JobRunning, now,
+		limit,
+	).Scan(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (r *JobRepositoryAdapter) Extend(ctx context.Context, id string, worker string, lockedUntil time.Time) error {
+	return r.update(ctx, id, worker, map[string]any{"locked_until": lockedUntil})
+}
+
+func (r *JobRepositoryAdapter) Complete(ctx context.Context, id string, worker string) error {
+	return r.update(ctx, id, worker, map[string]any{
+		"status":       domain.JobDone,
+		"locked_by":    "",
+		"locked_until": nil,
+		"finished_at":  time.Now(),
+	})
+}
+
+func (r *JobRepositoryAdapter) Retry(ctx context.Context, id string, worker string, runAt time.Time, lastError string) error {
+	return r.update(ctx, id, worker, map[string]any{
+		"status":       domain.JobQueued,
+		"run_at":       runAt,
+		"last_error":   truncate(lastError, 2048),
+		"locked_by":    "",
+		"locked_until": nil,
+	})
+}
+
+func (r *JobRepositoryAdapter) Bury(ctx context.Context, id string, worker string, lastError string) error {
+	return r.update(ctx, id, worker, map[string]any{
+		"status":       domain.JobDead,
+		"last_error":   truncate(lastError, 2048),
+		"locked_by":    "",
+		"locked_until": nil,
+		"finished_at":  time.Now(),
+	})
+}
+
+func (r *JobRepositoryAdapter) Release(ctx context.Context, id string, worker string) error {
+	return r.update(ctx, id, worker, map[string]any{
+		"status":       domain.JobQueued,
+		"attempts":     gorm.Expr("attempts - 1"),
+		"locked_by":    "",
+		"locked_until": nil,
+	})
+}
+
+func (r *JobRepositoryAdapter) DeleteFinished(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("status IN ? AND finished_at < ?", []domain.JobStatus{domain.JobDone, domain.JobDead}, before).
+		Delete(&domain.Job{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *JobRepositoryAdapter) Stats(ctx context.Context) ([]domain.JobStats, error) {
+	var stats []domain.JobStats
+	err := r.db.WithContext(ctx).
+		Model(&domain.Job{}).
+		Select("kind, status, count(*) AS count, min(run_at) AS oldest").
+		Where("status <> ?", domain.JobDone).
+		Group("kind, status").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// update changes a running job only while worker still holds it, so a
+// worker whose lock expired cannot overwrite the outcome of the worker that
+// took the job over.
+func (r *JobRepositoryAdapter) update(ctx context.Context, id string, worker string, columns map[string]any) error {
+	result := r.db.WithContext(ctx).
+		Model(&domain.Job{}).
+		Where("id = ? AND status = ? AND locked_by = ?", id, domain.JobRunning, worker).
+		Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+	return strings.ToValidUTF8(value[:length], "")
+}
@@ -0,0 +1,511 @@
+// Package jobs runs background work from a job table in Postgres, so jobs
+// survive restarts and are shared by all replicas.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var ErrUnknownJob = errors.New("no job handler is registered for the payload type")
+
+var (
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobs_queue_depth",
+		Help: "Number of jobs that are not done, by kind and status",
+	}, []string{"kind", "status"})
+	queueAge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jobs_queue_oldest_seconds",
+		Help: "Seconds the longest waiting due job of a kind has been due",
+	}, []string{"kind"})
+	jobWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jobs_wait_seconds",
+		Help:    "Time from when a job was due until a worker claimed it",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"kind"})
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jobs_duration_seconds",
+		Help:    "Duration of job attempts by outcome: done, retry, dead or released",
+		Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	}, []string{"kind", "outcome"})
+)
+
+func init() {
+	prometheus.MustRegister(queueDepth, queueAge, jobWait, jobDuration)
+}
+
+// Handler runs jobs with payloads of type T, the way command handlers run
+// requests. A job whose handler fails is retried until it runs out of
+// attempts.
+type Handler[T any] interface {
+	Handle(ctx context.Context, payload *T) error
+}
+
+// Burier is implemented by handlers that clean up after a job of theirs has
+// been given up on, as when its payload points to data kept for the job.
+type Burier[T any] interface {
+	Bury(ctx context.Context, payload *T, reason string) error
+}
+
+// Options are the defaults of a kind of job. Zero values fall back to the
+// queue's.
+type Options struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Timeout bounds each attempt; zero leaves attempts unbounded.
+	Timeout time.Duration
+}
+
+type Config struct {
+	Workers      int
+	PollInterval time.Duration
+	// Lease is how long a job stays locked to its worker without a
+	// heartbeat. Jobs of workers that died are claimed again after it.
+	Lease         time.Duration
+	StatsInterval time.Duration
+	Defaults      Options
+}
+
+type kind struct {
+	name    string
+	options Options
+	run     func(ctx context.Context, payload []byte) error
+	// bury is nil unless the handler is a Burier.
+	bury func(ctx context.Context, payload []byte, reason string) error
+}
+
+// Queue enqueues jobs and, once started, runs them with a pool of workers
+// that poll for due jobs. Constructing and registering with it does not
+// touch the database.
+type Queue struct {
+	repository domain.JobRepository
+	config     Config
+	worker     string
+	kinds      map[string]*kind
+	types      map[reflect.Type]*kind
+
+	mu      sync.RWMutex
+	started bool
+	closed  bool
+	wake    chan struct{}
+	stop    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewQueue(repository domain.JobRepository, config Config) *Queue {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		repository: repository,
+		config:     config,
+		worker:     fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+		kinds:      make(map[string]*kind),
+		types:      make(map[reflect.Type]*kind),
+		wake:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Register runs jobs of the named kind, whose payloads are T, with handler.
+// Kinds are registered before the queue is started.
+func Register[T any](q *Queue, name string, handler Handler[T], options Options) {
+	registered := &kind{
+		name:    name,
+		options: options,
+		run: func(ctx context.Context, payload []byte) error {
+			var decoded T
+			if err := json.Unmarshal(payload, &decoded); err != nil {
+				return permanent{err}
+			}
+			return handler.Handle(ctx, &decoded)
+		},
+	}
+	if burier, ok := handler.(Burier[T]); ok {
+		registered.bury = func(ctx context.Context, payload []byte, reason string) error {
+			var decoded T
+			if err := json.Unmarshal(payload, &decoded); err != nil {
+				return err
+			}
+			return burier.Bury(ctx, &decoded, reason)
+		}
+	}
+	q.kinds[name] = registered
+	q.types[reflect.TypeFor[T]()] = registered
+}
+
+// Enqueue stores a job for the payload's registered kind, with the tenant
+// and trace of ctx.
+func (q *Queue) Enqueue(ctx context.Context, payload any, options domain.JobOptions) error {
+	t := reflect.TypeOf(payload)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	registered, ok := q.types[t]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrUnknownJob, t)
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	job := &domain.Job{
+		Id:          uuid.NewString(),
+		Kind:        registered.name,
+		Payload:     encoded,
+		Status:      domain.JobQueued,
+		Priority:    options.Priority,
+		RunAt:       options.RunAt,
+		MaxAttempts: options.MaxAttempts,
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = q.options(registered).MaxAttempts
+	}
+	if options.UniqueKey != "" {
+		job.UniqueKey = &options.UniqueKey
+	}
+	if id, ok := tenant.FromContext(ctx); ok {
+		job.Tenant = id
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	job.TraceParent = carrier.Get("traceparent")
+
+	if _, err := q.repository.Enqueue(ctx, job); err != nil {
+		return err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start runs the workers and the collection of queue metrics.
+func (q *Queue) Start() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.started || q.closed {
+		return
+	}
+	q.started = true
+
+	for range q.config.Workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.wg.Add(1)
+	go q.collectStats()
+}
+
+// Close stops claiming jobs and waits for the running ones until ctx
+// expires. Jobs still running then are cancelled and released, to be
+// claimed again by another worker or after a restart.
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+		q.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	kinds := make([]string, 0, len(q.kinds))
+	for name := range q.kinds {
+		kinds = append(kinds, name)
+	}
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		now := time.Now()
+		claimed, err := q.repository.Claim(q.ctx, kinds, q.worker, 1, now, now.Add(q.config.Lease))
+		if err != nil {
+			zap.L().Error("failed to claim jobs", zap.Error(err))
+		}
+		for _, job := range claimed {
+			q.process(job)
+		}
+		if len(claimed) > 0 {
+			continue
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-time.After(q.config.PollInterval):
+		}
+	}
+}
+
+func (q *Queue) process(job domain.Job) {
+	registered, ok := q.kinds[job.Kind]
+	if !ok {
+		return
+	}
+	options := q.options(registered)
+
+	ctx := q.ctx
+	var links []trace.Link
+	if job.TraceParent != "" {
+		parent := propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": job.TraceParent})
+		links = append(links, trace.LinkFromContext(parent))
+	}
+	tracer := otel.Tracer("app-go/jobs")
+	ctx, span := tracer.Start(ctx, "Job."+job.Kind, trace.WithLinks(links...))
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("job.id", job.Id),
+		attribute.String("job.kind", job.Kind),
+		attribute.Int("job.attempt", job.Attempts),
+	)
+	if job.Tenant != "" {
+		ctx = tenant.WithTenant(ctx, job.Tenant, tenant.SourceDefault)
+	}
+
+	start := time.Now()
+	jobWait.WithLabelValues(job.Kind).Observe(max(start.Sub(job.RunAt), 0).Seconds())
+
+	// Claiming a job whose worker died counts as an attempt, so a job that
+	// keeps crashing its worker runs out of attempts like one that fails.
+	if job.Attempts > job.MaxAttempts {
+		reason := "worker lost its lock on the last attempt"
+		span.SetAttributes(attribute.String("job.outcome", "dead"))
+		span.SetStatus(codes.Error, reason)
+		zap.L().Error("job failed", zap.String("jobId", job.Id), zap.String("kind", job.Kind), zap.Int("attempt", job.Attempts), zap.String("outcome", "dead"), zap.String("reason", reason))
+		if err := q.bury(context.WithoutCancel(ctx), registered, job, reason); err != nil {
+			zap.L().Error("failed to store job outcome", zap.String("jobId", job.Id), zap.String("outcome", "dead"), zap.Error(err))
+		}
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	if options.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, options.Timeout)
+	}
+	heartbeat := q.heartbeat(runCtx, cancel, job.Id)
+	err := registered.run(runCtx, job.Payload)
+	cancel()
+	<-heartbeat
+
+	// The outcome is recorded even when the queue is being shut down.
+	storeCtx := context.WithoutCancel(ctx)
+	outcome := outcomeOf(job, err, q.ctx.Err() != nil)
+	var storeErr error
+	switch outcome {
+	case "done":
+		storeErr = q.repository.Complete(storeCtx, job.Id, q.worker)
+	case "released":
+		storeErr = q.repository.Release(storeCtx, job.Id, q.worker)
+	case "dead":
+		storeErr = q.bury(storeCtx, registered, job, err.Error())
+	default:
+		storeErr = q.repository.Retry(storeCtx, job.Id, q.worker, time.Now().Add(backoff(options, job.Attempts)), err.Error())
+	}
+	jobDuration.WithLabelValues(job.Kind, outcome).Observe(time.Since(start).Seconds())
+	span.SetAttributes(attribute.String("job.outcome", outcome))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "job failed")
+		log := zap.L().Warn
+		if outcome == "dead" {
+			log = zap.L().Error
+		}
+		log("job failed", zap.String("jobId", job.Id), zap.String("kind", job.Kind), zap.Int("attempt", job.Attempts), zap.String("outcome", outcome), zap.Error(err))
+	} else {
+		span.SetStatus(codes.Ok, "done")
+	}
+	if storeErr != nil {
+		zap.L().Error("failed to store job outcome", zap.String("jobId", job.Id), zap.String("outcome", outcome), zap.Error(storeErr))
+	}
+}
+
+// outcomeOf tells what becomes of a job whose attempt ended with err: done,
+// released when the queue is closing, dead when it is out of attempts or
+// cannot succeed, and retried otherwise.
+func outcomeOf(job domain.Job, err error, closing bool) string {
+	switch {
+	case err == nil:
+		return "done"
+	case closing:
+		return "released"
+	case job.Attempts >= job.MaxAttempts || errors.As(err, new(permanent)):
+		return "dead"
+	default:
+		return "retry"
+	}
+}
+
+// bury marks the job as dead and lets its handler clean up after it.
+func (q *Queue) bury(ctx context.Context, registered *kind, job domain.Job, reason string) error {
+	if err := q.repository.Bury(ctx, job.Id, q.worker, reason); err != nil {
+		return err
+	}
+	if registered.bury == nil {
+		return nil
+	}
+	if err := registered.bury(ctx, job.Payload, reason); err != nil {
+		zap.L().Error("failed to clean up after buried job", zap.String("jobId", job.Id), zap.String("kind", job.Kind), zap.Error(err))
+	}
+	return nil
+}
+
+// heartbeat extends the lock of the job while it runs. Once the lock is
+// lost to another worker the job is cancelled, as it is running twice.
+func (q *Queue) heartbeat(ctx context.Context, cancel context.CancelFunc, id string) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(q.config.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := q.repository.Extend(ctx, id, q.worker, time.Now().Add(q.config.Lease))
+				if errors.Is(err, domain.ErrNotFound) {
+					zap.L().Error("job lock lost to another worker", zap.String("jobId", id))
+					cancel()
+					return
+				}
+				if err != nil && ctx.Err() == nil {
+					zap.L().Warn("failed to extend job lock", zap.String("jobId", id), zap.Error(err))
+				}
+			}
+		}
+	}()
+	return done
+}
+
+func (q *Queue) collectStats() {
+	defer q.wg.Done()
+	for {
+		stats, err := q.repository.Stats(q.ctx)
+		if err != nil && q.ctx.Err() == nil {
+			zap.L().Warn("failed to collect job queue stats", zap.Error(err))
+		}
+		if err == nil {
+			queueDepth.Reset()
+			queueAge.Reset()
+			for _, stat := range stats {
+				queueDepth.WithLabelValues(stat.Kind, string(stat.Status)).Set(float64(stat.Count))
+				if stat.Status == domain.JobQueued {
+					queueAge.WithLabelValues(stat.Kind).Set(max(time.Since(stat.Oldest), 0).Seconds())
+				}
+			}
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-time.After(q.config.StatsInterval):
+		}
+	}
+}
+
+// Lag is how long the longest waiting due job has been waiting for a
+// worker, zero when none is waiting.
+func (q *Queue) Lag(ctx context.Context) (time.Duration, error) {
+	stats, err := q.repository.Stats(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var lag time.Duration
+	for _, stat := range stats {
+		if stat.Status == domain.JobQueued {
+			lag = max(lag, time.Since(stat.Oldest))
+		}
+	}
+	return lag, nil
+}
+
+func (q *Queue) options(registered *kind) Options {
+	options := registered.options
+	if options.MaxAttempts == 0 {
+		options.MaxAttempts = q.config.Defaults.MaxAttempts
+	}
+	if options.InitialBackoff == 0 {
+		options.InitialBackoff = q.config.Defaults.InitialBackoff
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = q.config.Defaults.MaxBackoff
+	}
+	if options.Timeout == 0 {
+		options.Timeout = q.config.Defaults.Timeout
+	}
+	return options
+}
+
+// backoff doubles the delay with every attempt that failed, up to the
+// maximum.
+func backoff(options Options, attempts int) time.Duration {
+	delay := options.InitialBackoff
+	for i := 1; i < attempts && delay < options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, options.MaxBackoff)
+}
+
+// permanent marks failures retrying cannot fix, like a payload that does
+// not decode.
+type permanent struct {
+	error
+}
+
+func (p permanent) Unwrap() error {
+	return p.error
+}
@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+func TestBackoff(t *testing.T) {
+	options := Options{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, test := range tests {
+		if got := backoff(options, test.attempts); got != test.want {
+			t.Errorf("backoff after %d attempts = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestOutcomeOf(t *testing.T) {
+	failed := errors.New("smtp unavailable")
+	tests := []struct {
+		name     string
+		attempts int
+		err      error
+		closing  bool
+		want     string
+	}{
+		{"succeeded", 1, nil, false, "done"},
+		{"succeeded while closing", 1, nil, true, "done"},
+		{"failed while closing", 1, failed, true, "released"},
+		{"failed with attempts left", 1, failed, false, "retry"},
+		{"failed on the last attempt", 3, failed, false, "dead"},
+		{"failed beyond the last attempt", 4, failed, false, "dead"},
+		{"failed for good", 1, permanent{failed}, false, "dead"},
+		{"failed for good while closing", 1, permanent{failed}, true, "released"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := domain.Job{Attempts: test.attempts, MaxAttempts: 3}
+			if got := outcomeOf(job, test.err, test.closing); got != test.want {
+				t.Fatalf("outcome = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+type fakeJobs struct {
+	domain.JobRepository
+	buried []string
+}
+
+func (r *fakeJobs) Bury(ctx context.Context, id string, worker string, lastError string) error {
+	r.buried = append(r.buried, id)
+	return nil
+}
+
+type crashingHandler struct {
+	runs   int
+	buried []string
+}
+
+func (h *crashingHandler) Handle(ctx context.Context, payload *struct{ Id string }) error {
+	h.runs++
+	return nil
+}
+
+func (h *crashingHandler) Bury(ctx context.Context, payload *struct{ Id string }, reason string) error {
+	h.buried = append(h.buried, payload.Id)
+	return nil
+}
+
+// A job whose worker died on its last attempt is claimed once more when its
+// lock expires, and buried then rather than run again.
+func TestProcessBuriesJobsBeyondTheirLastAttempt(t *testing.T) {
+	repository := &fakeJobs{}
+	queue := NewQueue(repository, Config{Lease: time.Minute})
+	handler := &crashingHandler{}
+	Register(queue, "crash", handler, Options{})
+
+	queue.process(domain.Job{Id: "job-1", Kind: "crash", Payload: []byte(`{"Id":"payload-1"}`), Attempts: 4, MaxAttempts: 3})
+
+	if handler.runs != 0 {
+		t.Fatalf("job ran %d times, want none", handler.runs)
+	}
+	if len(repository.buried) != 1 || repository.buried[0] != "job-1" {
+		t.Fatalf("buried jobs %v, want job-1", repository.buried)
+	}
+	if len(handler.buried) != 1 || handler.buried[0] != "payload-1" {
+		t.Fatalf("handler cleaned up after %v, want payload-1", handler.buried)
+	}
+}
@@ -0,0 +1,97 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+// sweepThreshold bounds how many entries accumulate before stale ones are
+// removed, keeping memory usage flat under credential stuffing.
+const sweepThreshold = 10_000
+
+// LoginAttemptMemoryStore keeps failed login attempts in process memory. It
+// is the default for single instance deployments.
+type LoginAttemptMemoryStore struct {
+	mu       sync.Mutex
+	attempts map[string]domain.LoginAttempt
+	window   time.Duration
+}
+
+func NewLoginAttemptMemoryStore() *LoginAttemptMemoryStore {
+	return &LoginAttemptMemoryStore{attempts: make(map[string]domain.LoginAttempt)}
+}
+
+func (s *LoginAttemptMemoryStore) Get(ctx context.Context, key string) (*domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return &domain.LoginAttempt{Key: key}, nil
+	}
+	return &attempt, nil
+}
+
+func (s *LoginAttemptMemoryStore) RegisterFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*domain.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.window = window
+	if len(s.attempts) >= sweepThreshold {
+		s.sweep(now)
+	}
+
+	attempt, ok := s.attempts[key]
+	if !ok || now.Sub(attempt.LastFailureAt) > window {
+		attempt = domain.LoginAttempt{Key: key, LockedUntil: attempt.LockedUntil}
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	s.attempts[key] = attempt
+
+	return &attempt, nil
+}
+
+func (s *LoginAttemptMemoryStore) Lock(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt := s.attempts[key]
+	attempt.Key = key
+	attempt.LockedUntil = &until
+	s.attempts[key] = attempt
+	return nil
+}
+
+func (s *LoginAttemptMemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	return nil
+}
+
+func (s *LoginAttemptMemoryStore) DeleteStale(ctx context.Context, now time.Time, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteStale(now, window), nil
+}
+
+func (s *LoginAttemptMemoryStore) sweep(now time.Time) {
+	s.deleteStale(now, s.window)
+}
+
+func (s *LoginAttemptMemoryStore) deleteStale(now time.Time, window time.Duration) int64 {
+	var deleted int64
+	for key, attempt := range s.attempts {
+		if !attempt.IsLocked(now) && now.Sub(attempt.LastFailureAt) > window {
+			delete(s.attempts, key)
+			deleted++
+		}
+	}
+	return deleted
+}
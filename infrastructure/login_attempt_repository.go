@@ -0,0 +1,76 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LoginAttemptRepositoryAdapter stores failed login attempts in Postgres so
+// that all replicas share the same counters.
+type LoginAttemptRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepositoryAdapter(db *gorm.DB) *LoginAttemptRepositoryAdapter {
+	return &LoginAttemptRepositoryAdapter{db: db}
+}
+
+func (r *LoginAttemptRepositoryAdapter) Get(ctx context.Context, key string) (*domain.LoginAttempt, error) {
+	var attempt domain.LoginAttempt
+	err := r.db.WithContext(ctx).Where("key = ?", key).Take(&attempt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &domain.LoginAttempt{Key: key}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// RegisterFailure increments the counter in a single upsert, so concurrent
+// failures on different replicas are never lost.
+func (r *LoginAttemptRepositoryAdapter) RegisterFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*domain.LoginAttempt, error) {
+	attempt := domain.LoginAttempt{Key: key, Failures: 1, LastFailureAt: now}
+	err := r.db.WithContext(ctx).
+		Clauses(
+			clause.OnConflict{
+				Columns: []clause.Column{{Name: "key"}},
+				DoUpdates: clause.Set{
+					{Column: clause.Column{Name: "failures"}, Value: gorm.Expr(
+						"CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END",
+						now.Add(-window),
+					)},
+					{Column: clause.Column{Name: "last_failure_at"}, Value: now},
+				},
+			},
+			clause.Returning{},
+		).
+		Create(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+func (r *LoginAttemptRepositoryAdapter) Lock(ctx context.Context, key string, until time.Time) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.LoginAttempt{}).
+		Where("key = ?", key).
+		Update("locked_until", until).Error
+}
+
+func (r *LoginAttemptRepositoryAdapter) Reset(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("key = ?", key).Delete(&domain.LoginAttempt{}).Error
+}
+
+func (r *LoginAttemptRepositoryAdapter) DeleteStale(ctx context.Context, now time.Time, window time.Duration) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("(locked_until IS NULL OR locked_until <= ?) AND last_failure_at < ?", now, now.Add(-window)).
+		Delete(&domain.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
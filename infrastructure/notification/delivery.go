@@ -0,0 +1,49 @@
+package notification
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Delivery is the job that sends a rendered notification.
+type Delivery struct {
+	Message  Message
+	Template string
+}
+
+// QueuedNotifier renders notifications synchronously, so template errors are
+// reported to the caller, and delivers them through the job queue with
+// retries. A slow or unavailable transport never blocks the caller.
+type QueuedNotifier struct {
+	renderer *Renderer
+	queue    domain.JobQueue
+}
+
+func NewQueuedNotifier(renderer *Renderer, queue domain.JobQueue) *QueuedNotifier {
+	return &QueuedNotifier{renderer: renderer, queue: queue}
+}
+
+func (n *QueuedNotifier) Notify(ctx context.Context, notification domain.Notification) error {
+	message, err := n.renderer.Render(notification)
+	if err != nil {
+		return err
+	}
+	return n.queue.Enqueue(ctx, &Delivery{Message: message, Template: notification.Template}, domain.JobOptions{})
+}
+
+// DeliveryHandler sends the queued notifications with the transport.
+type DeliveryHandler struct {
+	transport Transport
+}
+
+func NewDeliveryHandler(transport Transport) *DeliveryHandler {
+	return &DeliveryHandler{transport: transport}
+}
+
+func (h *DeliveryHandler) Handle(ctx context.Context, delivery *Delivery) error {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("notification.template", delivery.Template))
+	return h.transport.Send(ctx, delivery.Message)
+}
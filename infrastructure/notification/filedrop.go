@@ -0,0 +1,42 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileDropTransport writes every message as an .eml file into a maildir
+// style directory. Files are written to tmp/ and renamed into new/, so a
+// reader never observes a partially written message.
+type FileDropTransport struct {
+	directory string
+}
+
+func NewFileDropTransport(directory string) (*FileDropTransport, error) {
+	for _, sub := range []string{"tmp", "new"} {
+		if err := os.MkdirAll(filepath.Join(directory, sub), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &FileDropTransport{directory: directory}, nil
+}
+
+func (t *FileDropTransport) Send(ctx context.Context, message Message) error {
+	body, err := buildMIME(message)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%s.eml", time.Now().UnixNano(), uuid.New().String())
+	tmp := filepath.Join(t.directory, "tmp", name)
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(t.directory, "new", name))
+}
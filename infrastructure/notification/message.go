@@ -0,0 +1,17 @@
+package notification
+
+import "context"
+
+// Message is a rendered notification ready to be handed to a transport.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Transport delivers rendered messages, e.g. over SMTP or into a directory.
+type Transport interface {
+	Send(ctx context.Context, message Message) error
+}
@@ -0,0 +1,130 @@
+package notification
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	ErrTemplateNotFound = errors.New("notification template not found")
+)
+
+// Renderer renders notifications from the templates embedded in the binary.
+// Each template consists of <name>.subject.tmpl, <name>.txt.tmpl and an
+// optional <name>.html.tmpl below templates/<locale>/.
+type Renderer struct {
+	from          string
+	defaultLocale string
+}
+
+func NewRenderer(from string, defaultLocale string) *Renderer {
+	return &Renderer{from: from, defaultLocale: defaultLocale}
+}
+
+func (r *Renderer) Render(notification domain.Notification) (Message, error) {
+	locale := r.resolveLocale(notification.Locale, notification.Template)
+
+	subject, err := r.renderText(locale, notification.Template+".subject.tmpl", notification.Data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	text, err := r.renderText(locale, notification.Template+".txt.tmpl", notification.Data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	html, err := r.renderHTML(locale, notification.Template+".html.tmpl", notification.Data)
+	if err != nil && !errors.Is(err, ErrTemplateNotFound) {
+		return Message{}, err
+	}
+
+	return Message{
+		From:    r.from,
+		To:      notification.To,
+		Subject: strings.TrimSpace(subject),
+		Text:    text,
+		HTML:    html,
+	}, nil
+}
+
+// resolveLocale falls back from "tr-TR" to "tr" and finally to the default
+// locale when no template exists for the requested one.
+func (r *Renderer) resolveLocale(locale string, name string) string {
+	candidates := []string{locale}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		candidates = append(candidates, base)
+	}
+
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		if _, err := fs.Stat(templateFS, templatePath(candidate, name+".subject.tmpl")); err == nil {
+			return candidate
+		}
+	}
+	return r.defaultLocale
+}
+
+func (r *Renderer) renderText(locale string, file string, data map[string]any) (string, error) {
+	content, err := readTemplate(locale, file)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := texttemplate.New(file).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("parse template %s: %w", file, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("execute template %s: %w", file, err)
+	}
+	return buf.String(), nil
+}
+
+func (r *Renderer) renderHTML(locale string, file string, data map[string]any) (string, error) {
+	content, err := readTemplate(locale, file)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := htmltemplate.New(file).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("parse template %s: %w", file, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("execute template %s: %w", file, err)
+	}
+	return buf.String(), nil
+}
+
+func readTemplate(locale string, file string) (string, error) {
+	content, err := templateFS.ReadFile(templatePath(locale, file))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s/%s", ErrTemplateNotFound, locale, file)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func templatePath(locale string, file string) string {
+	return "templates/" + locale + "/" + file
+}
@@ -0,0 +1,61 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+)
+
+type OAuthClientRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepositoryAdapter(db *gorm.DB) *OAuthClientRepositoryAdapter {
+	return &OAuthClientRepositoryAdapter{db: db}
+}
+
+func (r *OAuthClientRepositoryAdapter) Create(ctx context.Context, client *domain.OAuthClient) error {
+	return r.db.WithContext(ctx).Create(client).Error
+}
+
+func (r *OAuthClientRepositoryAdapter) List(ctx context.Context) ([]domain.OAuthClient, error) {
+	var clients []domain.OAuthClient
+	if err := r.db.WithContext(ctx).Order("created_at").Find(&clients).Error; err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *OAuthClientRepositoryAdapter) GetByClientId(ctx context.Context, clientId string) (*domain.OAuthClient, error) {
+	var client domain.OAuthClient
+	err := r.db.WithContext(ctx).Where("client_id = ?", clientId).Take(&client).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *OAuthClientRepositoryAdapter) Revoke(ctx context.Context, clientId string) error {
+	result := r.db.WithContext(ctx).
+		Model(&domain.OAuthClient{}).
+		Where("client_id = ? AND revoked_at IS NULL", clientId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *OAuthClientRepositoryAdapter) DeleteRevoked(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("revoked_at < ?", before).Delete(&domain.OAuthClient{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,273 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc discovery failed")
+	ErrTokenExchange  = errors.New("oidc token exchange failed")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// Asymmetric algorithms only: an HS256 ID token would be signed with the
+// client secret, which the provider shares with every holder of it.
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+type Config struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type idTokenClaims struct {
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	GivenName       string `json:"given_name"`
+	FamilyName      string `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect relying party for a single provider. The
+// discovery document and JWKS are fetched on first use, so an unreachable
+// provider does not prevent the application from starting.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	jwks      *keyfunc.JWKS
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	return &Provider{config: config, client: client}
+}
+
+func (p *Provider) AuthorizationURL(ctx context.Context, state string, nonce string, codeChallenge string) (string, error) {
+	discovery, _, err := p.load(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientId)
+	query.Set("redirect_uri", p.config.RedirectUrl)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (p *Provider) Authenticate(ctx context.Context, code string, codeVerifier string, nonce string) (*domain.ExternalIdentityClaims, error) {
+	tracer := otel.Tracer("app-go/oidc")
+	ctx, span := tracer.Start(ctx, "OidcProvider.Authenticate")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("oidc.issuer", p.config.Issuer))
+
+	discovery, jwks, err := p.load(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "discovery failed")
+		return nil, err
+	}
+
+	rawIDToken, err := p.exchange(ctx, discovery.TokenEndpoint, code, codeVerifier)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "token exchange failed")
+		return nil, err
+	}
+
+	claims, err := p.verify(rawIDToken, jwks, nonce)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "id token verification failed")
+		return nil, err
+	}
+
+	span.SetStatus(codes.Ok, "authenticated")
+	return claims, nil
+}
+
+// Close stops the background JWKS refresh.
+func (p *Provider) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jwks != nil {
+		p.jwks.EndBackground()
+	}
+}
+
+func (p *Provider) load(ctx context.Context) (*discoveryDocument, *keyfunc.JWKS, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, p.jwks, nil
+	}
+
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jwks, err := keyfunc.Get(discovery.JwksUri, keyfunc.Options{
+		Client:            p.client,
+		RefreshInterval:   time.Hour,
+		RefreshRateLimit:  5 * time.Minute,
+		RefreshTimeout:    10 * time.Second,
+		RefreshUnknownKID: true,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: jwks: %w", ErrDiscovery, err)
+	}
+
+	p.discovery, p.jwks = discovery, jwks
+	return discovery, jwks, nil
+}
+
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	endpoint := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: status %d", ErrDiscovery, resp.StatusCode)
+	}
+
+	var discovery discoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDiscovery, err)
+	}
+
+	// OpenID Connect Discovery 1.0 section 4.3.
+	if discovery.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("%w: issuer mismatch %q", ErrDiscovery, discovery.Issuer)
+	}
+	return &discovery, nil
+}
+
+func (p *Provider) exchange(ctx context.Context, tokenEndpoint string, code string, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectUrl)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrTokenExchange, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrTokenExchange, err)
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("%w: status %d", ErrTokenExchange, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: %s %s", ErrTokenExchange, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", fmt.Errorf("%w: no id_token in response", ErrTokenExchange)
+	}
+	return token.IDToken, nil
+}
+
+// verify validates the ID token as required by OpenID Connect Core 1.0
+// section 3.1.3.7: signature, issuer, audience, authorized party, expiry
+// and nonce.
+func (p *Provider) verify(raw string, jwks *keyfunc.JWKS, nonce string) (*domain.ExternalIdentityClaims, error) {
+	var claims idTokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, jwks.Keyfunc,
+		jwt.WithValidMethods(idTokenAlgorithms),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientId),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientId {
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return &domain.ExternalIdentityClaims{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type OidcLoginStateRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewOidcLoginStateRepositoryAdapter(db *gorm.DB) *OidcLoginStateRepositoryAdapter {
+	return &OidcLoginStateRepositoryAdapter{db: db}
+}
+
+func (r *OidcLoginStateRepositoryAdapter) Create(ctx context.Context, state *domain.OidcLoginState) error {
+	return r.db.WithContext(ctx).Create(state).Error
+}
+
+func (r *OidcLoginStateRepositoryAdapter) Consume(ctx context.Context, state string) (*domain.OidcLoginState, error) {
+	var deleted []domain.OidcLoginState
+	result := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("state = ?", state).
+		Delete(&deleted)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(deleted) == 0 {
+		return nil, domain.ErrNotFound
+	}
+	return &deleted[0], nil
+}
+
+func (r *OidcLoginStateRepositoryAdapter) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&domain.OidcLoginState{})
+	return result.RowsAffected, result.Error
+}
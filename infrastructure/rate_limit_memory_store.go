@@ -0,0 +1,62 @@
+package infrastructure
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+)
+
+// RateLimitMemoryStore keeps token buckets in process memory, giving every
+// instance its own budget.
+type RateLimitMemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*domain.RateLimitBucket
+	maxWindow time.Duration
+}
+
+func NewRateLimitMemoryStore() *RateLimitMemoryStore {
+	return &RateLimitMemoryStore{buckets: make(map[string]*domain.RateLimitBucket)}
+}
+
+func (s *RateLimitMemoryStore) Take(ctx context.Context, key string, policy domain.RateLimitPolicy, now time.Time) (domain.RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxWindow = max(s.maxWindow, policy.Window)
+	if len(s.buckets) >= sweepThreshold {
+		s.sweep(now)
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &domain.RateLimitBucket{Key: key}
+		s.buckets[key] = bucket
+	}
+	bucket.Take(policy, now)
+
+	return bucket.Result(policy), nil
+}
+
+func (s *RateLimitMemoryStore) DeleteStale(ctx context.Context, now time.Time, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteStale(now, window), nil
+}
+
+func (s *RateLimitMemoryStore) sweep(now time.Time) {
+	s.deleteStale(now, s.maxWindow)
+}
+
+func (s *RateLimitMemoryStore) deleteStale(now time.Time, window time.Duration) int64 {
+	var deleted int64
+	for key, bucket := range s.buckets {
+		if bucket.IsStale(window, now) {
+			delete(s.buckets, key)
+			deleted++
+		}
+	}
+	return deleted
+}
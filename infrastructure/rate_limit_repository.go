@@ -0,0 +1,58 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimitRepositoryAdapter keeps token buckets in Postgres so that all
+// replicas share one budget per key.
+type RateLimitRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewRateLimitRepositoryAdapter(db *gorm.DB) *RateLimitRepositoryAdapter {
+	return &RateLimitRepositoryAdapter{db: db}
+}
+
+// Take refills and takes from the bucket in a single upsert, the same
+// arithmetic as RateLimitBucket.Take, so concurrent requests on different
+// replicas cannot both spend the last token.
+func (r *RateLimitRepositoryAdapter) Take(ctx context.Context, key string, policy domain.RateLimitPolicy, now time.Time) (domain.RateLimitResult, error) {
+	rate := float64(policy.Limit) / policy.Window.Seconds()
+	refilled := gorm.Expr(
+		"LEAST(?, rate_limit_buckets.tokens + EXTRACT(EPOCH FROM (?::timestamptz - rate_limit_buckets.refilled_at)) * ?)",
+		policy.Limit, now, rate,
+	)
+
+	bucket := domain.RateLimitBucket{Key: key}
+	bucket.Take(policy, now)
+
+	err := r.db.WithContext(ctx).
+		Clauses(
+			clause.OnConflict{
+				Columns: []clause.Column{{Name: "key"}},
+				DoUpdates: clause.Set{
+					{Column: clause.Column{Name: "tokens"}, Value: gorm.Expr("CASE WHEN ? >= 1 THEN ? - 1 ELSE ? END", refilled, refilled, refilled)},
+					{Column: clause.Column{Name: "allowed"}, Value: gorm.Expr("? >= 1", refilled)},
+					{Column: clause.Column{Name: "refilled_at"}, Value: now},
+				},
+			},
+			clause.Returning{},
+		).
+		Create(&bucket).Error
+	if err != nil {
+		return domain.RateLimitResult{}, err
+	}
+
+	return bucket.Result(policy), nil
+}
+
+func (r *RateLimitRepositoryAdapter) DeleteStale(ctx context.Context, now time.Time, window time.Duration) (int64, error) {
+	result := r.db.WithContext(ctx).Where("refilled_at <= ?", now.Add(-window)).Delete(&domain.RateLimitBucket{})
+	return result.RowsAffected, result.Error
+}
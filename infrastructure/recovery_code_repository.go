@@ -0,0 +1,47 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepositoryAdapter(db *gorm.DB) *RecoveryCodeRepositoryAdapter {
+	return &RecoveryCodeRepositoryAdapter{db: db}
+}
+
+func (r *RecoveryCodeRepositoryAdapter) Replace(ctx context.Context, userId string, codes []domain.RecoveryCode) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&domain.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+func (r *RecoveryCodeRepositoryAdapter) Consume(ctx context.Context, userId string, codeHash string) error {
+	result := r.db.WithContext(ctx).
+		Model(&domain.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (r *RecoveryCodeRepositoryAdapter) DeleteByUser(ctx context.Context, userId string) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userId).Delete(&domain.RecoveryCode{}).Error
+}
@@ -2,6 +2,7 @@ package infrastructure
 
 import (
 	"context"
+	"time"
 
 	"github.com/knetic0/production-ready-go-cqrs/domain"
 	"gorm.io/gorm"
@@ -18,3 +19,17 @@ func NewRefreshTokenRepositoryAdapter(db *gorm.DB) *RefreshTokenRepositoryAdapte
 func (r *RefreshTokenRepositoryAdapter) Create(ctx context.Context, refreshToken *domain.RefreshToken) error {
 	return r.db.WithContext(ctx).Create(refreshToken).Error
 }
+
+func (r *RefreshTokenRepositoryAdapter) RevokeByUser(ctx context.Context, userId string) error {
+	return r.db.WithContext(ctx).
+		Model(&domain.RefreshToken{}).
+		Where("user_id = ? AND is_revoked = ?", userId, false).
+		Update("is_revoked", true).Error
+}
+
+func (r *RefreshTokenRepositoryAdapter) DeleteStale(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).
+		Where("is_used OR is_revoked OR expires_at < ?", expiredBefore).
+		Delete(&domain.RefreshToken{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,323 @@
+// Package scheduler runs recurring tasks on cron schedules. Of all replicas
+// only the one holding the leader lock runs them, so each scheduled run
+// happens once.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/cron"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+)
+
+var (
+	leader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "scheduler_leader",
+		Help: "Whether this instance leads the scheduler and runs its tasks",
+	})
+	taskRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_task_runs_total",
+		Help: "Runs of scheduled tasks by outcome: succeeded, failed or skipped when another instance ran them",
+	}, []string{"task", "outcome"})
+	taskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduler_task_duration_seconds",
+		Help:    "Duration of scheduled task runs",
+		Buckets: []float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+	}, []string{"task"})
+	taskAffected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduler_task_affected_rows_total",
+		Help: "Rows deleted or changed by scheduled tasks",
+	}, []string{"task"})
+	taskLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduler_task_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run of a scheduled task",
+	}, []string{"task"})
+)
+
+func init() {
+	prometheus.MustRegister(leader, taskRuns, taskDuration, taskAffected, taskLastSuccess)
+}
+
+// Task is recurring work, returning how many rows it deleted or changed.
+type Task interface {
+	Run(ctx context.Context) (int64, error)
+}
+
+type Config struct {
+	// Location is the time zone schedules are read in.
+	Location *time.Location
+	// LeaderCheckInterval is how often the leader checks that it still holds
+	// the lock and the other replicas try to take it.
+	LeaderCheckInterval time.Duration
+}
+
+type scheduledTask struct {
+	name     string
+	schedule *cron.Schedule
+	task     Task
+	timeout  time.Duration
+}
+
+// Scheduler runs the registered tasks while it leads. Constructing and
+// registering with it does not touch the database.
+type Scheduler struct {
+	lock     domain.LeaderLock
+	runs     domain.TaskRunRepository
+	config   Config
+	instance string
+	tasks    []*scheduledTask
+
+	mu      sync.Mutex
+	started bool
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func NewScheduler(lock domain.LeaderLock, runs domain.TaskRunRepository, config Config) *Scheduler {
+	hostname, _ := os.Hostname()
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		lock:     lock,
+		runs:     runs,
+		config:   config,
+		instance: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Register runs task on schedule, each run bounded by timeout unless it is
+// zero. Tasks are registered before the scheduler is started.
+func (s *Scheduler) Register(name string, schedule *cron.Schedule, task Task, timeout time.Duration) {
+	s.tasks = append(s.tasks, &scheduledTask{name: name, schedule: schedule, task: task, timeout: timeout})
+}
+
+// Start competes for the lead, and runs the tasks whenever this replica
+// wins it. A scheduler without tasks does not take part.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.closed {
+		return
+	}
+	s.started = true
+
+	if len(s.tasks) == 0 {
+		close(s.done)
+		return
+	}
+	go s.lead()
+}
+
+// Close stops starting runs and waits for the running ones until ctx
+// expires, when they are cancelled. The lead is given up after, for
+// another replica to take over.
+func (s *Scheduler) Close(ctx context.Context) error {
+	s.mu.Lock()
+	started := s.started
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	if !started {
+		return nil
+	}
+
+	var err error
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+		err = ctx.Err()
+	}
+	s.cancel()
+
+	if len(s.tasks) == 0 {
+		return err
+	}
+	if releaseErr := s.lock.Release(ctx); releaseErr != nil && err == nil {
+		err = releaseErr
+	}
+	return err
+}
+
+// lead runs the tasks for as long as this replica holds the lock, and
+// tries to take it whenever it does not.
+func (s *Scheduler) lead() {
+	defer close(s.done)
+
+	var (
+		term    context.CancelFunc
+		running sync.WaitGroup
+	)
+	resign := func() {
+		if term == nil {
+			return
+		}
+		term()
+		running.Wait()
+		term = nil
+		leader.Set(0)
+	}
+	defer resign()
+
+	ticker := time.NewTicker(s.config.LeaderCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if term == nil {
+			acquired, err := s.lock.TryAcquire(s.ctx)
+			if err != nil {
+				zap.L().Error("failed to acquire the scheduler lock", zap.Error(err))
+			}
+			if acquired {
+				zap.L().Info("leading the scheduler", zap.String("instance", s.instance))
+				leader.Set(1)
+				term = s.begin(&running)
+			}
+		} else if err := s.lock.Check(s.ctx); err != nil {
+			// Another replica may take the lead from now on, so runs in
+			// progress are cancelled rather than finished.
+			zap.L().Error("lost the scheduler lock", zap.Error(err))
+			resign()
+		}
+
+		select {
+		case <-s.stop:
+			// The tasks start no more runs and those in progress are let
+			// finish, unless Close runs out of time and cancels them.
+			running.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// begin schedules the tasks for a term as leader, returning the function
+// that ends it.
+func (s *Scheduler) begin(running *sync.WaitGroup) context.CancelFunc {
+	ctx, cancel := context.WithCancel(s.ctx)
+	for _, task := range s.tasks {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			s.schedule(ctx, task)
+		}()
+	}
+	return cancel
+}
+
+// schedule runs task at each of its scheduled times until ctx is cancelled
+// or the scheduler is closed. A run that overlaps the next scheduled time
+// skips it.
+func (s *Scheduler) schedule(ctx context.Context, task *scheduledTask) {
+	for {
+		next := task.schedule.Next(time.Now().In(s.config.Location))
+		if next.IsZero() {
+			zap.L().Warn("scheduled task never runs again", zap.String("task", task.name))
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, task, next)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, task *scheduledTask, scheduledAt time.Time) {
+	tracer := otel.Tracer("app-go/scheduler")
+	ctx, span := tracer.Start(ctx, "Task."+task.name)
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("task.name", task.name),
+		attribute.String("task.scheduled_at", scheduledAt.Format(time.RFC3339)),
+	)
+
+	start := time.Now()
+	run := &domain.TaskRun{
+		Id:          uuid.NewString(),
+		Task:        task.name,
+		ScheduledAt: scheduledAt.UTC(),
+		Status:      domain.TaskRunning,
+		Instance:    s.instance,
+		StartedAt:   start,
+	}
+	// The run is recorded first, so a replica that took the lead over right
+	// after this one ran the task cannot run it again for the same time.
+	started, err := s.runs.Start(ctx, run)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "start failed")
+		zap.L().Error("failed to record scheduled task run", zap.String("task", task.name), zap.Error(err))
+		return
+	}
+	if !started {
+		taskRuns.WithLabelValues(task.name, "skipped").Inc()
+		span.SetStatus(codes.Ok, "already ran")
+		return
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	if task.timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, task.timeout)
+	}
+	affected, err := task.task.Run(runCtx)
+	cancel()
+
+	finished := time.Now()
+	run.Affected, run.FinishedAt, run.Status = affected, &finished, domain.TaskSucceeded
+	if err != nil {
+		run.Status, run.Error = domain.TaskFailed, err.Error()
+	}
+	// The outcome is recorded even when the run was cancelled, to say so.
+	if finishErr := s.runs.Finish(context.WithoutCancel(ctx), run); finishErr != nil {
+		zap.L().Error("failed to record scheduled task outcome", zap.String("task", task.name), zap.Error(finishErr))
+	}
+
+	taskRuns.WithLabelValues(task.name, string(run.Status)).Inc()
+	taskDuration.WithLabelValues(task.name).Observe(finished.Sub(start).Seconds())
+	taskAffected.WithLabelValues(task.name).Add(float64(affected))
+	span.SetAttributes(attribute.Int64("task.affected", affected))
+
+	fields := []zap.Field{
+		zap.String("task", task.name),
+		zap.String("runId", run.Id),
+		zap.Int64("affected", affected),
+		zap.Duration("duration", finished.Sub(start)),
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "task failed")
+		zap.L().Error("scheduled task failed", append(fields, zap.Error(err))...)
+		return
+	}
+	taskLastSuccess.WithLabelValues(task.name).Set(float64(finished.Unix()))
+	span.SetStatus(codes.Ok, "succeeded")
+	zap.L().Info("scheduled task succeeded", fields...)
+}
@@ -0,0 +1,38 @@
+package infrastructure
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var securityEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "security_events_total",
+	Help: "Number of security events such as account lockouts",
+}, []string{"type"})
+
+func init() {
+	prometheus.MustRegister(securityEventsTotal)
+}
+
+// LogSecurityEventPublisher logs security events and counts them in
+// Prometheus, where alerting rules pick them up.
+type LogSecurityEventPublisher struct{}
+
+func NewLogSecurityEventPublisher() *LogSecurityEventPublisher {
+	return &LogSecurityEventPublisher{}
+}
+
+func (p *LogSecurityEventPublisher) Publish(ctx context.Context, event domain.SecurityEvent) {
+	securityEventsTotal.WithLabelValues(event.Type).Inc()
+	zap.L().Warn("security event",
+		zap.String("type", event.Type),
+		zap.String("key", event.Key),
+		zap.String("clientIp", event.ClientIP),
+		zap.Int("failures", event.Failures),
+		zap.Time("until", event.Until),
+		zap.Time("occurredAt", event.OccurredAt),
+	)
+}
@@ -0,0 +1,39 @@
+package infrastructure
+
+import (
+	"context"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TaskRunRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewTaskRunRepositoryAdapter(db *gorm.DB) *TaskRunRepositoryAdapter {
+	return &TaskRunRepositoryAdapter{db: db}
+}
+
+func (r *TaskRunRepositoryAdapter) Start(ctx context.Context, run *domain.TaskRun) (bool, error) {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(run)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *TaskRunRepositoryAdapter) Finish(ctx context.Context, run *domain.TaskRun) error {
+	run.Error = truncate(run.Error, 2048)
+	return r.db.WithContext(ctx).
+		Model(run).
+		Select("Status", "Affected", "Error", "FinishedAt").
+		Updates(run).Error
+}
+
+func (r *TaskRunRepositoryAdapter) DeleteStarted(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("started_at < ?", before).Delete(&domain.TaskRun{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,190 @@
+package infrastructure
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultTenantId owns the rows that existed before multi-tenancy, through
+// the column default of tenant_id.
+const DefaultTenantId = "default"
+
+const tenantIdField = "TenantId"
+
+// registerTenantCallbacks scopes every statement on a model with a TenantId
+// field to the tenant of the statement context: reads, updates and deletes
+// are filtered by it, creates are stamped with it and records of another
+// tenant are refused. Statements without a
+// tenant fail unless the context was explicitly opened up with
+// tenant.AllTenants. Raw SQL is not covered.
+func registerTenantCallbacks(db *gorm.DB, rowLevelSecurity bool) error {
+	registrations := []error{
+		db.Callback().Create().Before("gorm:create").Register("tenant:create", tenantCreate),
+		db.Callback().Query().Before("gorm:query").Register("tenant:query", tenantFilter),
+		db.Callback().Update().Before("gorm:update").Register("tenant:update", tenantGuard),
+		db.Callback().Delete().Before("gorm:delete").Register("tenant:delete", tenantGuard),
+		db.Callback().Row().Before("gorm:row").Register("tenant:row", tenantFilter),
+	}
+
+	// Row-level security reads the tenant from a transaction local setting,
+	// so queries, which gorm runs without a transaction, get one as well.
+	// Row and Raw statements do not, and see no tenant-owned rows.
+	if rowLevelSecurity {
+		registrations = append(registrations,
+			db.Callback().Query().Before("gorm:query").Register("tenant:begin_transaction", callbacks.BeginTransaction),
+			db.Callback().Query().After("tenant:begin_transaction").Before("gorm:query").Register("tenant:set_config", tenantSetConfig),
+			db.Callback().Query().After("gorm:after_query").Register("tenant:commit_or_rollback_transaction", callbacks.CommitOrRollbackTransaction),
+			db.Callback().Create().After("gorm:begin_transaction").Register("tenant:set_config", tenantSetConfig),
+			db.Callback().Update().After("gorm:begin_transaction").Register("tenant:set_config", tenantSetConfig),
+			db.Callback().Delete().After("gorm:begin_transaction").Register("tenant:set_config", tenantSetConfig),
+		)
+	}
+
+	for _, err := range registrations {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tenantField(db *gorm.DB) *schema.Field {
+	if db.Statement.Schema == nil {
+		return nil
+	}
+	return db.Statement.Schema.LookUpField(tenantIdField)
+}
+
+func tenantCreate(db *gorm.DB) {
+	field := tenantField(db)
+	if field == nil || db.Error != nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	id, ok := tenant.FromContext(ctx)
+	if !ok && !tenant.IsAllTenants(ctx) {
+		db.AddError(tenant.ErrMissingTenant)
+		return
+	}
+
+	eachRecord(db.Statement.ReflectValue, func(record reflect.Value) {
+		current, isZero := field.ValueOf(ctx, record)
+		if isZero {
+			if !ok {
+				db.AddError(tenant.ErrMissingTenant)
+				return
+			}
+			_ = field.Set(ctx, record, id)
+			return
+		}
+		if ok && current != id {
+			db.AddError(tenant.ErrForeignRecord)
+		}
+	})
+}
+
+// tenantGuard filters updates and deletes like queries, and refuses records
+// loaded for another tenant instead of letting the filter turn the statement
+// into a silent no-op.
+func tenantGuard(db *gorm.DB) {
+	field := tenantField(db)
+	if field == nil || db.Error != nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	if id, ok := tenant.FromContext(ctx); ok {
+		eachRecord(db.Statement.ReflectValue, func(record reflect.Value) {
+			if current, isZero := field.ValueOf(ctx, record); !isZero && current != id {
+				db.AddError(tenant.ErrForeignRecord)
+			}
+		})
+	}
+	tenantFilter(db)
+}
+
+func eachRecord(records reflect.Value, fn func(record reflect.Value)) {
+	switch records.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < records.Len(); i++ {
+			fn(reflect.Indirect(records.Index(i)))
+		}
+	case reflect.Struct:
+		fn(records)
+	}
+}
+
+func tenantFilter(db *gorm.DB) {
+	field := tenantField(db)
+	if field == nil || db.Error != nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	if tenant.IsAllTenants(ctx) {
+		return
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		db.AddError(tenant.ErrMissingTenant)
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: id},
+	}})
+}
+
+func tenantSetConfig(db *gorm.DB) {
+	if tenantField(db) == nil || db.Error != nil {
+		return
+	}
+
+	ctx := db.Statement.Context
+	id, _ := tenant.FromContext(ctx)
+	allTenants := "off"
+	if tenant.IsAllTenants(ctx) {
+		allTenants = "on"
+	}
+
+	_, err := db.Statement.ConnPool.ExecContext(ctx,
+		"SELECT set_config('app.tenant_id', $1, true), set_config('app.all_tenants', $2, true)", id, allTenants)
+	if err != nil {
+		db.AddError(err)
+	}
+}
+
+// enableRowLevelSecurity installs the tenant isolation policy on the tables
+// of the given models. FORCE makes it apply to the table owner as well,
+// which the application usually connects as.
+func enableRowLevelSecurity(db *gorm.DB, models ...any) error {
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+
+		table := stmt.Quote(stmt.Schema.Table)
+		policy := "tenant_id = current_setting('app.tenant_id', true) OR current_setting('app.all_tenants', true) = 'on'"
+		statements := []string{
+			fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", table),
+			fmt.Sprintf("ALTER TABLE %s FORCE ROW LEVEL SECURITY", table),
+			fmt.Sprintf("DROP POLICY IF EXISTS tenant_isolation ON %s", table),
+			fmt.Sprintf("CREATE POLICY tenant_isolation ON %s USING (%s) WITH CHECK (%s)", table, policy, policy),
+		}
+		for _, statement := range statements {
+			if err := db.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+// recordingPool stands in for the database. Statements are only built, as
+// the session runs dry, apart from the set_config calls row-level security
+// makes on the connection directly.
+type recordingPool struct {
+	execs [][]any
+}
+
+func (p *recordingPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *recordingPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	p.execs = append(p.execs, append([]any{query}, args...))
+	return driver.RowsAffected(0), nil
+}
+
+func (p *recordingPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (p *recordingPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return nil
+}
+
+func (p *recordingPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return p, nil
+}
+
+func (p *recordingPool) Commit() error {
+	return nil
+}
+
+func (p *recordingPool) Rollback() error {
+	return nil
+}
+
+func newTenantDB(t *testing.T, rowLevelSecurity bool) (*gorm.DB, *recordingPool) {
+	t.Helper()
+	pool := &recordingPool{}
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true, ConnPool: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerTenantCallbacks(db, rowLevelSecurity); err != nil {
+		t.Fatal(err)
+	}
+	return db, pool
+}
+
+func tenantContext(id string) context.Context {
+	return tenant.WithTenant(context.Background(), id, tenant.SourceHeader)
+}
+
+// filtersByTenant reports whether the statement is filtered by tenant and
+// with which id.
+func filtersByTenant(statement *gorm.Statement) (any, bool) {
+	sql := statement.SQL.String()
+	if !strings.Contains(sql, "tenant_id") {
+		return nil, false
+	}
+	return statement.Vars[strings.Count(sql[:strings.Index(sql, "tenant_id")], "?")], true
+}
+
+func TestTenantFilter(t *testing.T) {
+	db, _ := newTenantDB(t, false)
+	statements := map[string]func(ctx context.Context) *gorm.DB{
+		"query": func(ctx context.Context) *gorm.DB {
+			var users []domain.User
+			return db.WithContext(ctx).Where("email = ?", "ada@example.com").Find(&users)
+		},
+		"update": func(ctx context.Context) *gorm.DB {
+			return db.WithContext(ctx).Model(&domain.User{}).Where("id = ?", "user-1").Update("first_name", "Ada")
+		},
+		"delete": func(ctx context.Context) *gorm.DB {
+			return db.WithContext(ctx).Where("user_id = ?", "user-1").Delete(&domain.RefreshToken{})
+		},
+	}
+	for name, statement := range statements {
+		t.Run(name, func(t *testing.T) {
+			result := statement(tenantContext("acme"))
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if id, ok := filtersByTenant(result.Statement); !ok || id != "acme" {
+				t.Fatalf("not filtered by tenant acme: %s %v", result.Statement.SQL.String(), result.Statement.Vars)
+			}
+
+			result = statement(tenant.AllTenants(context.Background()))
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			if _, ok := filtersByTenant(result.Statement); ok {
+				t.Fatalf("filtered by tenant across all tenants: %s", result.Statement.SQL.String())
+			}
+
+			if err := statement(context.Background()).Error; !errors.Is(err, tenant.ErrMissingTenant) {
+				t.Fatalf("without a tenant: err = %v, want %v", err, tenant.ErrMissingTenant)
+			}
+		})
+	}
+}
+
+func TestTenantFilterSkipsSharedModels(t *testing.T) {
+	db, _ := newTenantDB(t, false)
+	var tenants []domain.Tenant
+	result := db.WithContext(context.Background()).Find(&tenants)
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	if _, ok := filtersByTenant(result.Statement); ok {
+		t.Fatalf("shared model filtered by tenant: %s", result.Statement.SQL.String())
+	}
+}
+
+func TestTenantCreate(t *testing.T) {
+	db, _ := newTenantDB(t, false)
+
+	user := &domain.User{Id: "user-1"}
+	if err := db.WithContext(tenantContext("acme")).Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.TenantId != "acme" {
+		t.Fatalf("tenant = %q, want acme", user.TenantId)
+	}
+
+	users := []*domain.User{{Id: "user-2"}, {Id: "user-3", TenantId: "acme"}}
+	if err := db.WithContext(tenantContext("acme")).Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if users[0].TenantId != "acme" || users[1].TenantId != "acme" {
+		t.Fatalf("tenants = %q, %q, want acme", users[0].TenantId, users[1].TenantId)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		user *domain.User
+		want error
+	}{
+		{"record of another tenant", tenantContext("acme"), &domain.User{Id: "user-4", TenantId: "globex"}, tenant.ErrForeignRecord},
+		{"without a tenant", context.Background(), &domain.User{Id: "user-4"}, tenant.ErrMissingTenant},
+		{"across all tenants without one on the record", tenant.AllTenants(context.Background()), &domain.User{Id: "user-4"}, tenant.ErrMissingTenant},
+		{"across all tenants with one on the record", tenant.AllTenants(context.Background()), &domain.User{Id: "user-4", TenantId: "globex"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := db.WithContext(test.ctx).Create(test.user).Error; !errors.Is(err, test.want) {
+				t.Fatalf("err = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestTenantGuard(t *testing.T) {
+	db, _ := newTenantDB(t, false)
+	statements := map[string]func(ctx context.Context, user *domain.User) error{
+		"save": func(ctx context.Context, user *domain.User) error {
+			return db.WithContext(ctx).Save(user).Error
+		},
+		"update": func(ctx context.Context, user *domain.User) error {
+			return db.WithContext(ctx).Model(user).Update("first_name", "Ada").Error
+		},
+		"delete": func(ctx context.Context, user *domain.User) error {
+			return db.WithContext(ctx).Delete(user).Error
+		},
+	}
+	for name, statement := range statements {
+		t.Run(name, func(t *testing.T) {
+			if err := statement(tenantContext("acme"), &domain.User{Id: "user-1", TenantId: "globex"}); !errors.Is(err, tenant.ErrForeignRecord) {
+				t.Fatalf("record of another tenant: err = %v, want %v", err, tenant.ErrForeignRecord)
+			}
+			if err := statement(tenantContext("acme"), &domain.User{Id: "user-1", TenantId: "acme"}); err != nil {
+				t.Fatalf("record of the tenant: %v", err)
+			}
+			if err := statement(tenant.AllTenants(context.Background()), &domain.User{Id: "user-1", TenantId: "globex"}); err != nil {
+				t.Fatalf("across all tenants: %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantSetConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []any
+	}{
+		{"tenant", tenantContext("acme"), []any{"acme", "off"}},
+		{"all tenants", tenant.AllTenants(context.Background()), []any{"", "on"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, pool := newTenantDB(t, true)
+			statements := []func() error{
+				func() error { return db.WithContext(test.ctx).Find(&[]domain.User{}).Error },
+				func() error {
+					return db.WithContext(test.ctx).Create(&domain.User{Id: "user-1", TenantId: "acme"}).Error
+				},
+				func() error {
+					return db.WithContext(test.ctx).Model(&domain.User{}).Where("id = ?", "user-1").Update("first_name", "Ada").Error
+				},
+				func() error { return db.WithContext(test.ctx).Where("id = ?", "user-1").Delete(&domain.User{}).Error },
+			}
+			for i, statement := range statements {
+				if err := statement(); err != nil {
+					t.Fatal(err)
+				}
+				if len(pool.execs) != i+1 {
+					t.Fatalf("statement %d: %d set_config calls, want %d", i, len(pool.execs), i+1)
+				}
+				exec := pool.execs[i]
+				if !strings.Contains(exec[0].(string), "set_config('app.tenant_id'") || !slices.Equal(exec[1:], test.want) {
+					t.Fatalf("statement %d: exec %v, want set_config with %v", i, exec, test.want)
+				}
+			}
+
+			// Shared models are not covered by policies.
+			if err := db.WithContext(test.ctx).Find(&[]domain.Tenant{}).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(pool.execs) != len(statements) {
+				t.Fatalf("set_config called for a shared model: %v", pool.execs[len(statements):])
+			}
+		})
+	}
+}
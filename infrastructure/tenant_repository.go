@@ -0,0 +1,41 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+)
+
+type TenantRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewTenantRepositoryAdapter(db *gorm.DB) *TenantRepositoryAdapter {
+	return &TenantRepositoryAdapter{db: db}
+}
+
+func (r *TenantRepositoryAdapter) Create(ctx context.Context, tenant *domain.Tenant) error {
+	return r.db.WithContext(ctx).Create(tenant).Error
+}
+
+func (r *TenantRepositoryAdapter) Get(ctx context.Context, id string) (*domain.Tenant, error) {
+	var tenant domain.Tenant
+	err := r.db.WithContext(ctx).Where("id = ?", id).Take(&tenant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tenant, nil
+}
+
+func (r *TenantRepositoryAdapter) List(ctx context.Context) ([]domain.Tenant, error) {
+	var tenants []domain.Tenant
+	if err := r.db.WithContext(ctx).Order("id").Find(&tenants).Error; err != nil {
+		return nil, err
+	}
+	return tenants, nil
+}
@@ -0,0 +1,31 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+)
+
+type UsedMfaChallengeRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewUsedMfaChallengeRepositoryAdapter(db *gorm.DB) *UsedMfaChallengeRepositoryAdapter {
+	return &UsedMfaChallengeRepositoryAdapter{db: db}
+}
+
+func (r *UsedMfaChallengeRepositoryAdapter) Use(ctx context.Context, id string, expiresAt time.Time) error {
+	err := r.db.WithContext(ctx).Create(&domain.UsedMfaChallenge{Id: id, ExpiresAt: expiresAt}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return domain.ErrAlreadyExists
+	}
+	return err
+}
+
+func (r *UsedMfaChallengeRepositoryAdapter) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&domain.UsedMfaChallenge{})
+	return result.RowsAffected, result.Error
+}
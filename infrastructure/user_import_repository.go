@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"gorm.io/gorm"
+)
+
+type UserImportRepositoryAdapter struct {
+	db *gorm.DB
+}
+
+func NewUserImportRepositoryAdapter(db *gorm.DB) *UserImportRepositoryAdapter {
+	return &UserImportRepositoryAdapter{db: db}
+}
+
+func (r *UserImportRepositoryAdapter) Create(ctx context.Context, userImport *domain.UserImport) error {
+	return r.db.WithContext(ctx).Create(userImport).Error
+}
+
+func (r *UserImportRepositoryAdapter) Get(ctx context.Context, id string) (*domain.UserImport, error) {
+	var userImport domain.UserImport
+	err := r.db.WithContext(ctx).Where("id = ?", id).Take(&userImport).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userImport, nil
+}
+
+func (r *UserImportRepositoryAdapter) Update(ctx context.Context, userImport *domain.UserImport) error {
+	return r.db.WithContext(ctx).Save(userImport).Error
+}
+
+func (r *UserImportRepositoryAdapter) UpdateProgress(ctx context.Context, userImport *domain.UserImport) error {
+	return r.db.WithContext(ctx).
+		Model(userImport).
+		Select("Status", "Processed", "Created", "Duplicates", "Invalid", "StartedAt", "Rows").
+		Updates(userImport).Error
+}
+
+func (r *UserImportRepositoryAdapter) DeleteFinished(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("finished_at < ?", before).Delete(&domain.UserImport{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *UserImportRepositoryAdapter) DeleteUnfinished(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("finished_at IS NULL AND created_at < ?", before).Delete(&domain.UserImport{})
+	return result.RowsAffected, result.Error
+}
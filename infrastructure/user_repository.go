@@ -2,13 +2,16 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/knetic0/production-ready-go-cqrs/domain"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepositoryAdapter struct {
@@ -33,6 +36,9 @@ func (r *UserRepositoryAdapter) Create(ctx context.Context, user *domain.User) e
 	if err := r.db.WithContext(ctx).Create(user).Error; err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "db.create failed")
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return domain.ErrAlreadyExists
+		}
 		return err
 	}
 
@@ -40,6 +46,50 @@ func (r *UserRepositoryAdapter) Create(ctx context.Context, user *domain.User) e
 	return nil
 }
 
+func (r *UserRepositoryAdapter) Update(ctx context.Context, user *domain.User) error {
+	tracer := otel.Tracer("app-go/repository.user")
+	ctx, span := tracer.Start(ctx, "UserRepository.Update")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("user.id", user.Id),
+	)
+
+	if err := r.db.WithContext(ctx).Save(user).Error; err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "db.save failed")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "updated")
+	return nil
+}
+
+func (r *UserRepositoryAdapter) AdvanceTotpCounter(ctx context.Context, id string, counter int64) (bool, error) {
+	tracer := otel.Tracer("app-go/repository.user")
+	ctx, span := tracer.Start(ctx, "UserRepository.AdvanceTotpCounter")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.String("user.id", id),
+	)
+
+	result := r.db.WithContext(ctx).
+		Model(&domain.User{}).
+		Where("id = ? AND totp_last_counter < ?", id, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		span.SetStatus(codes.Error, "db.update failed")
+		return false, result.Error
+	}
+
+	span.SetStatus(codes.Ok, "updated")
+	return result.RowsAffected > 0, nil
+}
+
 func (r *UserRepositoryAdapter) Get(ctx context.Context, id string) (*domain.User, error) {
 	tracer := otel.Tracer("app-go/repository.user")
 	ctx, span := tracer.Start(ctx, "UserRepository.Get")
@@ -101,6 +151,128 @@ func (r *UserRepositoryAdapter) List(ctx context.Context) ([]domain.User, error)
 	return users, nil
 }
 
+// streamBatchSize is how many rows Stream fetches from its cursor at a time.
+const streamBatchSize = 500
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Stream reads the users through a server-side cursor in a read-only
+// transaction, so the rows are fetched in batches as fn consumes them
+// rather than all at once. The query is built by gorm in dry run mode so
+// that the tenant callbacks scope it like any other.
+func (r *UserRepositoryAdapter) Stream(ctx context.Context, filter domain.UserFilter, fn func(*domain.User) error) error {
+	tracer := otel.Tracer("app-go/repository.user")
+	ctx, span := tracer.Start(ctx, "UserRepository.Stream")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("db.system", "postgresql"))
+
+	count := 0
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SET TRANSACTION READ ONLY").Error; err != nil {
+			return err
+		}
+
+		query := tx.Session(&gorm.Session{DryRun: true}).Model(&domain.User{}).Scopes(userFilter(filter)).Order("id").Find(&[]domain.User{})
+		if query.Error != nil {
+			return query.Error
+		}
+		if _, err := tx.Statement.ConnPool.ExecContext(ctx, "DECLARE user_stream NO SCROLL CURSOR FOR "+query.Statement.SQL.String(), query.Statement.Vars...); err != nil {
+			return err
+		}
+
+		for {
+			var batch []domain.User
+			if err := tx.Raw(fmt.Sprintf("FETCH FORWARD %d FROM user_stream", streamBatchSize)).Scan(&batch).Error; err != nil {
+				return err
+			}
+			for i := range batch {
+				if err := fn(&batch[i]); err != nil {
+					return err
+				}
+				count++
+			}
+			if len(batch) < streamBatchSize {
+				return nil
+			}
+		}
+	})
+
+	span.SetAttributes(attribute.Int("result.count", count))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "stream failed")
+		return err
+	}
+
+	span.SetStatus(codes.Ok, "ok")
+	return nil
+}
+
+// CreateMissing leaves it to ON CONFLICT DO NOTHING to skip taken emails,
+// which also covers users registered while the batches are inserted, and
+// reads back which of the ids made it in.
+func (r *UserRepositoryAdapter) CreateMissing(ctx context.Context, batches [][]*domain.User) ([]string, error) {
+	tracer := otel.Tracer("app-go/repository.user")
+	ctx, span := tracer.Start(ctx, "UserRepository.CreateMissing")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("db.system", "postgresql"),
+		attribute.Int("batch.count", len(batches)),
+	)
+
+	var created []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, batch := range batches {
+			if len(batch) == 0 {
+				continue
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(batch).Error; err != nil {
+				return err
+			}
+
+			ids := make([]string, len(batch))
+			for i, user := range batch {
+				ids[i] = user.Id
+			}
+			var inserted []string
+			if err := tx.Model(&domain.User{}).Where("id IN ?", ids).Pluck("id", &inserted).Error; err != nil {
+				return err
+			}
+			created = append(created, inserted...)
+		}
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "db.create failed")
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("result.count", len(created)))
+	span.SetStatus(codes.Ok, "created")
+	return created, nil
+}
+
+func userFilter(filter domain.UserFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.Email != "" {
+			db = db.Where("email ILIKE ?", "%"+likeEscaper.Replace(filter.Email)+"%")
+		}
+		if filter.Locale != "" {
+			db = db.Where("locale = ?", filter.Locale)
+		}
+		if filter.EmailVerified != nil {
+			db = db.Where("email_verified = ?", *filter.EmailVerified)
+		}
+		if filter.MfaEnabled != nil {
+			db = db.Where("mfa_enabled = ?", *filter.MfaEnabled)
+		}
+		return db
+	}
+}
+
 func (r *UserRepositoryAdapter) getByField(ctx context.Context, field string, value any) (*domain.User, error) {
 	tracer := otel.Tracer("app-go/repository.user")
 	ctx, span := tracer.Start(ctx, "UserRepository.getByField")
@@ -116,6 +288,9 @@ func (r *UserRepositoryAdapter) getByField(ctx context.Context, field string, va
 	if err := r.db.WithContext(ctx).Where(fmt.Sprintf("%s = ?", field), value).Take(&u).Error; err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, "getByField failed")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, domain.ErrNotFound
+		}
 		return nil, err
 	}
 
@@ -1,30 +1,46 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/go-playground/validator/v10"
-	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/contrib/otelfiber"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/adaptor"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/hashicorp/go-retryablehttp"
-	"github.com/knetic0/production-ready-go-cqrs/app/auth"
-	"github.com/knetic0/production-ready-go-cqrs/app/healthcheck"
+	"github.com/knetic0/production-ready-go-cqrs/app/maintenance"
 	"github.com/knetic0/production-ready-go-cqrs/app/user"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
 	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure/jobs"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure/notification"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure/oidc"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure/scheduler"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/codec"
 	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/cron"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/health"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/lifecycle"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/passwordpolicy"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/projection"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/requestctx"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/security"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
@@ -36,6 +52,8 @@ import (
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
 )
 
 // Prometheus metrics
@@ -71,6 +89,13 @@ func RequestDurationMiddleware() fiber.Handler {
 	}
 }
 
+func ClientIPMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(requestctx.WithClientIP(c.UserContext(), c.IP()))
+		return c.Next()
+	}
+}
+
 type Request any
 type Response any
 
@@ -78,57 +103,335 @@ type HandlerInterface[TReq Request, TRes Response] interface {
 	Handle(ctx context.Context, request *TReq) (*TRes, error)
 }
 
-var validate = validator.New()
+// redirectResponse is implemented by responses that send the client to
+// another location instead of rendering a body.
+type redirectResponse interface {
+	RedirectURL() string
+}
+
+// cookieResponse is implemented by responses that set cookies along with
+// the rest of the response.
+type cookieResponse interface {
+	Cookies() []*http.Cookie
+}
+
+// streamResponse is implemented by responses that write their body while
+// it is produced, like exports, instead of being encoded by a codec.
+type streamResponse interface {
+	// MediaTypes lists the content types the response may have, for the
+	// documentation.
+	MediaTypes() []string
+	ContentType() string
+	Stream(ctx context.Context, w io.Writer) error
+}
+
+// uploadRequest is implemented by requests that take the body as it is,
+// like uploaded files, instead of having it decoded by a codec.
+type uploadRequest interface {
+	// MediaTypes lists the content types the body may have, for the
+	// documentation.
+	MediaTypes() []string
+	SetBody(contentType string, body []byte) error
+}
+
+var validate = newValidator()
+
+// validateRequest validates a request outside of a transport, like the rows
+// of an import.
+func validateRequest(request any) error {
+	if err := validate.Struct(request); err != nil {
+		return validationError(err)
+	}
+	return nil
+}
+
+// newValidator reports fields by the name clients send them with, e.g.
+// "firstName" instead of "FirstName".
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "query", "params", "reqHeader", "cookie", "form"} {
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return field.Name
+	})
+	return v
+}
+
+func validationError(err error) error {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return apperror.New(apperror.CodeInvalidArgument, err.Error())
+	}
+
+	fields := make([]apperror.FieldError, len(validationErrors))
+	for i, fieldError := range validationErrors {
+		message := "failed on the '" + fieldError.Tag() + "' rule"
+		if fieldError.Param() != "" {
+			message = "failed on the '" + fieldError.Tag() + "=" + fieldError.Param() + "' rule"
+		}
+		fields[i] = apperror.FieldError{Field: fieldError.Field(), Rule: fieldError.Tag(), Message: message}
+	}
+	return apperror.Validation(fields...)
+}
+
+// errorResponse is the body of every failed request.
+type errorResponse struct {
+	Error  string                `json:"error"`
+	Fields []apperror.FieldError `json:"fields,omitempty"`
+}
+
+func errorBody(err error) errorResponse {
+	return errorResponse{Error: err.Error(), Fields: apperror.FieldsOf(err)}
+}
+
+// handle runs handler for the request, decoding and encoding bodies with
+// the codecs the client negotiates. A non-nil projector trims the response
+// to the fields asked for with ?fields=.
+func handle[TReq Request, TRes Response](handler HandlerInterface[TReq, TRes], projector *projection.Projector) fiber.Handler {
+	redirects := reflect.PointerTo(reflect.TypeFor[TRes]()).Implements(redirectResponseType)
+	streams := reflect.PointerTo(reflect.TypeFor[TRes]()).Implements(streamResponseType)
 
-func handle[TReq Request, TRes Response](handler HandlerInterface[TReq, TRes]) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		var req TReq
 
-		if err := c.BodyParser(&req); err != nil && !errors.Is(err, fiber.ErrUnprocessableEntity) {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		if err := decodeBody(c, &req); err != nil {
+			status := errorStatus(err)
+			if status == fiber.StatusInternalServerError {
+				status = fiber.StatusBadRequest
+			}
+			return c.Status(status).JSON(errorResponse{Error: err.Error()})
 		}
 
 		if err := c.ParamsParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(fiber.StatusBadRequest).JSON(errorResponse{Error: err.Error()})
 		}
 
 		if err := c.QueryParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(fiber.StatusBadRequest).JSON(errorResponse{Error: err.Error()})
 		}
 
 		if err := c.ReqHeaderParser(&req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(fiber.StatusBadRequest).JSON(errorResponse{Error: err.Error()})
+		}
+
+		if err := c.CookieParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(errorResponse{Error: err.Error()})
 		}
 
 		if err := validate.Struct(req); err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+			return c.Status(fiber.StatusBadRequest).JSON(errorBody(validationError(err)))
+		}
+
+		var fields []string
+		if value := c.Query("fields"); projector != nil && value != "" {
+			var err error
+			if fields, err = projector.Parse(value); err != nil {
+				return c.Status(errorStatus(err)).JSON(errorBody(err))
+			}
+		}
+
+		// Redirects and streams have no body to negotiate the format of.
+		var responseCodec codec.Codec
+		if !redirects && !streams {
+			responseType := reflect.TypeFor[TRes]()
+			if len(fields) > 0 {
+				responseType = reflect.TypeFor[map[string]any]()
+			}
+			var err error
+			if responseCodec, err = codecs.Negotiate(c.Get(fiber.HeaderAccept), responseType); err != nil {
+				return c.Status(errorStatus(err)).JSON(errorBody(err))
+			}
 		}
 
 		ctx := c.UserContext()
 		res, err := handler.Handle(ctx, &req)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+			status := errorStatus(err)
+			if status == fiber.StatusInternalServerError {
+				logRequestError(ctx, c, err)
+			}
+			return c.Status(status).JSON(errorBody(err))
 		}
 
-		return c.JSON(res)
+		if cookies, ok := any(res).(cookieResponse); ok {
+			for _, cookie := range cookies.Cookies() {
+				setCookie(c, cookie)
+			}
+		}
+
+		if redirect, ok := any(res).(redirectResponse); ok {
+			return c.Redirect(redirect.RedirectURL(), fiber.StatusFound)
+		}
+
+		if stream, ok := any(res).(streamResponse); ok {
+			streamBody(c, stream)
+			return nil
+		}
+
+		var body any = res
+		if len(fields) > 0 {
+			if body, err = projector.Project(res, fields); err != nil {
+				logRequestError(ctx, c, err)
+				return c.Status(fiber.StatusInternalServerError).JSON(errorBody(err))
+			}
+		}
+
+		encoded, err := responseCodec.Marshal(body)
+		if err != nil {
+			logRequestError(ctx, c, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(errorBody(err))
+		}
+		c.Set(fiber.HeaderContentType, responseCodec.MediaType())
+		return c.Send(encoded)
+	}
+}
+
+func setCookie(c *fiber.Ctx, cookie *http.Cookie) {
+	sameSite := fiber.CookieSameSiteLaxMode
+	switch cookie.SameSite {
+	case http.SameSiteStrictMode:
+		sameSite = fiber.CookieSameSiteStrictMode
+	case http.SameSiteNoneMode:
+		sameSite = fiber.CookieSameSiteNoneMode
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Path:     cookie.Path,
+		Domain:   cookie.Domain,
+		MaxAge:   cookie.MaxAge,
+		Expires:  cookie.Expires,
+		Secure:   cookie.Secure,
+		HTTPOnly: cookie.HttpOnly,
+		SameSite: sameSite,
+	})
+}
+
+// streamBody streams the response once the handler has returned. Every
+// write pushes the write deadline out by the server's WriteTimeout, so a
+// long stream is only cut off when the client stops reading. A stream that
+// fails closes the connection, so clients see a truncated body instead of
+// one that looks complete.
+func streamBody(c *fiber.Ctx, stream streamResponse) {
+	ctx, conn := c.UserContext(), c.Context().Conn()
+	writeTimeout := c.App().Config().WriteTimeout
+	method, route := c.Method(), c.Route().Path
+
+	c.Set(fiber.HeaderContentType, stream.ContentType())
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		err := stream.Stream(ctx, writerFunc(func(p []byte) (int, error) {
+			if writeTimeout > 0 {
+				if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+					return 0, err
+				}
+			}
+			return w.Write(p)
+		}))
+		if err == nil {
+			err = w.Flush()
+		}
+		if err != nil {
+			zap.L().Warn("streaming response failed", zap.String("method", method), zap.String("route", route), zap.Error(err))
+			_ = conn.Close()
+		}
+	})
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// decodeBody decodes the body with the codec of its content type, leaving
+// forms to fiber and uploads to the request. Requests without a body decode
+// to the zero value.
+func decodeBody[TReq Request](c *fiber.Ctx, req *TReq) error {
+	if upload, ok := any(req).(uploadRequest); ok {
+		return upload.SetBody(c.Get(fiber.HeaderContentType), c.Body())
+	}
+	if len(c.Body()) == 0 {
+		return nil
+	}
+
+	contentType := c.Get(fiber.HeaderContentType)
+	bodyCodec, err := codecs.ForContentType(contentType, reflect.TypeFor[TReq]())
+	if err == nil {
+		return bodyCodec.Unmarshal(c.Body(), req)
+	}
+
+	if err := c.BodyParser(req); err != nil {
+		if errors.Is(err, fiber.ErrUnprocessableEntity) {
+			return codec.ErrUnsupportedMediaType
+		}
+		return err
+	}
+	return nil
+}
+
+func logRequestError(ctx context.Context, c *fiber.Ctx, err error) {
+	fields := []zap.Field{zap.String("method", c.Method()), zap.String("route", c.Route().Path), zap.Error(err)}
+	if principal, ok := pkgauth.FromContext(ctx); ok {
+		fields = append(fields, principal.LogFields()...)
+	}
+	zap.L().Error("request failed", fields...)
+}
+
+func errorStatus(err error) int {
+	if errors.Is(err, domain.ErrNotFound) {
+		return fiber.StatusNotFound
+	}
+	if errors.Is(err, domain.ErrAlreadyExists) {
+		return fiber.StatusConflict
+	}
+
+	switch apperror.CodeOf(err) {
+	case apperror.CodeInvalidArgument:
+		return fiber.StatusBadRequest
+	case apperror.CodeUnauthorized:
+		return fiber.StatusUnauthorized
+	case apperror.CodeForbidden:
+		return fiber.StatusForbidden
+	case apperror.CodeNotFound:
+		return fiber.StatusNotFound
+	case apperror.CodeNotAcceptable:
+		return fiber.StatusNotAcceptable
+	case apperror.CodeUnsupportedMediaType:
+		return fiber.StatusUnsupportedMediaType
+	case apperror.CodeConflict:
+		return fiber.StatusConflict
+	case apperror.CodeUnprocessable:
+		return fiber.StatusUnprocessableEntity
+	case apperror.CodeTooManyRequests:
+		return fiber.StatusTooManyRequests
+	default:
+		return fiber.StatusInternalServerError
 	}
 }
 
 func main() {
+	zap.ReplaceGlobals(zap.Must(zap.NewProduction()))
 	applicationConfig := config.Read()
 	defer zap.L().Sync()
 	zap.L().Info("app starting...")
-	zap.L().Info("app config", zap.Any("appConfig", applicationConfig))
+	zap.L().Info("app config", zap.Any("appConfig", applicationConfig.Redacted()))
 
-	tp := initTracer(applicationConfig)
-	defer func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		if err := tp.Shutdown(ctx); err != nil {
-			zap.L().Error("failed to shutdown tracer provider", zap.Error(err))
+	if len(os.Args) > 1 {
+		if err := runCommand(applicationConfig, os.Args[1:]); err != nil {
+			printCommandError(err)
+			os.Exit(1)
 		}
-	}()
+		return
+	}
+
+	tp := initTracer(applicationConfig)
 	client := httpc()
 
 	retryClient := retryablehttp.NewClient()
@@ -153,69 +456,380 @@ func main() {
 
 	app.Use(otelfiber.Middleware())
 	app.Use(RequestDurationMiddleware())
+	app.Use(ClientIPMiddleware())
+	app.Use(VersionMiddleware(applicationConfig.Versioning))
 
 	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
-	db := infrastructure.NewPostgreAdapter(applicationConfig.Postgre.DSN)
-	healthCheckHandler := healthcheck.NewHealthCheckHandler()
-	userRepository := infrastructure.NewUserRepositoryAdapter(db)
-	refreshTokenRepository := infrastructure.NewRefreshTokenRepositoryAdapter(db)
-	userCreateHandler := user.NewUserCreateHandler(userRepository)
-	userGetHandler := user.NewUserGetHandler(userRepository)
-	userListHandler := user.NewUserListHandler(userRepository)
-	loginHandler := auth.NewLoginHandler(userRepository, refreshTokenRepository, applicationConfig.Security)
-	meHandler := user.NewMeHandler(userRepository)
-
-	app.Post("/login/", handle(loginHandler))
-
-	app.Use(jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{
-			JWTAlg: jwtware.HS256,
-			Key:    []byte(applicationConfig.Security.JwtSecretKey),
+	db := infrastructure.NewPostgreAdapter(applicationConfig.Postgre.DSN, postgreOptions(applicationConfig))
+	queue := initJobQueue(applicationConfig.Jobs, db)
+	registry := initHealth(applicationConfig, db, queue)
+	registerHealth(app, registry)
+	notifier := initNotifier(applicationConfig.Notification, queue)
+	h := newHandlers(applicationConfig, db, notifier, queue, registry, client)
+	tenants := infrastructure.NewTenantRepositoryAdapter(db)
+	registerRoutes(app, newDocument(applicationConfig), applicationConfig, db, tenants, h)
+	tasks := initScheduler(applicationConfig, db)
+
+	var grpcServer *grpc.Server
+	if applicationConfig.Grpc.Enabled {
+		grpcServer = newGRPCServer(applicationConfig, h, tenants)
+	}
+
+	components := initLifecycle(applicationConfig, registry)
+	timeouts := applicationConfig.Shutdown.SecondsOfComponentTimeout
+	components.Register(lifecycle.Component{
+		Name:        "tracer",
+		Stop:        tp.Shutdown,
+		StopTimeout: seconds(timeouts.Tracer),
+	})
+	components.Register(lifecycle.Component{
+		Name:        "database",
+		Stop:        closeDatabase(db),
+		StopTimeout: seconds(timeouts.Database),
+	})
+	components.Register(lifecycle.Component{
+		Name:      "jobQueue",
+		DependsOn: []string{"database", "tracer"},
+		Start: func(ctx context.Context) error {
+			queue.Start()
+			return nil
+		},
+		Stop:        queue.Close,
+		StopTimeout: seconds(timeouts.JobQueue),
+	})
+	components.Register(lifecycle.Component{
+		Name:      "scheduler",
+		DependsOn: []string{"database", "tracer"},
+		Start: func(ctx context.Context) error {
+			tasks.Start()
+			return nil
 		},
-		SuccessHandler: func(c *fiber.Ctx) error {
-			token := c.Locals("user").(*jwt.Token)
-			claims := token.Claims.(jwt.MapClaims)
-			if sub, err := claims.GetSubject(); err == nil {
-				ctx := context.WithValue(c.UserContext(), "userId", sub)
-				c.SetUserContext(ctx)
+		Stop:        tasks.Close,
+		StopTimeout: seconds(timeouts.Scheduler),
+	})
+	// The servers stop before the workers, so no request enqueues work
+	// while the queue drains.
+	components.Register(lifecycle.Component{
+		Name:      "http",
+		DependsOn: []string{"database", "jobQueue", "tracer"},
+		Start: func(ctx context.Context) error {
+			listener, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%s", applicationConfig.Server.Port))
+			if err != nil {
+				return err
 			}
-			return c.Next()
+			go func() {
+				if err := app.Listener(listener); err != nil {
+					components.Fail("http", err)
+				}
+			}()
+			zap.L().Info("Server started on port", zap.String("port", applicationConfig.Server.Port))
+			return nil
 		},
-	}))
-
-	app.Get("/healthcheck", handle(healthCheckHandler))
-	app.Post("/users/", handle(userCreateHandler))
-	app.Get("/users/:id", handle(userGetHandler))
-	app.Get("/users/", handle(userListHandler))
-	app.Get("/user", handle(meHandler))
+		Stop:        app.ShutdownWithContext,
+		StopTimeout: seconds(timeouts.Http),
+	})
+	if grpcServer != nil {
+		components.Register(lifecycle.Component{
+			Name:      "grpc",
+			DependsOn: []string{"database", "jobQueue", "tracer"},
+			Start: func(ctx context.Context) error {
+				if err := serveGRPC(grpcServer, applicationConfig.Grpc.Port, func(err error) { components.Fail("grpc", err) }); err != nil {
+					return err
+				}
+				zap.L().Info("gRPC server started on port", zap.String("port", applicationConfig.Grpc.Port))
+				return nil
+			},
+			Stop:        stopGRPC(grpcServer),
+			StopTimeout: seconds(timeouts.Grpc),
+		})
+	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	go func() {
-		if err := app.Listen(fmt.Sprintf("0.0.0.0:%s", applicationConfig.Server.Port)); err != nil {
-			zap.L().Error("Failed to start server", zap.Error(err))
-			os.Exit(1)
-		}
+		// A second signal kills the process instead of waiting for the
+		// shutdown.
+		<-ctx.Done()
+		stop()
 	}()
+	if err := components.Run(ctx); err != nil {
+		zap.L().Error("Server stopped with errors", zap.Error(err))
+		_ = zap.L().Sync()
+		os.Exit(1)
+	}
+	zap.L().Info("Server gracefully stopped")
+}
 
-	zap.L().Info("Server started on port", zap.String("port", applicationConfig.Server.Port))
-	gracefulShutdown(app)
+// initLifecycle makes the service not ready as soon as it starts stopping,
+// and keeps serving for the pre-stop delay before its components stop.
+func initLifecycle(applicationConfig *config.ApplicationConfig, registry *health.Registry) *lifecycle.Manager {
+	shutdownConfig := applicationConfig.Shutdown
+	if shutdownConfig.SecondsOfPreStopDelay < 0 || shutdownConfig.SecondsOfTimeout < 1 {
+		log.Fatalf("the shutdown needs a timeout and no negative pre-stop delay")
+	}
+	return lifecycle.NewManager(lifecycle.Config{
+		NotReady:     registry.Shutdown,
+		PreStopDelay: seconds(shutdownConfig.SecondsOfPreStopDelay),
+		StopTimeout:  seconds(shutdownConfig.SecondsOfTimeout),
+	})
 }
 
-func gracefulShutdown(app *fiber.App) {
-	// Create channel for shutdown signals
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// closeDatabase closes the connection pool once the components using it
+// have stopped.
+func closeDatabase(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	}
+}
+
+func postgreOptions(applicationConfig *config.ApplicationConfig) infrastructure.PostgreOptions {
+	return infrastructure.PostgreOptions{RowLevelSecurity: applicationConfig.Tenancy.RowLevelSecurity}
+}
+
+func initPasswordHasher(hashingConfig config.PasswordHashingConfig) security.PasswordHasher {
+	hasher, err := security.NewPasswordHasher(security.PasswordHashingConfig{
+		Algorithm: hashingConfig.Algorithm,
+		Argon2id: security.Argon2idParams{
+			MemoryKiB:   hashingConfig.Argon2id.MemoryKiB,
+			Iterations:  hashingConfig.Argon2id.Iterations,
+			Parallelism: hashingConfig.Argon2id.Parallelism,
+			SaltLength:  hashingConfig.Argon2id.SaltLength,
+			KeyLength:   hashingConfig.Argon2id.KeyLength,
+		},
+		BcryptCost: hashingConfig.BcryptCost,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return hasher
+}
 
-	// Wait for shutdown signal
-	<-sigChan
-	zap.L().Info("Shutting down server...")
+func initPasswordPolicy(policyConfig config.PasswordPolicyConfig) *passwordpolicy.Policy {
+	var breached *passwordpolicy.BreachedList
+	if policyConfig.BreachedListPath != "" {
+		list, err := passwordpolicy.LoadBreachedList(policyConfig.BreachedListPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		breached = list
+	}
+
+	return passwordpolicy.New(passwordpolicy.Config{
+		MinLength:            policyConfig.MinLength,
+		MaxLength:            policyConfig.MaxLength,
+		RequireUppercase:     policyConfig.RequireUppercase,
+		RequireLowercase:     policyConfig.RequireLowercase,
+		RequireDigit:         policyConfig.RequireDigit,
+		RequireSymbol:        policyConfig.RequireSymbol,
+		MinStrengthScore:     policyConfig.MinStrengthScore,
+		DisallowPersonalInfo: policyConfig.DisallowPersonalInfo,
+	}, breached)
+}
 
-	// Shutdown with 5 second timeout
-	if err := app.ShutdownWithTimeout(5 * time.Second); err != nil {
-		zap.L().Error("Error during server shutdown", zap.Error(err))
+func initLoginAttemptStore(throttleConfig config.LoginThrottleConfig, db *gorm.DB) domain.LoginAttemptStore {
+	switch throttleConfig.Store {
+	case "postgres":
+		return infrastructure.NewLoginAttemptRepositoryAdapter(db)
+	case "memory", "":
+		return infrastructure.NewLoginAttemptMemoryStore()
+	default:
+		log.Fatalf("unknown login throttle store %q", throttleConfig.Store)
+		return nil
 	}
+}
 
-	zap.L().Info("Server gracefully stopped")
+// initIdentityProviders skips providers without a client id, so the sample
+// entries in config.yml stay inactive until they are filled in.
+func initIdentityProviders(oidcConfig config.OidcConfig, client *http.Client) map[string]domain.IdentityProvider {
+	providers := make(map[string]domain.IdentityProvider, len(oidcConfig.Providers))
+	for name, providerConfig := range oidcConfig.Providers {
+		if providerConfig.ClientId == "" {
+			continue
+		}
+		providers[name] = oidc.NewProvider(oidc.Config{
+			Issuer:       providerConfig.Issuer,
+			ClientId:     providerConfig.ClientId,
+			ClientSecret: providerConfig.ClientSecret,
+			RedirectUrl:  providerConfig.RedirectUrl,
+			Scopes:       providerConfig.Scopes,
+		}, client)
+	}
+	return providers
+}
+
+func initRateLimitStore(rateLimitConfig config.RateLimitConfig, db *gorm.DB) domain.RateLimitStore {
+	switch rateLimitConfig.Store {
+	case "postgres":
+		return infrastructure.NewRateLimitRepositoryAdapter(db)
+	case "memory", "":
+		return infrastructure.NewRateLimitMemoryStore()
+	default:
+		log.Fatalf("unknown rate limit store %q", rateLimitConfig.Store)
+		return nil
+	}
+}
+
+func initIdempotencyStore(idempotencyConfig config.IdempotencyConfig, db *gorm.DB) domain.IdempotencyStore {
+	switch idempotencyConfig.Store {
+	case "postgres":
+		return infrastructure.NewIdempotencyRepositoryAdapter(db)
+	case "memory", "":
+		return infrastructure.NewIdempotencyMemoryStore()
+	default:
+		log.Fatalf("unknown idempotency store %q", idempotencyConfig.Store)
+		return nil
+	}
+}
+
+// initJobQueue builds the queue without starting it, so commands that only
+// register handlers, like openapi, pass a nil db.
+func initJobQueue(jobsConfig config.JobsConfig, db *gorm.DB) *jobs.Queue {
+	if jobsConfig.Workers < 1 || jobsConfig.SecondsOfLease < 1 {
+		log.Fatalf("the job queue needs at least one worker and a lease of at least a second")
+	}
+	var repository domain.JobRepository
+	if db != nil {
+		repository = infrastructure.NewJobRepositoryAdapter(db)
+	}
+	return jobs.NewQueue(repository, jobs.Config{
+		Workers:       jobsConfig.Workers,
+		PollInterval:  time.Duration(jobsConfig.MillisecondsOfPollInterval) * time.Millisecond,
+		Lease:         time.Duration(jobsConfig.SecondsOfLease) * time.Second,
+		StatsInterval: time.Duration(jobsConfig.SecondsOfStatsInterval) * time.Second,
+		Defaults: jobs.Options{
+			MaxAttempts:    jobsConfig.MaxAttempts,
+			InitialBackoff: time.Duration(jobsConfig.MillisecondsOfInitialBackoff) * time.Millisecond,
+			MaxBackoff:     time.Duration(jobsConfig.SecondsOfMaxBackoff) * time.Second,
+		},
+	})
+}
+
+// initScheduler registers the maintenance tasks that have a schedule. The
+// stale session task prunes the Postgres stores only, the memory stores
+// sweep themselves.
+func initScheduler(applicationConfig *config.ApplicationConfig, db *gorm.DB) *scheduler.Scheduler {
+	schedulerConfig := applicationConfig.Scheduler
+	location, err := time.LoadLocation(schedulerConfig.Timezone)
+	if err != nil {
+		log.Fatalf("unknown scheduler timezone %q: %v", schedulerConfig.Timezone, err)
+	}
+	if schedulerConfig.Enabled && schedulerConfig.SecondsOfLeaderCheck < 1 {
+		log.Fatalf("the scheduler needs to check its lock at least every few seconds")
+	}
+
+	taskRunRepository := infrastructure.NewTaskRunRepositoryAdapter(db)
+	tasks := scheduler.NewScheduler(infrastructure.NewAdvisoryLock(db, "scheduler"), taskRunRepository, scheduler.Config{
+		Location:            location,
+		LeaderCheckInterval: time.Duration(schedulerConfig.SecondsOfLeaderCheck) * time.Second,
+	})
+	if !schedulerConfig.Enabled {
+		return tasks
+	}
+
+	register := func(name string, taskConfig config.ScheduledTaskConfig, task scheduler.Task) {
+		if taskConfig.Schedule == "" {
+			return
+		}
+		schedule, err := cron.Parse(taskConfig.Schedule)
+		if err != nil {
+			log.Fatalf("invalid schedule of task %s: %v", name, err)
+		}
+		tasks.Register(name, schedule, task, time.Duration(taskConfig.SecondsOfTimeout)*time.Second)
+	}
+	retention := func(taskConfig config.ScheduledTaskConfig) time.Duration {
+		return time.Duration(taskConfig.HoursOfRetention) * time.Hour
+	}
+
+	taskConfigs := schedulerConfig.Tasks
+	register("refresh-token-cleanup", taskConfigs.RefreshTokenCleanup, maintenance.NewRefreshTokenCleanup(
+		infrastructure.NewRefreshTokenRepositoryAdapter(db),
+		retention(taskConfigs.RefreshTokenCleanup),
+	))
+	register("soft-delete-purge", taskConfigs.SoftDeletePurge, maintenance.NewSoftDeletePurge(
+		infrastructure.NewApiKeyRepositoryAdapter(db),
+		infrastructure.NewOAuthClientRepositoryAdapter(db),
+		retention(taskConfigs.SoftDeletePurge),
+	))
+	register("stale-session-pruning", taskConfigs.StaleSessionPruning, maintenance.NewStaleSessionPruning(
+		infrastructure.NewOidcLoginStateRepositoryAdapter(db),
+		infrastructure.NewUsedMfaChallengeRepositoryAdapter(db),
+		infrastructure.NewLoginAttemptRepositoryAdapter(db),
+		infrastructure.NewRateLimitRepositoryAdapter(db),
+		infrastructure.NewIdempotencyRepositoryAdapter(db),
+		maintenance.SessionWindows{
+			LoginFailures: time.Duration(applicationConfig.Security.LoginThrottle.MinutesOfFailureWindow) * time.Minute,
+			RateLimit:     maxRateLimitWindow(applicationConfig.RateLimit),
+		},
+	))
+	register("history-purge", taskConfigs.HistoryPurge, maintenance.NewHistoryPurge(
+		infrastructure.NewJobRepositoryAdapter(db),
+		infrastructure.NewUserImportRepositoryAdapter(db),
+		taskRunRepository,
+		retention(taskConfigs.HistoryPurge),
+	))
+	return tasks
+}
+
+func maxRateLimitWindow(rateLimitConfig config.RateLimitConfig) time.Duration {
+	seconds := rateLimitConfig.Default.SecondsOfWindow
+	for _, rule := range rateLimitConfig.Routes {
+		seconds = max(seconds, rule.SecondsOfWindow)
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func initImportConfig(importConfig config.UserImportConfig) user.ImportConfig {
+	if importConfig.BatchSize < 1 || importConfig.BatchesPerTransaction < 0 {
+		log.Fatalf("user imports need a positive batch size and no negative batches per transaction")
+	}
+	return user.ImportConfig{
+		BatchSize:             importConfig.BatchSize,
+		BatchesPerTransaction: importConfig.BatchesPerTransaction,
+		SendVerification:      importConfig.SendVerification,
+	}
+}
+
+// initNotifier registers the delivery of notifications with the queue.
+func initNotifier(notificationConfig config.NotificationConfig, queue *jobs.Queue) *notification.QueuedNotifier {
+	var transport notification.Transport
+	switch notificationConfig.Driver {
+	case "smtp":
+		transport = notification.NewSMTPTransport(notification.SMTPConfig{
+			Host:     notificationConfig.SMTP.Host,
+			Port:     notificationConfig.SMTP.Port,
+			Username: notificationConfig.SMTP.Username,
+			Password: notificationConfig.SMTP.Password,
+			Timeout:  time.Duration(notificationConfig.SMTP.SecondsOfTimeout) * time.Second,
+		})
+	case "file":
+		fileDrop, err := notification.NewFileDropTransport(notificationConfig.FileDrop.Directory)
+		if err != nil {
+			log.Fatal(err)
+		}
+		transport = fileDrop
+	case "log":
+		transport = notification.NewLogTransport()
+	default:
+		log.Fatalf("unknown notification driver %q", notificationConfig.Driver)
+	}
+
+	jobs.Register(queue, "notification.deliver", notification.NewDeliveryHandler(transport), jobs.Options{
+		MaxAttempts:    notificationConfig.Queue.MaxAttempts,
+		InitialBackoff: time.Duration(notificationConfig.Queue.MillisecondsOfInitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(notificationConfig.Queue.SecondsOfMaxBackoff) * time.Second,
+		Timeout:        time.Duration(notificationConfig.Queue.SecondsOfSendTimeout) * time.Second,
+	})
+
+	renderer := notification.NewRenderer(notificationConfig.From, notificationConfig.DefaultLocale)
+	return notification.NewQueuedNotifier(renderer, queue)
 }
 
 func httpc() *http.Client {
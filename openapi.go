@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/codec"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/openapi"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/projection"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+const (
+	bearerSecurityScheme = "bearerAuth"
+	apiKeySecurityScheme = "apiKeyAuth"
+)
+
+// swaggerInitializer replaces the one bundled with Swagger UI, which points
+// at the petstore example.
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+var (
+	redirectResponseType = reflect.TypeFor[redirectResponse]()
+	streamResponseType   = reflect.TypeFor[streamResponse]()
+)
+
+// api registers routes of one API version with the router and documents
+// them alongside.
+type api struct {
+	router   fiber.Router
+	document *openapi.Builder
+	// version prefixes the paths and operation ids of the routes.
+	version    string
+	deprecated bool
+	middleware []fiber.Handler
+	security   []openapi.SecurityRequirement
+	// validator checks requests against the document when set.
+	validator *openapi.Validator
+	// idempotencyKey documents the Idempotency-Key header on commands.
+	idempotencyKey bool
+	// serviceScope is the scope service accounts need on authenticated
+	// routes. Without one the routes are for users only.
+	serviceScope string
+}
+
+// authenticated returns an api for routes behind AuthenticationMiddleware.
+func (a *api) authenticated(idempotencyKey bool) *api {
+	return &api{
+		router:     a.router,
+		document:   a.document,
+		version:    a.version,
+		deprecated: a.deprecated,
+		middleware: a.middleware,
+		validator:  a.validator,
+		security: []openapi.SecurityRequirement{
+			{bearerSecurityScheme: {}},
+			{apiKeySecurityScheme: {}},
+		},
+		idempotencyKey: idempotencyKey,
+	}
+}
+
+// forServices returns an api for authenticated routes that service accounts
+// may call with the scope.
+func (a *api) forServices(scope string) *api {
+	scoped := *a
+	scoped.serviceScope = scope
+	return &scoped
+}
+
+// interactive returns an api for routes that manage credentials, which
+// only accept a user's access token.
+func (a *api) interactive() *api {
+	interactive := *a
+	interactive.middleware = append(slices.Clone(a.middleware), InteractiveMiddleware())
+	interactive.security = []openapi.SecurityRequirement{{bearerSecurityScheme: {}}}
+	return &interactive
+}
+
+func route[TReq Request, TRes Response](a *api, method, path, summary string, handler HandlerInterface[TReq, TRes]) {
+	path = "/" + a.version + path
+	var projector *projection.Projector
+	if method == fiber.MethodGet {
+		projector = projection.New(reflect.TypeFor[TRes]())
+	}
+
+	handlers := slices.Clone(a.middleware)
+	if a.security != nil {
+		handlers = append(handlers, ServiceScopeMiddleware(a.serviceScope))
+	}
+	if a.validator != nil {
+		handlers = append(handlers, RequestValidationMiddleware(a.validator, method, path, reflect.TypeFor[TReq]()))
+	}
+	a.router.Add(method, path, append(handlers, handle(handler, projector))...)
+
+	var named any = handler
+	if wrapper, ok := named.(interface{ Unwrap() any }); ok {
+		named = wrapper.Unwrap()
+	}
+	handlerType := reflect.TypeOf(named)
+	for handlerType.Kind() == reflect.Pointer {
+		handlerType = handlerType.Elem()
+	}
+	pkgPath := handlerType.PkgPath()
+
+	spec := openapi.OperationSpec{
+		Method:      method,
+		Path:        path,
+		OperationId: a.version + strings.TrimSuffix(handlerType.Name(), "Handler"),
+		Summary:     summary,
+		Tag:         pkgPath[strings.LastIndex(pkgPath, "/")+1:],
+		Request:     reflect.TypeFor[TReq](),
+		Response:    reflect.TypeFor[TRes](),
+		Redirect:    reflect.PointerTo(reflect.TypeFor[TRes]()).Implements(redirectResponseType),
+		Security:    a.security,
+		Deprecated:  a.deprecated,
+	}
+	if upload, ok := any((*TReq)(nil)).(uploadRequest); ok {
+		spec.UploadMediaTypes = upload.MediaTypes()
+	}
+	if stream, ok := any((*TRes)(nil)).(streamResponse); ok {
+		spec.Response, spec.StreamMediaTypes = nil, stream.MediaTypes()
+	}
+	if a.idempotencyKey && method != fiber.MethodGet && method != fiber.MethodHead {
+		spec.Parameters = append(spec.Parameters, &openapi.Parameter{
+			Name:        idempotencyKeyHeader,
+			In:          "header",
+			Description: "Replays the stored response when the request is retried with the same key",
+			Schema:      &openapi.Schema{Type: "string"},
+		})
+	}
+	if projector != nil {
+		spec.Parameters = append(spec.Parameters, &openapi.Parameter{
+			Name:        "fields",
+			In:          "query",
+			Description: "Comma separated fields of the returned resources to include, out of " + strings.Join(projector.Fields(), ", "),
+			Schema:      &openapi.Schema{Type: "string"},
+		})
+	}
+	a.document.Add(spec)
+}
+
+// newDocument describes the parts of the API that are not derived from the
+// handlers: authentication schemes, the error body and the tenant header.
+func newDocument(applicationConfig *config.ApplicationConfig) *openapi.Builder {
+	document := openapi.NewBuilder(openapi.Info{Title: "production-ready-go-cqrs", Version: "1.0.0"})
+	document.ErrorResponse(reflect.TypeFor[errorResponse]())
+	// Protobuf is left out, its bodies follow the schemas in proto/.
+	document.MediaTypes(codec.MessagePack().MediaType(), codec.CBOR().MediaType())
+	document.SecurityScheme(bearerSecurityScheme, &openapi.SecurityScheme{
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+	})
+	document.SecurityScheme(apiKeySecurityScheme, &openapi.SecurityScheme{
+		Type: "apiKey",
+		In:   "header",
+		Name: apiKeyHeader,
+	})
+	if slices.Contains(applicationConfig.Tenancy.Resolvers, "header") {
+		document.Parameter(&openapi.Parameter{
+			Name:        applicationConfig.Tenancy.Header,
+			In:          "header",
+			Description: "Tenant to act in when it is not given by the subdomain or the token",
+			Schema:      &openapi.Schema{Type: "string"},
+		})
+	}
+	return document
+}
+
+// RequestValidationMiddleware rejects requests whose parameters or body do
+// not match the operation documented for the route, reporting each
+// mismatch the way handle reports validation failures. Bodies in other
+// formats than JSON are checked as the JSON they decode to.
+func RequestValidationMiddleware(validator *openapi.Validator, method, path string, requestType reflect.Type) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(errorResponse{Error: err.Error()})
+		}
+
+		contentType, body := c.Get(fiber.HeaderContentType), c.Body()
+		if len(body) > 0 {
+			if contentType, body, err = transcodeBody(contentType, body, requestType); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(errorResponse{Error: err.Error()})
+			}
+		}
+
+		err = validator.ValidateRequest(&openapi.Request{
+			Method:      method,
+			Path:        path,
+			Params:      c.AllParams(),
+			Query:       query,
+			Header:      http.Header(c.GetReqHeaders()),
+			ContentType: contentType,
+			Body:        body,
+		})
+		if err != nil {
+			status := errorStatus(err)
+			if status == fiber.StatusInternalServerError {
+				logRequestError(c.UserContext(), c, err)
+			}
+			return c.Status(status).JSON(errorBody(err))
+		}
+		return c.Next()
+	}
+}
+
+// transcodeBody re-encodes a body a codec decodes as JSON. Codecs that only
+// decode into the request type, like protobuf, go through it. Bodies no
+// codec decodes, like forms, are returned as they are.
+func transcodeBody(contentType string, body []byte, requestType reflect.Type) (string, []byte, error) {
+	target := reflect.TypeFor[any]()
+	bodyCodec, err := codecs.ForContentType(contentType, target)
+	if err != nil {
+		target = requestType
+		if bodyCodec, err = codecs.ForContentType(contentType, target); err != nil {
+			return contentType, body, nil
+		}
+	}
+	if bodyCodec.MediaType() == fiber.MIMEApplicationJSON {
+		return fiber.MIMEApplicationJSON, body, nil
+	}
+
+	decoded := reflect.New(target)
+	if err := bodyCodec.Unmarshal(body, decoded.Interface()); err != nil {
+		return "", nil, err
+	}
+	encoded, err := json.Marshal(decoded.Interface())
+	if err != nil {
+		return "", nil, err
+	}
+	return fiber.MIMEApplicationJSON, encoded, nil
+}
+
+func initRequestValidator(openAPIConfig config.OpenAPIConfig, document *openapi.Builder) *openapi.Validator {
+	if !openAPIConfig.ValidateRequests {
+		return nil
+	}
+	return openapi.NewValidator(document.Document())
+}
+
+// registerDocumentation serves the document at /openapi.json and Swagger UI
+// at /docs. The document is encoded on first request, once every route has
+// been registered.
+func registerDocumentation(app *fiber.App, document *openapi.Builder) {
+	var (
+		once    sync.Once
+		encoded []byte
+		err     error
+	)
+	app.Get("/openapi.json", func(c *fiber.Ctx) error {
+		once.Do(func() { encoded, err = json.Marshal(document.Document()) })
+		if err != nil {
+			return err
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(encoded)
+	})
+	app.Get("/docs/swagger-initializer.js", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJavaScript)
+		return c.SendString(swaggerInitializer)
+	})
+	app.Use("/docs", filesystem.New(filesystem.Config{Root: http.FS(swaggerFiles.FS)}))
+}
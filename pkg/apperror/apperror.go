@@ -0,0 +1,63 @@
+package apperror
+
+import "errors"
+
+type Code string
+
+const (
+	CodeInvalidArgument      Code = "invalid_argument"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeNotAcceptable        Code = "not_acceptable"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeConflict             Code = "conflict"
+	CodeUnprocessable        Code = "unprocessable"
+	CodeTooManyRequests      Code = "too_many_requests"
+	CodeInternal             Code = "internal"
+)
+
+// Error is an error that carries a transport independent classification, so
+// handlers can signal e.g. "forbidden" without depending on fiber.
+type Error struct {
+	Code    Code
+	Message string
+	Fields  []FieldError
+}
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func Validation(fields ...FieldError) *Error {
+	return &Error{Code: CodeInvalidArgument, Message: "validation failed", Fields: fields}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// CodeOf returns the code of the first *Error in err's chain, or CodeInternal.
+func CodeOf(err error) Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return CodeInternal
+}
+
+// FieldsOf returns the field errors of the first *Error in err's chain.
+func FieldsOf(err error) []FieldError {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// Kind tells users apart from service accounts. The values double as the
+// "principal" claim of access tokens.
+type Kind string
+
+const (
+	KindUser    Kind = "user"
+	KindService Kind = "service"
+)
+
+// Scopes OAuth clients can be granted. Each route open to service accounts
+// asks for one of them.
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// Method is the credential the request was authenticated with.
+type Method string
+
+const (
+	MethodBearerToken Method = "bearer_token"
+	MethodApiKey      Method = "api_key"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Kind Kind
+	// Subject is the user id for users and the client id for services.
+	Subject  string
+	Email    string
+	FullName string
+	Roles    []string
+	Scopes   []string
+	Method   Method
+	// TokenId identifies the presented credential: the jti of a token or
+	// the id of an API key.
+	TokenId  string
+	TenantId string
+}
+
+func (p *Principal) IsUser() bool {
+	return p.Kind == KindUser
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// LogFields describes the principal for log entries. Email and name are left
+// out so logs do not collect personal data.
+func (p *Principal) LogFields() []zap.Field {
+	return []zap.Field{
+		zap.String("principal", string(p.Kind)),
+		zap.String("subject", p.Subject),
+		zap.String("authMethod", string(p.Method)),
+		zap.String("tokenId", p.TokenId),
+	}
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func FromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// UserId returns the id of the authenticated user. It reports false for
+// anonymous requests and for service accounts, which act on behalf of no
+// user.
+func UserId(ctx context.Context) (string, bool) {
+	principal, ok := FromContext(ctx)
+	if !ok || !principal.IsUser() {
+		return "", false
+	}
+	return principal.Subject, true
+}
@@ -0,0 +1,49 @@
+package codec
+
+import (
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// cborCodec names fields by their json tags, as cbor falls back to them,
+// and encodes times as tagged RFC 3339 strings. The modes are built once
+// and cache the fields of each type they have seen.
+type cborCodec struct {
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+}
+
+func CBOR() Codec {
+	encMode, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano, TimeTag: cbor.EncTagRequired}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	// Untyped maps decode like JSON objects rather than map[any]any, for
+	// request validation to work on them.
+	decMode, err := cbor.DecOptions{DefaultMapType: reflect.TypeFor[map[string]any]()}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return &cborCodec{encMode: encMode, decMode: decMode}
+}
+
+func (*cborCodec) MediaType() string {
+	return "application/cbor"
+}
+
+func (*cborCodec) Matches(mediaType string) bool {
+	return matches(mediaType, "cbor", "application/cbor")
+}
+
+func (*cborCodec) Supports(reflect.Type) bool {
+	return true
+}
+
+func (c *cborCodec) Marshal(v any) ([]byte, error) {
+	return c.encMode.Marshal(v)
+}
+
+func (c *cborCodec) Unmarshal(data []byte, v any) error {
+	return c.decMode.Unmarshal(data, v)
+}
@@ -0,0 +1,135 @@
+// Package codec encodes and decodes request and response bodies in the
+// formats clients negotiate with the Accept and Content-Type headers.
+package codec
+
+import (
+	"mime"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+)
+
+var (
+	ErrNotAcceptable        = apperror.New(apperror.CodeNotAcceptable, "none of the accepted media types can be produced")
+	ErrUnsupportedMediaType = apperror.New(apperror.CodeUnsupportedMediaType, "unsupported media type")
+)
+
+type Codec interface {
+	// MediaType is the Content-Type of the bodies the codec encodes.
+	MediaType() string
+	// Matches reports whether the codec handles a media type, e.g. by an
+	// alias or a structured syntax suffix like "application/vnd.cqrs.v2+json".
+	Matches(mediaType string) bool
+	// Supports reports whether values of type t can be encoded or decoded.
+	Supports(t reflect.Type) bool
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Registry picks codecs in the order they were registered, the first being
+// the default.
+type Registry struct {
+	codecs []Codec
+}
+
+func NewRegistry(codecs ...Codec) *Registry {
+	return &Registry{codecs: codecs}
+}
+
+// MediaTypes returns the media types of the registered codecs.
+func (r *Registry) MediaTypes() []string {
+	mediaTypes := make([]string, len(r.codecs))
+	for i, codec := range r.codecs {
+		mediaTypes[i] = codec.MediaType()
+	}
+	return mediaTypes
+}
+
+// Negotiate returns the codec to encode a t with, by the most preferred
+// media range of the Accept header that a codec supporting t matches. An
+// empty header accepts anything.
+func (r *Registry) Negotiate(accept string, t reflect.Type) (Codec, error) {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		for _, codec := range r.codecs {
+			if codec.Supports(t) && matchesRange(codec, mediaRange) {
+				return codec, nil
+			}
+		}
+	}
+	return nil, ErrNotAcceptable
+}
+
+// ForContentType returns the codec to decode a body of the content type
+// into a t.
+func (r *Registry) ForContentType(contentType string, t reflect.Type) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, ErrUnsupportedMediaType
+	}
+	for _, codec := range r.codecs {
+		if codec.Supports(t) && codec.Matches(mediaType) {
+			return codec, nil
+		}
+	}
+	return nil, ErrUnsupportedMediaType
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of an Accept header, most preferred
+// first, leaving out those the client refuses with q=0.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	slices.SortStableFunc(ranges, func(a, b mediaRange) int {
+		switch {
+		case a.quality > b.quality:
+			return -1
+		case a.quality < b.quality:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return ranges
+}
+
+func matchesRange(codec Codec, mediaRange mediaRange) bool {
+	if mediaRange.mediaType == "*/*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(mediaRange.mediaType, "/*"); ok {
+		return strings.HasPrefix(codec.MediaType(), prefix+"/")
+	}
+	return codec.Matches(mediaRange.mediaType)
+}
+
+// matches reports whether mediaType is one of names or ends in the
+// structured syntax suffix.
+func matches(mediaType string, suffix string, names ...string) bool {
+	return slices.Contains(names, mediaType) || (suffix != "" && strings.HasSuffix(mediaType, "+"+suffix))
+}
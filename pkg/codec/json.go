@@ -0,0 +1,32 @@
+package codec
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+type jsonCodec struct{}
+
+func JSON() Codec {
+	return jsonCodec{}
+}
+
+func (jsonCodec) MediaType() string {
+	return "application/json"
+}
+
+func (jsonCodec) Matches(mediaType string) bool {
+	return matches(mediaType, "json", "application/json")
+}
+
+func (jsonCodec) Supports(reflect.Type) bool {
+	return true
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
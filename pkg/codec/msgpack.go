@@ -0,0 +1,52 @@
+package codec
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpackCodec names fields by their json tags, so MessagePack bodies have
+// the same shape as JSON ones. Encoders and decoders are pooled, and
+// msgpack caches the fields of each type it has seen.
+type msgpackCodec struct{}
+
+func MessagePack() Codec {
+	return msgpackCodec{}
+}
+
+func (msgpackCodec) MediaType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Matches(mediaType string) bool {
+	return matches(mediaType, "msgpack", "application/msgpack", "application/x-msgpack", "application/vnd.msgpack")
+}
+
+func (msgpackCodec) Supports(reflect.Type) bool {
+	return true
+}
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(encoder)
+
+	encoder.Reset(&buffer)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	decoder := msgpack.GetDecoder()
+	defer msgpack.PutDecoder(decoder)
+
+	decoder.Reset(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
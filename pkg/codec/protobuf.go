@@ -0,0 +1,84 @@
+package codec
+
+import (
+	"errors"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var errNoSchema = errors.New("codec: no protobuf message is registered for the type")
+
+// Protobuf encodes and decodes the types registered with a message of the
+// schemas in proto/, converting between the two on the way. Other types
+// are not supported, so clients asking for protobuf only get it where a
+// schema exists.
+type Protobuf struct {
+	encoders map[reflect.Type]func(any) proto.Message
+	decoders map[reflect.Type]func([]byte, any) error
+}
+
+func NewProtobuf() *Protobuf {
+	return &Protobuf{
+		encoders: make(map[reflect.Type]func(any) proto.Message),
+		decoders: make(map[reflect.Type]func([]byte, any) error),
+	}
+}
+
+// RegisterEncoder encodes a T as the message encode converts it to.
+func RegisterEncoder[T any](p *Protobuf, encode func(*T) proto.Message) {
+	p.encoders[reflect.TypeFor[T]()] = func(v any) proto.Message {
+		return encode(v.(*T))
+	}
+}
+
+// RegisterDecoder decodes a T from an M, converted by decode.
+func RegisterDecoder[T any, M proto.Message](p *Protobuf, decode func(M, *T)) {
+	p.decoders[reflect.TypeFor[T]()] = func(data []byte, v any) error {
+		var zero M
+		message := zero.ProtoReflect().Type().New().Interface().(M)
+		if err := proto.Unmarshal(data, message); err != nil {
+			return err
+		}
+		decode(message, v.(*T))
+		return nil
+	}
+}
+
+func (p *Protobuf) MediaType() string {
+	return "application/x-protobuf"
+}
+
+func (p *Protobuf) Matches(mediaType string) bool {
+	return matches(mediaType, "proto", "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf")
+}
+
+func (p *Protobuf) Supports(t reflect.Type) bool {
+	_, encodes := p.encoders[t]
+	_, decodes := p.decoders[t]
+	return encodes || decodes
+}
+
+func (p *Protobuf) Marshal(v any) ([]byte, error) {
+	encode, ok := p.encoders[pointee(v)]
+	if !ok {
+		return nil, errNoSchema
+	}
+	return proto.Marshal(encode(v))
+}
+
+func (p *Protobuf) Unmarshal(data []byte, v any) error {
+	decode, ok := p.decoders[pointee(v)]
+	if !ok {
+		return errNoSchema
+	}
+	return decode(data, v)
+}
+
+// pointee returns the type v points to, or nil when v is no pointer.
+func pointee(v any) reflect.Type {
+	if t := reflect.TypeOf(v); t != nil && t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return nil
+}
@@ -39,3 +39,31 @@ func Read() *ApplicationConfig {
 
 	return &applicationConfig
 }
+
+const redacted = "REDACTED"
+
+// Redacted returns a copy of the config with its secrets replaced, safe to
+// log. Secrets that are not set stay empty, so the log still tells them
+// apart.
+func (c *ApplicationConfig) Redacted() *ApplicationConfig {
+	copied := *c
+	redact(&copied.Postgre.DSN)
+	redact(&copied.Security.JwtSecretKey)
+	redact(&copied.Security.Mfa.EncryptionKey)
+	redact(&copied.Notification.SMTP.Password)
+
+	if c.Security.Oidc.Providers != nil {
+		copied.Security.Oidc.Providers = make(map[string]OidcProviderConfig, len(c.Security.Oidc.Providers))
+		for name, provider := range c.Security.Oidc.Providers {
+			redact(&provider.ClientSecret)
+			copied.Security.Oidc.Providers[name] = provider
+		}
+	}
+	return &copied
+}
+
+func redact(secret *string) {
+	if *secret != "" {
+		*secret = redacted
+	}
+}
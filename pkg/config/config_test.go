@@ -0,0 +1,44 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRedacted(t *testing.T) {
+	secrets := []string{"postgres://app:hunter2@db/app", "jwt-secret", "mfa-key", "smtp-password", "oidc-secret"}
+	applicationConfig := &ApplicationConfig{
+		Postgre: PostgreConfig{DSN: secrets[0]},
+		Security: SecurityConfig{
+			JwtSecretKey: secrets[1],
+			Mfa:          MfaConfig{Issuer: "app", EncryptionKey: secrets[2]},
+			Oidc: OidcConfig{Providers: map[string]OidcProviderConfig{
+				"google": {ClientId: "client", ClientSecret: secrets[4]},
+				"github": {ClientId: "other"},
+			}},
+		},
+		Notification: NotificationConfig{SMTP: SMTPConfig{Host: "smtp.example.com", Password: secrets[3]}},
+	}
+
+	encoded, err := json.Marshal(applicationConfig.Redacted())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range secrets {
+		if strings.Contains(string(encoded), secret) {
+			t.Errorf("redacted config tells %q: %s", secret, encoded)
+		}
+	}
+
+	redacted := applicationConfig.Redacted()
+	if redacted.Security.Mfa.Issuer != "app" || redacted.Notification.SMTP.Host != "smtp.example.com" || redacted.Security.Oidc.Providers["google"].ClientId != "client" {
+		t.Fatalf("redacted config lost settings that are not secret: %+v", redacted)
+	}
+	if redacted.Security.Oidc.Providers["github"].ClientSecret != "" {
+		t.Fatal("a secret that is not set was redacted")
+	}
+	if applicationConfig.Security.Oidc.Providers["google"].ClientSecret != secrets[4] || applicationConfig.Postgre.DSN != secrets[0] {
+		t.Fatal("redacting changed the original config")
+	}
+}
@@ -8,15 +8,300 @@ type PostgreConfig struct {
 	DSN string `mapstructure:"dsn" yaml:"dsn"`
 }
 
+type EmailVerificationConfig struct {
+	Required                bool   `mapstructure:"required" yaml:"required"`
+	HoursOfTokenExpiration  int    `mapstructure:"hoursOfTokenExpiration" yaml:"hoursOfTokenExpiration"`
+	SecondsOfResendCooldown int    `mapstructure:"secondsOfResendCooldown" yaml:"secondsOfResendCooldown"`
+	VerifyUrl               string `mapstructure:"verifyUrl" yaml:"verifyUrl"`
+}
+
+type MfaConfig struct {
+	Issuer                       string `mapstructure:"issuer" yaml:"issuer"`
+	EncryptionKey                string `mapstructure:"encryptionKey" yaml:"encryptionKey"`
+	MinutesOfChallengeExpiration int    `mapstructure:"minutesOfChallengeExpiration" yaml:"minutesOfChallengeExpiration"`
+	RecoveryCodeCount            int    `mapstructure:"recoveryCodeCount" yaml:"recoveryCodeCount"`
+}
+
+type LoginThrottleConfig struct {
+	// Store selects where failed attempts are counted: "memory" or "postgres".
+	Store                  string `mapstructure:"store" yaml:"store"`
+	MaxFailuresPerAccount  int    `mapstructure:"maxFailuresPerAccount" yaml:"maxFailuresPerAccount"`
+	MaxFailuresPerIp       int    `mapstructure:"maxFailuresPerIp" yaml:"maxFailuresPerIp"`
+	MinutesOfFailureWindow int    `mapstructure:"minutesOfFailureWindow" yaml:"minutesOfFailureWindow"`
+	SecondsOfBaseLockout   int    `mapstructure:"secondsOfBaseLockout" yaml:"secondsOfBaseLockout"`
+	MinutesOfMaxLockout    int    `mapstructure:"minutesOfMaxLockout" yaml:"minutesOfMaxLockout"`
+}
+
+type Argon2idConfig struct {
+	MemoryKiB   uint32 `mapstructure:"memoryKiB" yaml:"memoryKiB"`
+	Iterations  uint32 `mapstructure:"iterations" yaml:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism" yaml:"parallelism"`
+	SaltLength  uint32 `mapstructure:"saltLength" yaml:"saltLength"`
+	KeyLength   uint32 `mapstructure:"keyLength" yaml:"keyLength"`
+}
+
+type PasswordHashingConfig struct {
+	// Algorithm used for new hashes: "argon2id" or "bcrypt". Hashes of the
+	// other algorithm are still verified and upgraded on the next login.
+	Algorithm  string         `mapstructure:"algorithm" yaml:"algorithm"`
+	Argon2id   Argon2idConfig `mapstructure:"argon2id" yaml:"argon2id"`
+	BcryptCost int            `mapstructure:"bcryptCost" yaml:"bcryptCost"`
+}
+
+type PasswordPolicyConfig struct {
+	MinLength            int    `mapstructure:"minLength" yaml:"minLength"`
+	MaxLength            int    `mapstructure:"maxLength" yaml:"maxLength"`
+	RequireUppercase     bool   `mapstructure:"requireUppercase" yaml:"requireUppercase"`
+	RequireLowercase     bool   `mapstructure:"requireLowercase" yaml:"requireLowercase"`
+	RequireDigit         bool   `mapstructure:"requireDigit" yaml:"requireDigit"`
+	RequireSymbol        bool   `mapstructure:"requireSymbol" yaml:"requireSymbol"`
+	MinStrengthScore     int    `mapstructure:"minStrengthScore" yaml:"minStrengthScore"`
+	DisallowPersonalInfo bool   `mapstructure:"disallowPersonalInfo" yaml:"disallowPersonalInfo"`
+	BreachedListPath     string `mapstructure:"breachedListPath" yaml:"breachedListPath"`
+}
+
+type OidcProviderConfig struct {
+	Issuer       string   `mapstructure:"issuer" yaml:"issuer"`
+	ClientId     string   `mapstructure:"clientId" yaml:"clientId"`
+	ClientSecret string   `mapstructure:"clientSecret" yaml:"clientSecret"`
+	RedirectUrl  string   `mapstructure:"redirectUrl" yaml:"redirectUrl"`
+	Scopes       []string `mapstructure:"scopes" yaml:"scopes"`
+}
+
+type OidcConfig struct {
+	MinutesOfStateExpiration int `mapstructure:"minutesOfStateExpiration" yaml:"minutesOfStateExpiration"`
+	// LinkByVerifiedEmail links a first external login to the existing user
+	// with the same email, provided the provider asserts it as verified.
+	LinkByVerifiedEmail bool `mapstructure:"linkByVerifiedEmail" yaml:"linkByVerifiedEmail"`
+	// AutoProvision creates a local user on the first external login.
+	AutoProvision bool `mapstructure:"autoProvision" yaml:"autoProvision"`
+	// Providers are keyed by the name used in the login and callback URLs.
+	Providers map[string]OidcProviderConfig `mapstructure:"providers" yaml:"providers"`
+}
+
 type SecurityConfig struct {
-	JwtSecretKey                  string `mapstructure:"jwtSecretKey" yaml:"jwtSecretKey"`
-	MinutesOfJwtExpiration        int    `mapstructure:"minutesOfJwtExpiration" yaml:"minutesOfJwtExpiration"`
-	HoursOfRefreshTokenExpiration int    `mapstructure:"hoursOfRefreshTokenExpiration" yaml:"hoursOfRefreshTokenExpiration"`
+	JwtSecretKey                  string                  `mapstructure:"jwtSecretKey" yaml:"jwtSecretKey"`
+	MinutesOfJwtExpiration        int                     `mapstructure:"minutesOfJwtExpiration" yaml:"minutesOfJwtExpiration"`
+	HoursOfRefreshTokenExpiration int                     `mapstructure:"hoursOfRefreshTokenExpiration" yaml:"hoursOfRefreshTokenExpiration"`
+	EmailVerification             EmailVerificationConfig `mapstructure:"emailVerification" yaml:"emailVerification"`
+	Mfa                           MfaConfig               `mapstructure:"mfa" yaml:"mfa"`
+	LoginThrottle                 LoginThrottleConfig     `mapstructure:"loginThrottle" yaml:"loginThrottle"`
+	PasswordHashing               PasswordHashingConfig   `mapstructure:"passwordHashing" yaml:"passwordHashing"`
+	PasswordPolicy                PasswordPolicyConfig    `mapstructure:"passwordPolicy" yaml:"passwordPolicy"`
+	Oidc                          OidcConfig              `mapstructure:"oidc" yaml:"oidc"`
+}
+
+type SMTPConfig struct {
+	Host             string `mapstructure:"host" yaml:"host"`
+	Port             int    `mapstructure:"port" yaml:"port"`
+	Username         string `mapstructure:"username" yaml:"username"`
+	Password         string `mapstructure:"password" yaml:"password"`
+	SecondsOfTimeout int    `mapstructure:"secondsOfTimeout" yaml:"secondsOfTimeout"`
+}
+
+type FileDropConfig struct {
+	Directory string `mapstructure:"directory" yaml:"directory"`
+}
+
+// NotificationQueueConfig is the retry policy of notification deliveries on
+// the job queue.
+type NotificationQueueConfig struct {
+	MaxAttempts                  int `mapstructure:"maxAttempts" yaml:"maxAttempts"`
+	MillisecondsOfInitialBackoff int `mapstructure:"millisecondsOfInitialBackoff" yaml:"millisecondsOfInitialBackoff"`
+	SecondsOfMaxBackoff          int `mapstructure:"secondsOfMaxBackoff" yaml:"secondsOfMaxBackoff"`
+	SecondsOfSendTimeout         int `mapstructure:"secondsOfSendTimeout" yaml:"secondsOfSendTimeout"`
+}
+
+type NotificationConfig struct {
+	// Driver selects the transport: "smtp", "file" or "log".
+	Driver        string                  `mapstructure:"driver" yaml:"driver"`
+	From          string                  `mapstructure:"from" yaml:"from"`
+	DefaultLocale string                  `mapstructure:"defaultLocale" yaml:"defaultLocale"`
+	SMTP          SMTPConfig              `mapstructure:"smtp" yaml:"smtp"`
+	FileDrop      FileDropConfig          `mapstructure:"fileDrop" yaml:"fileDrop"`
+	Queue         NotificationQueueConfig `mapstructure:"queue" yaml:"queue"`
+}
+
+type TenancyConfig struct {
+	// Resolvers lists the request sources tried in order: "header" and
+	// "subdomain". The tenant claim of an access token always wins.
+	Resolvers []string `mapstructure:"resolvers" yaml:"resolvers"`
+	Header    string   `mapstructure:"header" yaml:"header"`
+	// BaseDomain is stripped from the host to find the subdomain, e.g.
+	// "acme.example.com" resolves to "acme" with base domain "example.com".
+	BaseDomain string `mapstructure:"baseDomain" yaml:"baseDomain"`
+	// DefaultTenant serves requests none of the resolvers matched. Leave it
+	// empty to reject them instead.
+	DefaultTenant    string `mapstructure:"defaultTenant" yaml:"defaultTenant"`
+	RowLevelSecurity bool   `mapstructure:"rowLevelSecurity" yaml:"rowLevelSecurity"`
+}
+
+type RateLimitRuleConfig struct {
+	Method string `mapstructure:"method" yaml:"method"`
+	Path   string `mapstructure:"path" yaml:"path"`
+	// Key selects whose budget a request counts against: "ip", "user",
+	// "api_key" or "route" for one budget shared by all clients. Anonymous
+	// requests fall back from "api_key" to "user" to "ip".
+	Key             string `mapstructure:"key" yaml:"key"`
+	Limit           int    `mapstructure:"limit" yaml:"limit"`
+	SecondsOfWindow int    `mapstructure:"secondsOfWindow" yaml:"secondsOfWindow"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Store is "memory" for a budget per instance or "postgres" for one
+	// shared by all replicas.
+	Store string `mapstructure:"store" yaml:"store"`
+	// Default applies to routes without a rule of their own.
+	Default RateLimitRuleConfig   `mapstructure:"default" yaml:"default"`
+	Routes  []RateLimitRuleConfig `mapstructure:"routes" yaml:"routes"`
+}
+
+type IdempotencyConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Store is "memory" or "postgres", the latter recognising retries that
+	// reach another replica.
+	Store         string `mapstructure:"store" yaml:"store"`
+	HoursOfExpiry int    `mapstructure:"hoursOfExpiry" yaml:"hoursOfExpiry"`
+	// SecondsOfWait is how long a duplicate of a request still in progress
+	// waits for its response before it is answered with 409.
+	SecondsOfWait int `mapstructure:"secondsOfWait" yaml:"secondsOfWait"`
+	// SecondsOfRequestTimeout is how long a request may take. A key is
+	// held for it plus SecondsOfWait while its request runs, and taken over
+	// by a retry after that, as the replica running it may have died.
+	SecondsOfRequestTimeout int `mapstructure:"secondsOfRequestTimeout" yaml:"secondsOfRequestTimeout"`
+}
+
+type GrpcConfig struct {
+	Enabled bool   `mapstructure:"enabled" yaml:"enabled"`
+	Port    string `mapstructure:"port" yaml:"port"`
+	// Reflection lets tools such as grpcurl list the services.
+	Reflection bool `mapstructure:"reflection" yaml:"reflection"`
+}
+
+type ApiVersionConfig struct {
+	// Deprecated and Sunset are dates, e.g. "2026-10-19", announced in the
+	// Deprecation and Sunset headers of the version's responses. Both are
+	// empty while the version is supported.
+	Deprecated string `mapstructure:"deprecated" yaml:"deprecated"`
+	Sunset     string `mapstructure:"sunset" yaml:"sunset"`
+	// Link documents the migration away from a deprecated version.
+	Link string `mapstructure:"link" yaml:"link"`
+}
+
+type VersioningConfig struct {
+	// Default serves requests that name a version neither in the path nor
+	// in the Accept header.
+	Default string `mapstructure:"default" yaml:"default"`
+	// Vendor names the media types versions are requested with, e.g.
+	// "application/vnd.<vendor>.v2+json".
+	Vendor   string                      `mapstructure:"vendor" yaml:"vendor"`
+	Versions map[string]ApiVersionConfig `mapstructure:"versions" yaml:"versions"`
+}
+
+type OpenAPIConfig struct {
+	// ValidateRequests rejects requests that do not match the generated
+	// document before they reach the handlers.
+	ValidateRequests bool `mapstructure:"validateRequests" yaml:"validateRequests"`
+}
+
+type UserImportConfig struct {
+	// MaxRows rejects larger uploads; zero allows any number of rows.
+	MaxRows   int `mapstructure:"maxRows" yaml:"maxRows"`
+	BatchSize int `mapstructure:"batchSize" yaml:"batchSize"`
+	// BatchesPerTransaction is how many batches are committed together, or
+	// zero to commit each import as a whole.
+	BatchesPerTransaction int  `mapstructure:"batchesPerTransaction" yaml:"batchesPerTransaction"`
+	SendVerification      bool `mapstructure:"sendVerification" yaml:"sendVerification"`
+}
+
+type JobsConfig struct {
+	Workers                    int `mapstructure:"workers" yaml:"workers"`
+	MillisecondsOfPollInterval int `mapstructure:"millisecondsOfPollInterval" yaml:"millisecondsOfPollInterval"`
+	// SecondsOfLease is how long a job stays locked to a worker that stopped
+	// sending heartbeats, e.g. because it crashed, before another worker
+	// claims it.
+	SecondsOfLease               int `mapstructure:"secondsOfLease" yaml:"secondsOfLease"`
+	SecondsOfStatsInterval       int `mapstructure:"secondsOfStatsInterval" yaml:"secondsOfStatsInterval"`
+	MaxAttempts                  int `mapstructure:"maxAttempts" yaml:"maxAttempts"`
+	MillisecondsOfInitialBackoff int `mapstructure:"millisecondsOfInitialBackoff" yaml:"millisecondsOfInitialBackoff"`
+	SecondsOfMaxBackoff          int `mapstructure:"secondsOfMaxBackoff" yaml:"secondsOfMaxBackoff"`
+}
+
+type ScheduledTaskConfig struct {
+	// Schedule is a cron expression such as "0 3 * * *"; leaving it empty
+	// disables the task.
+	Schedule         string `mapstructure:"schedule" yaml:"schedule"`
+	SecondsOfTimeout int    `mapstructure:"secondsOfTimeout" yaml:"secondsOfTimeout"`
+	// HoursOfRetention is how long the task keeps what it would delete,
+	// for the tasks that keep anything.
+	HoursOfRetention int `mapstructure:"hoursOfRetention" yaml:"hoursOfRetention"`
+}
+
+type SchedulerTasksConfig struct {
+	RefreshTokenCleanup ScheduledTaskConfig `mapstructure:"refreshTokenCleanup" yaml:"refreshTokenCleanup"`
+	SoftDeletePurge     ScheduledTaskConfig `mapstructure:"softDeletePurge" yaml:"softDeletePurge"`
+	StaleSessionPruning ScheduledTaskConfig `mapstructure:"staleSessionPruning" yaml:"staleSessionPruning"`
+	HistoryPurge        ScheduledTaskConfig `mapstructure:"historyPurge" yaml:"historyPurge"`
+}
+
+type SchedulerConfig struct {
+	Enabled bool `mapstructure:"enabled" yaml:"enabled"`
+	// Timezone names the location schedules are read in, e.g. "UTC" or
+	// "Europe/Istanbul".
+	Timezone string `mapstructure:"timezone" yaml:"timezone"`
+	// SecondsOfLeaderCheck is how often the replica leading the scheduler
+	// checks it still holds the lock, and the others try to take it.
+	SecondsOfLeaderCheck int                  `mapstructure:"secondsOfLeaderCheck" yaml:"secondsOfLeaderCheck"`
+	Tasks                SchedulerTasksConfig `mapstructure:"tasks" yaml:"tasks"`
+}
+
+type HealthConfig struct {
+	// MillisecondsOfCache is how long the result of a check is reused
+	// before probes run it again.
+	MillisecondsOfCache   int `mapstructure:"millisecondsOfCache" yaml:"millisecondsOfCache"`
+	MillisecondsOfTimeout int `mapstructure:"millisecondsOfTimeout" yaml:"millisecondsOfTimeout"`
+	// SecondsOfMaxQueueLag degrades readiness once a due job waited longer
+	// for a worker; zero disables the check.
+	SecondsOfMaxQueueLag int `mapstructure:"secondsOfMaxQueueLag" yaml:"secondsOfMaxQueueLag"`
+}
+
+// ComponentStopTimeoutsConfig bounds how long each component may take to
+// stop, in seconds. Zero leaves it to the timeout of the whole shutdown.
+type ComponentStopTimeoutsConfig struct {
+	Http      int `mapstructure:"http" yaml:"http"`
+	Grpc      int `mapstructure:"grpc" yaml:"grpc"`
+	Scheduler int `mapstructure:"scheduler" yaml:"scheduler"`
+	JobQueue  int `mapstructure:"jobQueue" yaml:"jobQueue"`
+	Database  int `mapstructure:"database" yaml:"database"`
+	Tracer    int `mapstructure:"tracer" yaml:"tracer"`
+}
+
+type ShutdownConfig struct {
+	// SecondsOfPreStopDelay is how long the service keeps serving after it
+	// reports not ready, so load balancers stop sending it traffic first.
+	SecondsOfPreStopDelay int `mapstructure:"secondsOfPreStopDelay" yaml:"secondsOfPreStopDelay"`
+	// SecondsOfTimeout bounds stopping all components, after the delay.
+	// Together they stay below the grace period of the orchestrator.
+	SecondsOfTimeout          int                         `mapstructure:"secondsOfTimeout" yaml:"secondsOfTimeout"`
+	SecondsOfComponentTimeout ComponentStopTimeoutsConfig `mapstructure:"secondsOfComponentTimeout" yaml:"secondsOfComponentTimeout"`
 }
 
 type ApplicationConfig struct {
-	Server            ServerConfig   `mapstructure:"server" yaml:"server"`
-	Postgre           PostgreConfig  `mapstructure:"postgre" yaml:"postgre"`
-	Security          SecurityConfig `mapstructure:"security" yaml:"security"`
-	OtelTraceEndpoint string         `mapstructure:"otel_trace_endpoint" yaml:"otel_trace_endpoint"`
+	Server            ServerConfig       `mapstructure:"server" yaml:"server"`
+	Grpc              GrpcConfig         `mapstructure:"grpc" yaml:"grpc"`
+	Postgre           PostgreConfig      `mapstructure:"postgre" yaml:"postgre"`
+	Security          SecurityConfig     `mapstructure:"security" yaml:"security"`
+	Notification      NotificationConfig `mapstructure:"notification" yaml:"notification"`
+	Tenancy           TenancyConfig      `mapstructure:"tenancy" yaml:"tenancy"`
+	RateLimit         RateLimitConfig    `mapstructure:"rateLimit" yaml:"rateLimit"`
+	Idempotency       IdempotencyConfig  `mapstructure:"idempotency" yaml:"idempotency"`
+	OpenAPI           OpenAPIConfig      `mapstructure:"openapi" yaml:"openapi"`
+	Versioning        VersioningConfig   `mapstructure:"versioning" yaml:"versioning"`
+	Jobs              JobsConfig         `mapstructure:"jobs" yaml:"jobs"`
+	Scheduler         SchedulerConfig    `mapstructure:"scheduler" yaml:"scheduler"`
+	Health            HealthConfig       `mapstructure:"health" yaml:"health"`
+	Shutdown          ShutdownConfig     `mapstructure:"shutdown" yaml:"shutdown"`
+	UserImport        UserImportConfig   `mapstructure:"userImport" yaml:"userImport"`
+	OtelTraceEndpoint string             `mapstructure:"otel_trace_endpoint" yaml:"otel_trace_endpoint"`
 }
@@ -0,0 +1,226 @@
+// Package cron parses the five field cron expressions of crontab(5):
+// minute, hour, day of month, month and day of week.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// A day matches either day field when both are restricted, and both
+	// when either is a *, as in Vixie cron.
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField     = field{name: "minute", min: 0, max: 59}
+	hourField       = field{name: "hour", min: 0, max: 23}
+	dayOfMonthField = field{name: "day of month", min: 1, max: 31}
+	monthField      = field{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	// Sunday is both 0 and 7.
+	dayOfWeekField = field{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses an expression such as "*/15 * * * *" or "0 3 * * mon-fri",
+// or one of the descriptors @yearly, @monthly, @weekly, @daily and @hourly.
+// Fields are lists of values, ranges and steps; months and days of the
+// week may be given by their three letter English names.
+func Parse(expression string) (*Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "@") {
+		standard, ok := descriptors[strings.ToLower(expression)]
+		if !ok {
+			return nil, fmt.Errorf("cron: unknown descriptor %q", expression)
+		}
+		expression = standard
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron: %q has %d fields, expected 5", expression, len(fields))
+	}
+
+	var (
+		schedule Schedule
+		err      error
+	)
+	if schedule.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfMonth, err = dayOfMonthField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfWeek, err = dayOfWeekField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfWeek&(1<<7) != 0 {
+		schedule.dayOfWeek |= 1
+	}
+	schedule.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	schedule.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+	return &schedule, nil
+}
+
+func (f field) parse(expression string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expression, ",") {
+		bits, err := f.parsePart(part)
+		if err != nil {
+			return 0, fmt.Errorf("cron: %s %q: %w", f.name, expression, err)
+		}
+		set |= bits
+	}
+	return set, nil
+}
+
+func (f field) parsePart(part string) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		var err error
+		if step, err = strconv.Atoi(stepPart); err != nil || step < 1 {
+			return 0, fmt.Errorf("invalid step %q", stepPart)
+		}
+	}
+
+	var low, high int
+	switch lowPart, highPart, isRange := strings.Cut(rangePart, "-"); {
+	case rangePart == "*":
+		low, high = f.min, f.max
+	case isRange:
+		var err error
+		if low, err = f.value(lowPart); err != nil {
+			return 0, err
+		}
+		if high, err = f.value(highPart); err != nil {
+			return 0, err
+		}
+		if low > high {
+			return 0, fmt.Errorf("range %q ends before it starts", rangePart)
+		}
+	default:
+		var err error
+		if low, err = f.value(rangePart); err != nil {
+			return 0, err
+		}
+		// A single value with a step, like 5/15, runs to the end of the
+		// field.
+		high = low
+		if hasStep {
+			high = f.max
+		}
+	}
+
+	var set uint64
+	for value := low; value <= high; value += step {
+		set |= 1 << value
+	}
+	return set, nil
+}
+
+func (f field) value(text string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(text, name) {
+			return f.min + i, nil
+		}
+	}
+	value, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", text)
+	}
+	if value < f.min || value > f.max {
+		return 0, fmt.Errorf("%d is outside %d-%d", value, f.min, f.max)
+	}
+	return value, nil
+}
+
+// Next returns the first time after t that the schedule matches, in the
+// location of t. It returns the zero time if there is none within five
+// years, as for the 30th of February.
+//
+// Schedules in a location with daylight saving time skip the runs that
+// fall into the hour lost in spring and repeat those in the hour gained in
+// autumn; schedule in UTC to avoid both.
+func (s *Schedule) Next(t time.Time) time.Time {
+	location := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+
+	// Each loop advances the coarsest field that does not match and resets
+	// the finer ones, starting over whenever a coarser field changed.
+wrap:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+	for !has(s.month, int(t.Month())) {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+	for !s.matchesDay(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+	for !has(s.hour, t.Hour()) {
+		// Added rather than rebuilt with time.Date, which would keep
+		// landing on the first of a repeated hour.
+		t = t.Add(time.Hour - time.Duration(t.Minute())*time.Minute)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+	for !has(s.minute, t.Minute()) {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+	return t
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := has(s.dayOfMonth, t.Day())
+	dayOfWeek := has(s.dayOfWeek, int(t.Weekday()))
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<value) != 0
+}
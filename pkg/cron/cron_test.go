@@ -0,0 +1,110 @@
+package cron
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+	}{
+		{"too few fields", "* * * *"},
+		{"too many fields", "* * * * * *"},
+		{"minute out of range", "60 * * * *"},
+		{"hour out of range", "* 24 * * *"},
+		{"day of month out of range", "* * 0 * *"},
+		{"month out of range", "* * * 13 *"},
+		{"day of week out of range", "* * * * 8"},
+		{"zero step", "*/0 * * * *"},
+		{"negative step", "*/-5 * * * *"},
+		{"backwards range", "5-1 * * * *"},
+		{"not a number", "a * * * *"},
+		{"unknown month name", "* * * foo *"},
+		{"day name in the month field", "* * * mon *"},
+		{"empty list entry", "1,,2 * * * *"},
+		{"unknown descriptor", "@reboot"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse(test.expression); err == nil {
+				t.Fatalf("Parse(%q) succeeded", test.expression)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		location   *time.Location
+		from       time.Time
+		want       time.Time
+	}{
+		// 2026-01-01 is a Thursday.
+		{"every minute", "* * * * *", time.UTC, utc(2026, 1, 1, 10, 7).Add(30 * time.Second), utc(2026, 1, 1, 10, 8)},
+		{"strictly after", "30 3 * * *", time.UTC, utc(2026, 1, 1, 3, 30), utc(2026, 1, 2, 3, 30)},
+		{"step", "*/15 * * * *", time.UTC, utc(2026, 1, 1, 10, 7), utc(2026, 1, 1, 10, 15)},
+		{"step into the next hour", "*/15 * * * *", time.UTC, utc(2026, 1, 1, 10, 45), utc(2026, 1, 1, 11, 0)},
+		{"step from a value", "5/20 * * * *", time.UTC, utc(2026, 1, 1, 10, 26), utc(2026, 1, 1, 10, 45)},
+		{"range", "0 9-17 * * *", time.UTC, utc(2026, 1, 1, 17, 0), utc(2026, 1, 2, 9, 0)},
+		{"range with step", "0 9-17/4 * * *", time.UTC, utc(2026, 1, 1, 13, 0), utc(2026, 1, 1, 17, 0)},
+		{"list of ranges and values", "1-3,10 * * * *", time.UTC, utc(2026, 1, 1, 10, 3), utc(2026, 1, 1, 10, 10)},
+		{"days of month", "0 0 1,15 * *", time.UTC, utc(2026, 1, 2, 0, 0), utc(2026, 1, 15, 0, 0)},
+		{"month and day names", "0 12 * JUL,jan Mon-Fri", time.UTC, utc(2026, 2, 1, 0, 0), utc(2026, 7, 1, 12, 0)},
+		{"sunday as 0", "0 0 * * 0", time.UTC, utc(2026, 1, 1, 0, 0), utc(2026, 1, 4, 0, 0)},
+		{"sunday as 7", "0 0 * * 7", time.UTC, utc(2026, 1, 1, 0, 0), utc(2026, 1, 4, 0, 0)},
+		{"range to sunday as 7", "0 0 * * 6-7", time.UTC, utc(2026, 1, 1, 0, 0), utc(2026, 1, 3, 0, 0)},
+		{"year wrap", "0 0 1 1 *", time.UTC, utc(2026, 6, 1, 0, 0), utc(2027, 1, 1, 0, 0)},
+		{"descriptor", "@hourly", time.UTC, utc(2026, 1, 1, 10, 0), utc(2026, 1, 1, 11, 0)},
+		{"weekly descriptor", "@weekly", time.UTC, utc(2026, 1, 1, 0, 0), utc(2026, 1, 4, 0, 0)},
+
+		// Restricted in both day fields, either matches.
+		{"day of week before day of month", "0 0 13 * fri", time.UTC, utc(2026, 1, 1, 0, 0), utc(2026, 1, 2, 0, 0)},
+		{"day of month before day of week", "0 0 13 * fri", time.UTC, utc(2026, 1, 10, 0, 0), utc(2026, 1, 13, 0, 0)},
+		// A field starting with * is unrestricted, so both have to match.
+		{"day of week with any day of month", "0 0 * * mon", time.UTC, utc(2026, 1, 1, 0, 0), utc(2026, 1, 5, 0, 0)},
+		{"day of week with a stepped day of month", "0 0 */2 * tue", time.UTC, utc(2026, 1, 1, 0, 0), utc(2026, 1, 13, 0, 0)},
+		{"day of month with a stepped day of week", "0 0 1 * */3", time.UTC, utc(2026, 1, 2, 0, 0), utc(2026, 2, 1, 0, 0)},
+
+		{"31st skips short months", "0 0 31 * *", time.UTC, utc(2026, 4, 1, 0, 0), utc(2026, 5, 31, 0, 0)},
+		{"31st skips february", "0 0 31 * *", time.UTC, utc(2026, 2, 1, 0, 0), utc(2026, 3, 31, 0, 0)},
+		{"last day of february in a leap year", "0 0 29 2 *", time.UTC, utc(2026, 1, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"never", "0 0 30 2 *", time.UTC, utc(2026, 1, 1, 0, 0), time.Time{}},
+
+		// New York springs forward on 2026-03-08 at 2:00 EST, to 3:00 EDT,
+		// and falls back on 2026-11-01 at 2:00 EDT, to 1:00 EST.
+		{"lost hour is skipped", "30 2 * * *", newYork, utc(2026, 3, 7, 8, 0), utc(2026, 3, 9, 6, 30)},
+		{"hourly across the lost hour", "0 * * * *", newYork, utc(2026, 3, 8, 6, 30), utc(2026, 3, 8, 7, 0)},
+		{"daily after the lost hour", "0 12 * * *", newYork, utc(2026, 3, 7, 17, 0), utc(2026, 3, 8, 16, 0)},
+		{"gained hour first time", "30 1 * * *", newYork, utc(2026, 11, 1, 4, 0), utc(2026, 11, 1, 5, 30)},
+		{"gained hour repeated", "30 1 * * *", newYork, utc(2026, 11, 1, 5, 30), utc(2026, 11, 1, 6, 30)},
+		{"after the gained hour", "30 1 * * *", newYork, utc(2026, 11, 1, 6, 30), utc(2026, 11, 2, 6, 30)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := Parse(test.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := schedule.Next(test.from.In(test.location))
+			if !got.Equal(test.want) {
+				t.Fatalf("Next(%s) = %s, want %s", test.from.In(test.location), got, test.want.In(test.location))
+			}
+			if !got.IsZero() && got.Location() != test.location {
+				t.Fatalf("Next returned a time in %s, want %s", got.Location(), test.location)
+			}
+		})
+	}
+}
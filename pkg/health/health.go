@@ -0,0 +1,160 @@
+// Package health runs the named checks the readiness of the service
+// depends on and reports their outcome.
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type Status string
+
+const (
+	StatusUp Status = "UP"
+	// StatusDegraded is reported when only non-critical checks fail. The
+	// service is still ready.
+	StatusDegraded Status = "DEGRADED"
+	StatusDown     Status = "DOWN"
+)
+
+// Checker returns an error when the dependency it checks is unusable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+type Config struct {
+	// CacheTTL is how long the result of a check is reused, so that
+	// frequent probes from several sources do not hammer the dependencies.
+	CacheTTL time.Duration
+	// Timeout bounds each check, which fails when it runs out.
+	Timeout time.Duration
+}
+
+type CheckResult struct {
+	Status   Status `json:"status"`
+	Critical bool   `json:"critical"`
+	// Error may tell hosts and credentials of the dependency, so it is
+	// logged rather than served to probes, and only reported to
+	// authenticated clients.
+	Error string `json:"error,omitempty"`
+	// Duration is how long the check took, in milliseconds.
+	Duration  int64     `json:"durationMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+type Report struct {
+	Status Status                 `json:"status"`
+	Reason string                 `json:"reason,omitempty"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type check struct {
+	name     string
+	critical bool
+	checker  Checker
+
+	// mu is held while the check runs, so concurrent probes wait for the
+	// running check instead of starting another.
+	mu     sync.Mutex
+	result CheckResult
+}
+
+// Registry holds the checks of the service. A critical check that fails
+// makes the service not ready; a non-critical one only degrades it.
+type Registry struct {
+	config       Config
+	checks       []*check
+	shuttingDown atomic.Bool
+}
+
+func NewRegistry(config Config) *Registry {
+	return &Registry{config: config}
+}
+
+// Register adds a check. Checks are registered before the first report.
+func (r *Registry) Register(name string, critical bool, checker Checker) {
+	r.checks = append(r.checks, &check{name: name, critical: critical, checker: checker})
+}
+
+// Shutdown makes the service not ready from now on, so it is taken out of
+// load balancing while it drains.
+func (r *Registry) Shutdown() {
+	r.shuttingDown.Store(true)
+}
+
+// Live reports whether the process is able to serve at all. It does not
+// run the checks: a dependency that is down is no reason to restart.
+func (r *Registry) Live() Report {
+	return Report{Status: StatusUp}
+}
+
+// Ready runs the checks, or reuses their recent results, and reports
+// whether the service should receive traffic.
+func (r *Registry) Ready(ctx context.Context) Report {
+	if r.shuttingDown.Load() {
+		return Report{Status: StatusDown, Reason: "shutting down"}
+	}
+
+	results := make([]CheckResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(r.checks))}
+	for i, c := range r.checks {
+		result := results[i]
+		report.Checks[c.name] = result
+		switch {
+		case result.Status == StatusUp:
+		case c.critical:
+			report.Status = StatusDown
+		case report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c *check) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.result.CheckedAt.IsZero() && time.Since(c.result.CheckedAt) < r.config.CacheTTL {
+		return c.result
+	}
+
+	// The probe that triggered the check may give up on it; the result is
+	// still cached for the next one.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.checker.Check(ctx)
+	c.result = CheckResult{
+		Status:    StatusUp,
+		Critical:  c.critical,
+		Duration:  time.Since(start).Milliseconds(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		c.result.Status, c.result.Error = StatusDown, err.Error()
+		zap.L().Warn("health check failed", zap.String("check", c.name), zap.Bool("critical", c.critical), zap.Error(err))
+	}
+	return c.result
+}
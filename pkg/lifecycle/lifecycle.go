@@ -0,0 +1,226 @@
+// Package lifecycle starts the components of the service in the order of
+// their dependencies and stops them in reverse.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Hook starts or stops a component. Start hooks return once the component
+// runs, leaving long running work like serving to goroutines.
+type Hook func(ctx context.Context) error
+
+type Component struct {
+	Name string
+	// DependsOn names the components that are started before this one and
+	// stopped after it.
+	DependsOn []string
+	Start     Hook
+	Stop      Hook
+	// StopTimeout bounds Stop. Zero leaves it to the timeout of the whole
+	// shutdown.
+	StopTimeout time.Duration
+}
+
+type Config struct {
+	// NotReady is called first when stopping, to take the service out of
+	// load balancing.
+	NotReady func()
+	// PreStopDelay is how long the service keeps serving once it is not
+	// ready, so load balancers notice before connections are refused.
+	PreStopDelay time.Duration
+	// StopTimeout bounds stopping all components, after the delay.
+	StopTimeout time.Duration
+}
+
+// Manager runs the registered components until the service is told to stop
+// or one of them fails.
+type Manager struct {
+	config     Config
+	components []Component
+	started    []Component
+	failures   chan error
+}
+
+func NewManager(config Config) *Manager {
+	return &Manager{config: config, failures: make(chan error, 1)}
+}
+
+// Register adds a component. Components are registered before Run.
+func (m *Manager) Register(component Component) {
+	m.components = append(m.components, component)
+}
+
+// Fail reports that a component stopped on its own, like a server whose
+// listener broke. It makes Run stop the service.
+func (m *Manager) Fail(name string, err error) {
+	select {
+	case m.failures <- fmt.Errorf("lifecycle: %s failed: %w", name, err):
+	default:
+	}
+}
+
+// Run starts the components, waits until ctx is done or a component fails
+// and stops the components that started. It returns every error on the
+// way, so a nil error means the service started and stopped cleanly.
+func (m *Manager) Run(ctx context.Context) error {
+	err := m.start(ctx)
+	if err == nil {
+		zap.L().Info("service started")
+		select {
+		case <-ctx.Done():
+			zap.L().Info("service stopping")
+		case err = <-m.failures:
+			zap.L().Error("service stopping after a failure", zap.Error(err))
+		}
+	}
+	return errors.Join(err, m.stop(err == nil))
+}
+
+func (m *Manager) start(ctx context.Context) error {
+	ordered, err := m.order()
+	if err != nil {
+		return err
+	}
+	for _, component := range ordered {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if component.Start != nil {
+			if err := component.Start(ctx); err != nil {
+				return fmt.Errorf("lifecycle: start %s: %w", component.Name, err)
+			}
+		}
+		m.started = append(m.started, component)
+		zap.L().Info("component started", zap.String("component", component.Name))
+	}
+	return nil
+}
+
+// order sorts the components so that each follows its dependencies,
+// keeping the order they were registered in otherwise.
+func (m *Manager) order() ([]Component, error) {
+	byName := make(map[string]Component, len(m.components))
+	for _, component := range m.components {
+		if _, ok := byName[component.Name]; ok {
+			return nil, fmt.Errorf("lifecycle: component %s is registered twice", component.Name)
+		}
+		byName[component.Name] = component
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(m.components))
+	ordered := make([]Component, 0, len(m.components))
+	var visit func(component Component, path []string) error
+	visit = func(component Component, path []string) error {
+		path = append(path, component.Name)
+		switch state[component.Name] {
+		case visiting:
+			return fmt.Errorf("lifecycle: components depend on each other: %s", strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		state[component.Name] = visiting
+		for _, name := range component.DependsOn {
+			dependency, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("lifecycle: %s depends on %s, which is not registered", component.Name, name)
+			}
+			if err := visit(dependency, path); err != nil {
+				return err
+			}
+		}
+		state[component.Name] = visited
+		ordered = append(ordered, component)
+		return nil
+	}
+	for _, component := range m.components {
+		if err := visit(component, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// stop stops the started components in reverse. A service that never was
+// ready has no traffic to drain, so the delay is skipped.
+func (m *Manager) stop(wasReady bool) error {
+	if m.config.NotReady != nil {
+		m.config.NotReady()
+	}
+	if wasReady && m.config.PreStopDelay > 0 {
+		zap.L().Info("waiting before stopping", zap.Duration("delay", m.config.PreStopDelay))
+		time.Sleep(m.config.PreStopDelay)
+	}
+
+	ctx := context.Background()
+	if m.config.StopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.config.StopTimeout)
+		defer cancel()
+	}
+
+	var errs []error
+	for i := len(m.started) - 1; i >= 0; i-- {
+		component := m.started[i]
+		if component.Stop == nil {
+			continue
+		}
+		start := time.Now()
+		err := stopComponent(ctx, component)
+		fields := []zap.Field{zap.String("component", component.Name), zap.Duration("duration", time.Since(start))}
+		if err != nil {
+			zap.L().Error("component failed to stop", append(fields, zap.Error(err))...)
+			errs = append(errs, fmt.Errorf("lifecycle: stop %s: %w", component.Name, err))
+			continue
+		}
+		zap.L().Info("component stopped", fields...)
+	}
+	m.started = nil
+	return errors.Join(errs...)
+}
+
+// abortGrace is how long a hook has to return once its context is done.
+const abortGrace = 100 * time.Millisecond
+
+// stopComponent gives up on a hook that outlives its timeout, so one
+// component that hangs does not keep the others from stopping. Components
+// still running when the timeout of the whole shutdown is over are stopped
+// with a context that is already done, which makes them stop abruptly.
+func stopComponent(ctx context.Context, component Component) error {
+	if component.StopTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, component.StopTimeout)
+		defer cancel()
+	}
+
+	var err error
+	stopped := make(chan struct{})
+	go func() {
+		err = component.Stop(ctx)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return err
+	case <-ctx.Done():
+		// Hooks react to ctx by stopping abruptly, which takes a moment.
+		select {
+		case <-stopped:
+			return err
+		case <-time.After(abortGrace):
+			return fmt.Errorf("did not stop in time: %w", ctx.Err())
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder collects the hooks that ran, in order.
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) hook(event string) Hook {
+	return func(ctx context.Context) error {
+		r.record(event)
+		return nil
+	}
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.events)
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []Component
+		want       []string
+		wantErr    string
+	}{
+		{
+			name:       "registration order without dependencies",
+			components: []Component{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			want:       []string{"a", "b", "c"},
+		},
+		{
+			name: "dependencies first",
+			components: []Component{
+				{Name: "http", DependsOn: []string{"jobQueue", "database"}},
+				{Name: "jobQueue", DependsOn: []string{"database"}},
+				{Name: "tracer"},
+				{Name: "database"},
+			},
+			want: []string{"database", "jobQueue", "http", "tracer"},
+		},
+		{
+			name:       "shared dependency once",
+			components: []Component{{Name: "b", DependsOn: []string{"a"}}, {Name: "c", DependsOn: []string{"a"}}, {Name: "a"}},
+			want:       []string{"a", "b", "c"},
+		},
+		{
+			name:       "cycle",
+			components: []Component{{Name: "a", DependsOn: []string{"b"}}, {Name: "b", DependsOn: []string{"c"}}, {Name: "c", DependsOn: []string{"a"}}},
+			wantErr:    "depend on each other: a -> b -> c -> a",
+		},
+		{
+			name:       "depends on itself",
+			components: []Component{{Name: "a", DependsOn: []string{"a"}}},
+			wantErr:    "depend on each other: a -> a",
+		},
+		{
+			name:       "missing dependency",
+			components: []Component{{Name: "http", DependsOn: []string{"database"}}},
+			wantErr:    "http depends on database, which is not registered",
+		},
+		{
+			name:       "registered twice",
+			components: []Component{{Name: "a"}, {Name: "a"}},
+			wantErr:    "a is registered twice",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewManager(Config{})
+			for _, component := range test.components {
+				m.Register(component)
+			}
+			ordered, err := m.order()
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := make([]string, len(ordered))
+			for i, component := range ordered {
+				names[i] = component.Name
+			}
+			if !slices.Equal(names, test.want) {
+				t.Fatalf("order = %v, want %v", names, test.want)
+			}
+		})
+	}
+}
+
+func TestRunStopsInReverse(t *testing.T) {
+	events := &recorder{}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager(Config{NotReady: func() { events.record("not ready") }})
+	m.Register(Component{Name: "http", DependsOn: []string{"database"}, Start: events.hook("start http"), Stop: events.hook("stop http")})
+	m.Register(Component{Name: "database", Start: events.hook("start database"), Stop: events.hook("stop database")})
+	m.Register(Component{Name: "tracer", Stop: events.hook("stop tracer")})
+	// The last component to start tells the service to stop.
+	m.Register(Component{Name: "signal", Start: func(ctx context.Context) error {
+		cancel()
+		return nil
+	}})
+
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start database", "start http", "not ready", "stop tracer", "stop http", "stop database"}
+	if got := events.recorded(); !slices.Equal(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+}
+
+func TestRunStopsOnlyStartedComponents(t *testing.T) {
+	events := &recorder{}
+	failure := errors.New("address already in use")
+	m := NewManager(Config{PreStopDelay: time.Hour})
+	m.Register(Component{Name: "database", Start: events.hook("start database"), Stop: events.hook("stop database")})
+	m.Register(Component{Name: "http", DependsOn: []string{"database"}, Start: func(ctx context.Context) error { return failure }, Stop: events.hook("stop http")})
+	m.Register(Component{Name: "grpc", DependsOn: []string{"http"}, Start: events.hook("start grpc"), Stop: events.hook("stop grpc")})
+
+	// A service that never was ready skips the delay, or Run would not
+	// return within the test's deadline.
+	err := m.Run(context.Background())
+	if !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+	want := []string{"start database", "stop database"}
+	if got := events.recorded(); !slices.Equal(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+}
+
+func TestRunWaitsForThePreStopDelay(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	var notReady, stopped time.Time
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewManager(Config{NotReady: func() { notReady = time.Now() }, PreStopDelay: delay})
+	m.Register(Component{
+		Name:  "http",
+		Start: func(ctx context.Context) error { cancel(); return nil },
+		Stop:  func(ctx context.Context) error { stopped = time.Now(); return nil },
+	})
+
+	if err := m.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stopped.Sub(notReady) < delay {
+		t.Fatalf("stopped %s after turning not ready, want at least %s", stopped.Sub(notReady), delay)
+	}
+}
+
+func TestFailStopsWithAnError(t *testing.T) {
+	events := &recorder{}
+	failure := errors.New("listener closed")
+	m := NewManager(Config{})
+	m.Register(Component{
+		Name: "http",
+		Start: func(ctx context.Context) error {
+			go m.Fail("http", failure)
+			return nil
+		},
+		Stop: events.hook("stop http"),
+	})
+
+	// main exits with 1 whenever Run returns an error.
+	err := m.Run(context.Background())
+	if !errors.Is(err, failure) || !strings.Contains(err.Error(), "http failed") {
+		t.Fatalf("err = %v, want the failure of http", err)
+	}
+	if got := events.recorded(); !slices.Equal(got, []string{"stop http"}) {
+		t.Fatalf("events = %v, want http stopped", got)
+	}
+}
+
+// blocking ignores its context, like a hook that hangs.
+func blocking(release <-chan struct{}) Hook {
+	return func(ctx context.Context) error {
+		<-release
+		return nil
+	}
+}
+
+// aborting stops abruptly once its context is done.
+func aborting(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestStopTimeouts(t *testing.T) {
+	tests := []struct {
+		name             string
+		stopTimeout      time.Duration
+		componentTimeout time.Duration
+		hook             func(release <-chan struct{}) Hook
+		wantErr          string
+		// within is the longest stopping may take.
+		within time.Duration
+	}{
+		{
+			name:             "component timeout aborts the hook",
+			componentTimeout: 20 * time.Millisecond,
+			hook:             func(<-chan struct{}) Hook { return aborting },
+			wantErr:          context.DeadlineExceeded.Error(),
+			within:           20*time.Millisecond + abortGrace,
+		},
+		{
+			name:             "component timeout gives up on a hanging hook",
+			componentTimeout: 20 * time.Millisecond,
+			hook:             blocking,
+			wantErr:          "did not stop in time",
+			within:           20*time.Millisecond + 2*abortGrace,
+		},
+		{
+			name:        "global timeout gives up on a hanging hook",
+			stopTimeout: 20 * time.Millisecond,
+			hook:        blocking,
+			wantErr:     "did not stop in time",
+			within:      20*time.Millisecond + 2*abortGrace,
+		},
+		{
+			name:             "global timeout ends before the component's",
+			stopTimeout:      20 * time.Millisecond,
+			componentTimeout: time.Hour,
+			hook:             blocking,
+			wantErr:          "did not stop in time",
+			within:           20*time.Millisecond + 2*abortGrace,
+		},
+		{
+			name:             "hook returning in time",
+			stopTimeout:      time.Hour,
+			componentTimeout: time.Hour,
+			hook:             func(<-chan struct{}) Hook { return func(ctx context.Context) error { return nil } },
+			within:           abortGrace,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			release := make(chan struct{})
+			defer close(release)
+
+			events := &recorder{}
+			ctx, cancel := context.WithCancel(context.Background())
+			m := NewManager(Config{StopTimeout: test.stopTimeout})
+			m.Register(Component{Name: "database", Stop: events.hook("stop database")})
+			m.Register(Component{
+				Name:        "http",
+				DependsOn:   []string{"database"},
+				Start:       func(ctx context.Context) error { cancel(); return nil },
+				Stop:        test.hook(release),
+				StopTimeout: test.componentTimeout,
+			})
+
+			start := time.Now()
+			err := m.Run(ctx)
+			if elapsed := time.Since(start); elapsed > test.within {
+				t.Fatalf("stopping took %s, want at most %s", elapsed, test.within)
+			}
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), "stop http") || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("err = %v, want http to fail to stop with %q", err, test.wantErr)
+			}
+			// The component after the one that hung is still stopped.
+			if got := events.recorded(); !slices.Equal(got, []string{"stop database"}) {
+				t.Fatalf("events = %v, want the database stopped", got)
+			}
+		})
+	}
+}
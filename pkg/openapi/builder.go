@@ -0,0 +1,251 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Builder collects operations into a document as routes are registered.
+type Builder struct {
+	document      *Document
+	generator     *generator
+	errorResponse *Schema
+	parameters    []*Parameter
+	mediaTypes    []string
+}
+
+// OperationSpec describes a route in terms of its handler's request and
+// response types.
+type OperationSpec struct {
+	Method      string
+	Path        string
+	OperationId string
+	Summary     string
+	Tag         string
+	Request     reflect.Type
+	// UploadMediaTypes documents a body taken as it is in one of the media
+	// types, like an uploaded file, instead of the request type's fields.
+	UploadMediaTypes []string
+	Response         reflect.Type
+	// Redirect documents a 302 with a Location header instead of a JSON
+	// body.
+	Redirect bool
+	// StreamMediaTypes documents a body streamed in one of the media types
+	// instead of the response type.
+	StreamMediaTypes []string
+	Security         []SecurityRequirement
+	// Parameters are documented in addition to those of the request type,
+	// e.g. headers read by middleware.
+	Parameters []*Parameter
+	// Deprecated marks operations of an API version that is being phased
+	// out.
+	Deprecated bool
+}
+
+var pathParameter = regexp.MustCompile(`:([A-Za-z0-9_]+)\??`)
+
+func NewBuilder(info Info) *Builder {
+	generator := newGenerator()
+	return &Builder{
+		document: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   make(map[string]PathItem),
+			Components: Components{
+				Schemas:         generator.schemas,
+				SecuritySchemes: make(map[string]*SecurityScheme),
+			},
+		},
+		generator: generator,
+	}
+}
+
+// ErrorResponse sets the body type of the default response every operation
+// documents for failures.
+func (b *Builder) ErrorResponse(t reflect.Type) {
+	b.errorResponse = b.generator.schema(t, output)
+}
+
+func (b *Builder) SecurityScheme(name string, scheme *SecurityScheme) {
+	b.document.Components.SecuritySchemes[name] = scheme
+}
+
+// MediaTypes documents request and response bodies in the given media
+// types besides JSON, with the same schemas. Error bodies stay JSON.
+func (b *Builder) MediaTypes(mediaTypes ...string) {
+	b.mediaTypes = append(b.mediaTypes, mediaTypes...)
+}
+
+// Parameter adds a parameter to every operation, e.g. a header read by
+// middleware in front of all routes.
+func (b *Builder) Parameter(parameter *Parameter) {
+	b.parameters = append(b.parameters, parameter)
+}
+
+func (b *Builder) Add(spec OperationSpec) {
+	path := pathParameter.ReplaceAllString(spec.Path, "{$1}")
+	operation := &Operation{
+		OperationId: spec.OperationId,
+		Summary:     spec.Summary,
+		Responses:   make(map[string]*Response),
+		Security:    spec.Security,
+		Deprecated:  spec.Deprecated,
+	}
+	if spec.Tag != "" {
+		operation.Tags = []string{spec.Tag}
+		b.tag(spec.Tag)
+	}
+
+	if spec.Request != nil {
+		b.request(operation, spec.Method, underlying(spec.Request))
+	}
+	if len(spec.UploadMediaTypes) > 0 {
+		content := make(map[string]MediaType, len(spec.UploadMediaTypes))
+		for _, mediaType := range spec.UploadMediaTypes {
+			content[mediaType] = MediaType{}
+		}
+		operation.RequestBody = &RequestBody{Required: true, Content: content}
+	}
+	for _, match := range pathParameter.FindAllStringSubmatch(spec.Path, -1) {
+		declared := slices.ContainsFunc(operation.Parameters, func(parameter *Parameter) bool {
+			return parameter.In == "path" && parameter.Name == match[1]
+		})
+		if !declared {
+			operation.Parameters = append(operation.Parameters, &Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	operation.Parameters = append(operation.Parameters, spec.Parameters...)
+	operation.Parameters = append(operation.Parameters, b.parameters...)
+
+	switch {
+	case spec.Redirect:
+		operation.Responses[strconv.Itoa(http.StatusFound)] = &Response{
+			Description: "Redirect",
+			Headers: map[string]*Header{
+				"Location": {Schema: &Schema{Type: "string", Format: "uri"}},
+			},
+		}
+	case len(spec.StreamMediaTypes) > 0:
+		content := make(map[string]MediaType, len(spec.StreamMediaTypes))
+		for _, mediaType := range spec.StreamMediaTypes {
+			content[mediaType] = MediaType{}
+		}
+		operation.Responses[strconv.Itoa(http.StatusOK)] = &Response{Description: "OK", Content: content}
+	case spec.Response != nil:
+		operation.Responses[strconv.Itoa(http.StatusOK)] = &Response{
+			Description: "OK",
+			Content:     b.content(b.generator.schema(spec.Response, output)),
+		}
+	default:
+		operation.Responses[strconv.Itoa(http.StatusOK)] = &Response{Description: "OK"}
+	}
+	if b.errorResponse != nil {
+		operation.Responses["default"] = &Response{Description: "Error", Content: jsonContent(b.errorResponse)}
+	}
+
+	item, ok := b.document.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		b.document.Paths[path] = item
+	}
+	item[strings.ToLower(spec.Method)] = operation
+}
+
+// Document returns the document built so far. It keeps changing while
+// operations are added.
+func (b *Builder) Document() *Document {
+	return b.document
+}
+
+// request splits the request type the way the handlers parse it: params,
+// query, reqHeader and cookie fields become parameters and json and form fields the
+// body.
+func (b *Builder) request(operation *Operation, method string, t reflect.Type) {
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	body := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	bodyOnly, form := true, false
+	for _, f := range fields(t) {
+		validation := f.Tag.Get("validate")
+		in, name := parameterLocation(f)
+		if in != "" {
+			bodyOnly = false
+			if in == "header" && strings.EqualFold(name, "Authorization") {
+				continue
+			}
+			schema := b.generator.schema(f.Type, input)
+			required := applyValidation(schema, f.Type, validation)
+			operation.Parameters = append(operation.Parameters, &Parameter{
+				Name:     name,
+				In:       in,
+				Required: required || in == "path",
+				Schema:   schema,
+			})
+			continue
+		}
+
+		name, omitempty, ok := jsonName(f)
+		if formName := f.Tag.Get("form"); formName != "" && formName != "-" {
+			form = true
+			if f.Tag.Get("json") == "" {
+				name, ok = strings.Split(formName, ",")[0], true
+			}
+		}
+		if !ok {
+			continue
+		}
+		schema := b.generator.field(f.Type, input, omitempty)
+		if applyValidation(schema, f.Type, validation) {
+			body.Required = append(body.Required, name)
+		}
+		body.Properties[name] = schema
+	}
+
+	if len(body.Properties) == 0 || method == http.MethodGet || method == http.MethodHead {
+		return
+	}
+	schema := body
+	if bodyOnly && t.Name() != "" {
+		schema = b.generator.schema(t, input)
+	}
+
+	content := b.content(schema)
+	if form {
+		content["application/x-www-form-urlencoded"] = MediaType{Schema: schema}
+	}
+	operation.RequestBody = &RequestBody{Required: len(body.Required) > 0, Content: content}
+}
+
+func (b *Builder) tag(name string) {
+	if !slices.ContainsFunc(b.document.Tags, func(tag Tag) bool { return tag.Name == name }) {
+		b.document.Tags = append(b.document.Tags, Tag{Name: name})
+	}
+}
+
+func parameterLocation(f reflect.StructField) (string, string) {
+	for tag, in := range map[string]string{"params": "path", "query": "query", "reqHeader": "header", "cookie": "cookie"} {
+		if name, ok := f.Tag.Lookup(tag); ok && name != "-" {
+			return in, strings.Split(name, ",")[0]
+		}
+	}
+	return "", ""
+}
+
+// content documents a body in JSON and the additional media types.
+func (b *Builder) content(schema *Schema) map[string]MediaType {
+	content := jsonContent(schema)
+	for _, mediaType := range b.mediaTypes {
+		content[mediaType] = MediaType{Schema: schema}
+	}
+	return content
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
@@ -0,0 +1,30 @@
+// Package openapitest checks in tests that handlers respond the way the
+// OpenAPI document says they do.
+package openapitest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/openapi"
+)
+
+// ContractMiddleware fails the test whenever a response body does not
+// match the schema its operation declares for the status. Install it with
+// app.Use before the routes are registered; responses of undocumented
+// routes such as /metrics are not checked.
+func ContractMiddleware(t testing.TB, validator *openapi.Validator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+
+		response := c.Response()
+		err := validator.ValidateResponse(c.Method(), c.Route().Path, response.StatusCode(), string(response.Header.ContentType()), response.Body())
+		if err != nil && !errors.Is(err, openapi.ErrUndocumented) {
+			t.Errorf("response does not match the OpenAPI document: %v", err)
+		}
+		return nil
+	}
+}
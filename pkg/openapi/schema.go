@@ -0,0 +1,331 @@
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Schema is the subset of JSON Schema 2020-12 the generator produces.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+}
+
+// direction tells request schemas, whose required fields come from the
+// validate tag, apart from response schemas, where every field json always
+// writes is required and nil pointers, slices and maps are null.
+type direction int
+
+const (
+	input direction = iota
+	output
+)
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+type componentKey struct {
+	t         reflect.Type
+	direction direction
+}
+
+type generator struct {
+	schemas map[string]*Schema
+	names   map[componentKey]string
+}
+
+func newGenerator() *generator {
+	return &generator{schemas: make(map[string]*Schema), names: make(map[componentKey]string)}
+}
+
+// schema returns the schema of t, registering named structs as components
+// and referencing them.
+func (g *generator) schema(t reflect.Type, dir direction) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: ptr(0.0)}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &Schema{Type: "array", Items: g.field(t.Elem(), dir, false)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.field(t.Elem(), dir, false)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t, dir)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t, dir)}
+	default:
+		return &Schema{}
+	}
+}
+
+// field is the schema of a struct field or element, null included where
+// json writes it.
+func (g *generator) field(t reflect.Type, dir direction, omitempty bool) *Schema {
+	schema := g.schema(t, dir)
+	if dir == input && t.Kind() != reflect.Pointer || omitempty {
+		return schema
+	}
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return nullable(schema)
+	}
+	return schema
+}
+
+func (g *generator) component(t reflect.Type, dir direction) string {
+	key := componentKey{t: t, direction: dir}
+	if name, ok := g.names[key]; ok {
+		return name
+	}
+
+	name := exported(t.Name())
+	if _, taken := g.schemas[name]; taken {
+		name = exported(packageName(t)) + exported(t.Name())
+	}
+	if _, taken := g.schemas[name]; taken && dir == input {
+		name += "Input"
+	}
+
+	g.names[key] = name
+	g.schemas[name] = &Schema{}
+	*g.schemas[name] = *g.object(t, dir)
+	return name
+}
+
+func (g *generator) object(t reflect.Type, dir direction) *Schema {
+	object := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, f := range fields(t) {
+		name, omitempty, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+
+		schema := g.field(f.Type, dir, omitempty)
+		required := applyValidation(schema, f.Type, f.Tag.Get("validate"))
+		object.Properties[name] = schema
+
+		if dir == input && required || dir == output && !omitempty {
+			object.Required = append(object.Required, name)
+		}
+	}
+	return object
+}
+
+// fields lists the exported fields of t, with those of embedded structs
+// promoted the way encoding/json does.
+func fields(t reflect.Type) []reflect.StructField {
+	var result []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				result = append(result, fields(embedded)...)
+				continue
+			}
+		}
+		if f.IsExported() {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func jsonName(f reflect.StructField) (string, bool, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, strings.Contains(","+options+",", ",omitempty,"), true
+}
+
+// applyValidation maps go-playground/validator rules onto the schema and
+// reports whether the field is required. Rules without a JSON Schema
+// counterpart are left out; the handler still enforces them.
+func applyValidation(schema *Schema, t reflect.Type, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	target, kind := schema, underlying(t).Kind()
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		if strings.Contains(name, "|") {
+			continue
+		}
+
+		switch name {
+		case "required":
+			if target == schema {
+				required = true
+			}
+		case "dive":
+			items := target.Items
+			if items == nil && len(target.AnyOf) > 0 {
+				items = target.AnyOf[0].Items
+			}
+			if items == nil || items.Ref != "" {
+				return required
+			}
+			target, kind = items, underlying(underlying(t).Elem()).Kind()
+		case "min", "gte":
+			setBound(target, kind, param, func(n float64) { target.Minimum = &n }, func(n int) { target.MinLength = &n }, func(n int) { target.MinItems = &n })
+		case "max", "lte":
+			setBound(target, kind, param, func(n float64) { target.Maximum = &n }, func(n int) { target.MaxLength = &n }, func(n int) { target.MaxItems = &n })
+		case "gt":
+			setBound(target, kind, param, func(n float64) { target.ExclusiveMinimum = &n }, func(n int) { n++; target.MinLength = &n }, func(n int) { n++; target.MinItems = &n })
+		case "lt":
+			setBound(target, kind, param, func(n float64) { target.ExclusiveMaximum = &n }, func(n int) { n--; target.MaxLength = &n }, func(n int) { n--; target.MaxItems = &n })
+		case "len":
+			setBound(target, kind, param, func(n float64) { target.Minimum, target.Maximum = &n, &n }, func(n int) { target.MinLength, target.MaxLength = &n, &n }, func(n int) { target.MinItems, target.MaxItems = &n, &n })
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				target.Enum = append(target.Enum, enumValue(kind, value))
+			}
+		case "email":
+			target.Format = "email"
+		case "url", "uri", "http_url":
+			target.Format = "uri"
+		case "uuid", "uuid4":
+			target.Format = "uuid"
+		case "hostname", "hostname_rfc1123":
+			target.Format = "hostname"
+		case "ipv4", "ipv6":
+			target.Format = name
+		case "alphanum":
+			target.Pattern = "^[a-zA-Z0-9]*$"
+		case "numeric":
+			target.Pattern = "^[-+]?[0-9]+(\\.[0-9]+)?$"
+		}
+	}
+	return required
+}
+
+// setBound applies a numeric rule parameter the way validator interprets
+// it for the kind: a value for numbers, a length for strings and a count
+// for collections. Rules without a parameter, e.g. "gt" on a time, are
+// skipped.
+func setBound(schema *Schema, kind reflect.Kind, param string, number func(float64), length func(int), count func(int)) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+
+	switch kind {
+	case reflect.String:
+		length(int(n))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		count(int(n))
+	case reflect.Struct:
+	default:
+		if schema.Type == "integer" || schema.Type == "number" {
+			number(n)
+		}
+	}
+}
+
+func enumValue(kind reflect.Kind, value string) any {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+func nullable(schema *Schema) *Schema {
+	switch typ := schema.Type.(type) {
+	case string:
+		schema.Type = []string{typ, "null"}
+		return schema
+	case nil:
+		if schema.Ref == "" {
+			return schema
+		}
+	}
+	return &Schema{AnyOf: []*Schema{schema, {Type: "null"}}}
+}
+
+func underlying(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func packageName(t reflect.Type) string {
+	path := t.PkgPath()
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+func exported(name string) string {
+	if name == "" {
+		return name
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
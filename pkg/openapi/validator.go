@@ -0,0 +1,386 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// documentURL identifies the document within the schema compiler; schemas
+// are compiled from locations in it so component references resolve.
+const documentURL = "urn:openapi"
+
+var (
+	ErrUndocumented           = errors.New("operation is not documented")
+	ErrUnsupportedContentType = apperror.New(apperror.CodeUnsupportedMediaType, "unsupported content type")
+
+	printer = message.NewPrinter(language.English)
+)
+
+// Request is what the validator needs to know of an incoming request.
+type Request struct {
+	Method string
+	// Path is the route as registered, e.g. "/users/:id".
+	Path        string
+	Params      map[string]string
+	Query       url.Values
+	Header      http.Header
+	ContentType string
+	Body        []byte
+}
+
+// Validator checks requests and responses against a document. Schemas are
+// compiled on first use, so it can be created while operations are still
+// being added to the document.
+type Validator struct {
+	document *Document
+
+	once     sync.Once
+	compiler *jsonschema.Compiler
+	err      error
+
+	mu      sync.Mutex
+	schemas map[string]*jsonschema.Schema
+}
+
+func NewValidator(document *Document) *Validator {
+	return &Validator{document: document, schemas: make(map[string]*jsonschema.Schema)}
+}
+
+// ValidateRequest returns a validation error listing every parameter and
+// body field that does not match the operation. Undocumented operations
+// pass.
+func (v *Validator) ValidateRequest(request *Request) error {
+	path, operation := v.operation(request.Method, request.Path)
+	if operation == nil {
+		return nil
+	}
+	location := "#/paths/" + pointerEscape(path) + "/" + strings.ToLower(request.Method)
+
+	var fields []apperror.FieldError
+	for i, parameter := range operation.Parameters {
+		values := parameterValues(request, parameter)
+		if len(values) == 0 {
+			if parameter.Required {
+				fields = append(fields, apperror.FieldError{Field: parameter.Name, Rule: "required", Message: "is required"})
+			}
+			continue
+		}
+
+		var value any = coerce(parameter.Schema, values[0])
+		if v.resolve(parameter.Schema).Type == "array" {
+			value = coerceAll(parameter.Schema.Items, values)
+		}
+		schemaFields, err := v.validate(fmt.Sprintf("%s/parameters/%d/schema", location, i), parameter.Name, value)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, schemaFields...)
+	}
+
+	if operation.RequestBody != nil {
+		bodyFields, err := v.validateBody(location, operation.RequestBody, request)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, bodyFields...)
+	}
+
+	if len(fields) > 0 {
+		return apperror.Validation(fields...)
+	}
+	return nil
+}
+
+// ValidateResponse checks a response body against the schema the operation
+// declares for its status, falling back to the default response.
+func (v *Validator) ValidateResponse(method, route string, status int, contentType string, body []byte) error {
+	path, operation := v.operation(method, route)
+	if operation == nil {
+		return fmt.Errorf("%s %s: %w", method, route, ErrUndocumented)
+	}
+
+	code := strconv.Itoa(status)
+	response, ok := operation.Responses[code]
+	if !ok {
+		if response, ok = operation.Responses["default"]; !ok {
+			return fmt.Errorf("%s %s: status %d is not documented", method, route, status)
+		}
+		code = "default"
+	}
+	if len(response.Content) == 0 {
+		return nil
+	}
+
+	mediaType := mediaTypeOf(contentType)
+	content, ok := response.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s: content type %q is not documented for status %d", method, route, contentType, status)
+	}
+	// Streamed bodies, such as NDJSON exports, are documented by media type
+	// only.
+	if content.Schema == nil {
+		return nil
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s %s: decoding response body: %w", method, route, err)
+	}
+
+	location := "#/paths/" + pointerEscape(path) + "/" + strings.ToLower(method) + "/responses/" + code + "/content/" + pointerEscape(mediaType) + "/schema"
+	schema, err := v.schema(location)
+	if err != nil {
+		return err
+	}
+	if err := schema.Validate(instance); err != nil {
+		return fmt.Errorf("%s %s: status %d: %w", method, route, status, err)
+	}
+	return nil
+}
+
+func (v *Validator) validateBody(location string, body *RequestBody, request *Request) ([]apperror.FieldError, error) {
+	if len(bytes.TrimSpace(request.Body)) == 0 {
+		if body.Required {
+			return []apperror.FieldError{{Field: "body", Rule: "required", Message: "is required"}}, nil
+		}
+		return nil, nil
+	}
+
+	mediaType := mediaTypeOf(request.ContentType)
+	content, ok := body.Content[mediaType]
+	if !ok {
+		return nil, ErrUnsupportedContentType
+	}
+	// Bodies without a schema, like uploaded files, are left to the handler.
+	if content.Schema == nil {
+		return nil, nil
+	}
+
+	var instance any
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(request.Body))
+		if err != nil {
+			return []apperror.FieldError{{Field: "body", Rule: "form", Message: err.Error()}}, nil
+		}
+		instance = v.formObject(content.Schema, values)
+	default:
+		decoded, err := jsonschema.UnmarshalJSON(bytes.NewReader(request.Body))
+		if err != nil {
+			return []apperror.FieldError{{Field: "body", Rule: "json", Message: err.Error()}}, nil
+		}
+		instance = decoded
+	}
+
+	return v.validate(location+"/requestBody/content/"+pointerEscape(mediaType)+"/schema", "", instance)
+}
+
+// validate reports schema violations of the instance as field errors named
+// after the instance location below field.
+func (v *Validator) validate(location, field string, instance any) ([]apperror.FieldError, error) {
+	schema, err := v.schema(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var validationError *jsonschema.ValidationError
+	if err := schema.Validate(instance); !errors.As(err, &validationError) {
+		return nil, err
+	}
+	return fieldErrors(validationError, field), nil
+}
+
+func (v *Validator) schema(location string) (*jsonschema.Schema, error) {
+	v.once.Do(func() { v.compiler, v.err = v.newCompiler() })
+	if v.err != nil {
+		return nil, v.err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if schema, ok := v.schemas[location]; ok {
+		return schema, nil
+	}
+	schema, err := v.compiler.Compile(documentURL + location)
+	if err != nil {
+		return nil, err
+	}
+	v.schemas[location] = schema
+	return schema, nil
+}
+
+func (v *Validator) newCompiler() (*jsonschema.Compiler, error) {
+	encoded, err := json.Marshal(v.document)
+	if err != nil {
+		return nil, err
+	}
+	document, err := jsonschema.UnmarshalJSON(bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	if err := compiler.AddResource(documentURL, document); err != nil {
+		return nil, err
+	}
+	return compiler, nil
+}
+
+func (v *Validator) operation(method, route string) (string, *Operation) {
+	path := pathParameter.ReplaceAllString(route, "{$1}")
+	return path, v.document.Paths[path][strings.ToLower(method)]
+}
+
+// resolve follows a component reference, so parameter and form values can
+// be converted by the type they are declared with.
+func (v *Validator) resolve(schema *Schema) *Schema {
+	if schema == nil {
+		return &Schema{}
+	}
+	if name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/"); ok {
+		if component, ok := v.document.Components.Schemas[name]; ok {
+			return component
+		}
+	}
+	return schema
+}
+
+func (v *Validator) formObject(schema *Schema, values url.Values) map[string]any {
+	properties := v.resolve(schema).Properties
+	object := make(map[string]any, len(values))
+	for name, value := range values {
+		property := v.resolve(properties[name])
+		if property.Type == "array" {
+			object[name] = coerceAll(property.Items, value)
+			continue
+		}
+		object[name] = coerce(property, value[0])
+	}
+	return object
+}
+
+func parameterValues(request *Request, parameter *Parameter) []string {
+	switch parameter.In {
+	case "path":
+		if value, ok := request.Params[parameter.Name]; ok && value != "" {
+			return []string{value}
+		}
+	case "query":
+		return request.Query[parameter.Name]
+	case "header":
+		return request.Header.Values(parameter.Name)
+	case "cookie":
+		if cookie, err := (&http.Request{Header: request.Header}).Cookie(parameter.Name); err == nil {
+			return []string{cookie.Value}
+		}
+	}
+	return nil
+}
+
+// coerce converts a string from the path, query, headers, cookies or a form to the
+// type the schema declares. Values that do not convert are left strings for
+// the schema to reject.
+func coerce(schema *Schema, value string) any {
+	switch primaryType(schema) {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+func coerceAll(schema *Schema, values []string) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = coerce(schema, value)
+	}
+	return result
+}
+
+func primaryType(schema *Schema) string {
+	if schema == nil {
+		return ""
+	}
+	switch typ := schema.Type.(type) {
+	case string:
+		return typ
+	case []string:
+		for _, t := range typ {
+			if t != "null" {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// fieldErrors flattens the leaves of a validation error. Missing properties
+// are reported under their own names rather than their parent's.
+func fieldErrors(err *jsonschema.ValidationError, field string) []apperror.FieldError {
+	if len(err.Causes) > 0 {
+		var fields []apperror.FieldError
+		for _, cause := range err.Causes {
+			fields = append(fields, fieldErrors(cause, field)...)
+		}
+		return fields
+	}
+
+	location := err.InstanceLocation
+	if field != "" {
+		location = append([]string{field}, location...)
+	}
+	name := strings.Join(location, ".")
+	if required, ok := err.ErrorKind.(*kind.Required); ok {
+		fields := make([]apperror.FieldError, len(required.Missing))
+		for i, missing := range required.Missing {
+			if name != "" {
+				missing = name + "." + missing
+			}
+			fields[i] = apperror.FieldError{Field: missing, Rule: "required", Message: "is required"}
+		}
+		return fields
+	}
+
+	rule := ""
+	if keywords := err.ErrorKind.KeywordPath(); len(keywords) > 0 {
+		rule = keywords[len(keywords)-1]
+	}
+	if name == "" {
+		name = "body"
+	}
+	return []apperror.FieldError{{Field: name, Rule: rule, Message: err.ErrorKind.LocalizedString(printer)}}
+}
+
+func mediaTypeOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mediaType
+}
+
+// pointerEscape escapes a JSON pointer token and the characters of it a
+// URL fragment cannot hold.
+func pointerEscape(token string) string {
+	token = strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	return strings.NewReplacer("{", "%7B", "}", "%7D").Replace(token)
+}
@@ -0,0 +1,67 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+const prefixLength = 5
+
+// BreachedList is a local copy of breached password hashes, indexed the way
+// the Have I Been Pwned range API is: SHA-1 hashes are bucketed by their
+// first five hex characters and only suffixes are stored per bucket. No
+// network call is made at runtime.
+type BreachedList struct {
+	buckets map[string][]string
+}
+
+// LoadBreachedList reads a file with one upper case hex SHA-1 hash per line,
+// optionally followed by ":<count>" as in the HIBP downloads. Empty lines and
+// lines starting with "#" are ignored.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	list := &BreachedList{buckets: make(map[string][]string)}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(text, ":")
+		hash = strings.ToUpper(hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha1.Size*2 {
+			return nil, fmt.Errorf("%s:%d: invalid sha1 hash", path, line)
+		}
+
+		prefix := hash[:prefixLength]
+		list.buckets[prefix] = append(list.buckets[prefix], hash[prefixLength:])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, suffixes := range list.buckets {
+		slices.Sort(suffixes)
+	}
+	return list, nil
+}
+
+func (l *BreachedList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes := l.buckets[hash[:prefixLength]]
+	_, found := slices.BinarySearch(suffixes, hash[prefixLength:])
+	return found
+}
@@ -0,0 +1,154 @@
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ccojocar/zxcvbn-go"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+)
+
+const (
+	RuleMinLength    = "min_length"
+	RuleMaxLength    = "max_length"
+	RuleUppercase    = "uppercase"
+	RuleLowercase    = "lowercase"
+	RuleDigit        = "digit"
+	RuleSymbol       = "symbol"
+	RuleStrength     = "strength"
+	RulePersonalInfo = "personal_info"
+	RuleBreached     = "breached"
+)
+
+type Config struct {
+	MinLength            int
+	MaxLength            int
+	RequireUppercase     bool
+	RequireLowercase     bool
+	RequireDigit         bool
+	RequireSymbol        bool
+	MinStrengthScore     int
+	DisallowPersonalInfo bool
+}
+
+// Violation describes a single rule a password failed.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+type Policy struct {
+	config   Config
+	breached *BreachedList
+}
+
+// New returns a policy enforcing config. breached may be nil to skip the
+// breached password check.
+func New(config Config, breached *BreachedList) *Policy {
+	return &Policy{config: config, breached: breached}
+}
+
+// Validate checks password against every rule and returns all violations.
+// personal holds values such as the email and names of the account, which
+// the password must not contain.
+func (p *Policy) Validate(password string, personal ...string) []Violation {
+	var violations []Violation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.config.MinLength {
+		violations = append(violations, Violation{RuleMinLength, fmt.Sprintf("must be at least %d characters long", p.config.MinLength)})
+	}
+	if p.config.MaxLength > 0 && length > p.config.MaxLength {
+		violations = append(violations, Violation{RuleMaxLength, fmt.Sprintf("must be at most %d characters long", p.config.MaxLength)})
+		// Skip the remaining checks, strength estimation is expensive for
+		// arbitrarily long input.
+		return violations
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r), unicode.IsSymbol(r), unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.config.RequireUppercase && !upper {
+		violations = append(violations, Violation{RuleUppercase, "must contain an uppercase letter"})
+	}
+	if p.config.RequireLowercase && !lower {
+		violations = append(violations, Violation{RuleLowercase, "must contain a lowercase letter"})
+	}
+	if p.config.RequireDigit && !digit {
+		violations = append(violations, Violation{RuleDigit, "must contain a digit"})
+	}
+	if p.config.RequireSymbol && !symbol {
+		violations = append(violations, Violation{RuleSymbol, "must contain a symbol"})
+	}
+
+	inputs := personalInputs(personal)
+	if p.config.DisallowPersonalInfo && containsAny(strings.ToLower(password), inputs) {
+		violations = append(violations, Violation{RulePersonalInfo, "must not contain your name or email address"})
+	}
+
+	if p.config.MinStrengthScore > 0 {
+		if score := zxcvbn.PasswordStrength(password, inputs).Score; score < p.config.MinStrengthScore {
+			violations = append(violations, Violation{RuleStrength, "is too easy to guess"})
+		}
+	}
+
+	if p.breached != nil && p.breached.Contains(password) {
+		violations = append(violations, Violation{RuleBreached, "has appeared in a data breach and must not be used"})
+	}
+
+	return violations
+}
+
+// personalInputs splits personal values into lower case fragments worth
+// matching, e.g. "ahmet.yildirim@example.com" yields "ahmet" and "yildirim".
+func personalInputs(values []string) []string {
+	var inputs []string
+	for _, value := range values {
+		local, _, _ := strings.Cut(strings.ToLower(value), "@")
+		fields := strings.FieldsFunc(local, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for _, field := range fields {
+			if utf8.RuneCountInString(field) >= 3 {
+				inputs = append(inputs, field)
+			}
+		}
+	}
+	return inputs
+}
+
+func containsAny(s string, fragments []string) bool {
+	for _, fragment := range fragments {
+		if strings.Contains(s, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check validates password and reports violations as field errors of the
+// given request field.
+func (p *Policy) Check(field string, password string, personal ...string) error {
+	violations := p.Validate(password, personal...)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	fields := make([]apperror.FieldError, len(violations))
+	for i, violation := range violations {
+		fields[i] = apperror.FieldError{Field: field, Rule: violation.Rule, Message: violation.Message}
+	}
+	return apperror.Validation(fields...)
+}
@@ -0,0 +1,165 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+)
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func writeList(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func rules(violations []Violation) []string {
+	names := make([]string, len(violations))
+	for i, violation := range violations {
+		names[i] = violation.Rule
+	}
+	return names
+}
+
+func TestValidate(t *testing.T) {
+	breached, err := LoadBreachedList(writeList(t, sha1Hex("Summer-2024!")+":12\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		password string
+		personal []string
+		want     []string
+	}{
+		{"no rules", Config{}, "a", nil, nil},
+		{"too short", Config{MinLength: 12}, "short-one", nil, []string{RuleMinLength}},
+		{"long enough", Config{MinLength: 12}, "long-enough-one", nil, nil},
+		{"length counts characters, not bytes", Config{MinLength: 4}, "äöüß", nil, nil},
+		{"too long skips the other rules", Config{MaxLength: 8, RequireDigit: true, MinStrengthScore: 4}, "much-too-long", nil, []string{RuleMaxLength}},
+		{"every character class missing", Config{RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSymbol: true}, "", nil, []string{RuleUppercase, RuleLowercase, RuleDigit, RuleSymbol}},
+		{"every character class present", Config{RequireUppercase: true, RequireLowercase: true, RequireDigit: true, RequireSymbol: true}, "Aa1 ", nil, nil},
+		{"unicode classes", Config{RequireUppercase: true, RequireLowercase: true, RequireSymbol: true}, "Ğış€", nil, nil},
+		{"too easy to guess", Config{MinStrengthScore: 3}, "password1", nil, []string{RuleStrength}},
+		{"hard to guess", Config{MinStrengthScore: 3}, "velvet-quarry-harbor-81", nil, nil},
+		{"personal info allowed", Config{}, "ada-lovelace-1815", []string{"ada@example.com", "Ada", "Lovelace"}, nil},
+		{"contains the last name", Config{DisallowPersonalInfo: true}, "i-am-LOVELACE", []string{"ada@example.com", "Ada", "Lovelace"}, []string{RulePersonalInfo}},
+		{"contains the email's local part", Config{DisallowPersonalInfo: true}, "xx-yildirim-xx", []string{"ahmet.yildirim@example.com"}, []string{RulePersonalInfo}},
+		{"email domain is not personal", Config{DisallowPersonalInfo: true}, "example-garden", []string{"ahmet.yildirim@example.com"}, nil},
+		{"short fragments are ignored", Config{DisallowPersonalInfo: true}, "bo-jo-garden", []string{"Bo", "Jo"}, nil},
+		{"personal info lowers the strength", Config{MinStrengthScore: 3}, "grace.hopper", []string{"grace.hopper@example.com"}, []string{RuleStrength}},
+		{"breached", Config{}, "Summer-2024!", nil, []string{RuleBreached}},
+		{"not breached", Config{}, "Summer-2025!", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := New(test.config, breached)
+			if got := rules(policy.Validate(test.password, test.personal...)); !slices.Equal(got, test.want) {
+				t.Fatalf("Validate(%q) violates %v, want %v", test.password, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	policy := New(Config{MinLength: 12, RequireDigit: true}, nil)
+	if err := policy.Check("password", "long-enough-1"); err != nil {
+		t.Fatalf("Check = %v, want nil", err)
+	}
+
+	err := policy.Check("newPassword", "short")
+	if apperror.CodeOf(err) != apperror.CodeInvalidArgument {
+		t.Fatalf("Check = %v, want a validation error", err)
+	}
+	fields := apperror.FieldsOf(err)
+	if len(fields) != 2 || fields[0].Field != "newPassword" || fields[0].Rule != RuleMinLength || fields[1].Rule != RuleDigit {
+		t.Fatalf("fields = %+v, want newPassword to violate %s and %s", fields, RuleMinLength, RuleDigit)
+	}
+}
+
+func TestLoadBreachedList(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		breached []string
+		clean    []string
+		wantErr  bool
+	}{
+		{
+			name:     "hashes with counts, comments and empty lines",
+			content:  "# hibp export\n\n" + sha1Hex("hunter2") + ":17\n" + sha1Hex("letmein") + "\n",
+			breached: []string{"hunter2", "letmein"},
+			clean:    []string{"Hunter2", "hunter3", ""},
+		},
+		{
+			name:     "lower case and surrounding spaces",
+			content:  "  " + strings.ToLower(sha1Hex("hunter2")) + ":3  \n",
+			breached: []string{"hunter2"},
+		},
+		{
+			name:     "several suffixes in one bucket",
+			content:  bucketed(t, "hunter2", 3),
+			breached: []string{"hunter2"},
+		},
+		{"empty", "", nil, []string{"hunter2"}, false},
+		{"too short", "ABCDEF\n", nil, nil, true},
+		{"not hex", strings.Repeat("Z", 40) + "\n", nil, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			list, err := LoadBreachedList(writeList(t, test.content))
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("LoadBreachedList succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, password := range test.breached {
+				if !list.Contains(password) {
+					t.Errorf("Contains(%q) = false, want true", password)
+				}
+			}
+			for _, password := range test.clean {
+				if list.Contains(password) {
+					t.Errorf("Contains(%q) = true, want false", password)
+				}
+			}
+		})
+	}
+
+	if _, err := LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("LoadBreachedList of a missing file succeeded")
+	}
+}
+
+// bucketed lists the hash of password among others sharing its prefix, in
+// descending order, so the lookup depends on the suffixes being sorted.
+func bucketed(t *testing.T, password string, others int) string {
+	t.Helper()
+	hash := sha1Hex(password)
+	lines := []string{hash}
+	for i := range others {
+		lines = append(lines, hash[:prefixLength]+strings.Repeat(string("FEDCBA"[i]), 40-prefixLength))
+	}
+	slices.Sort(lines)
+	slices.Reverse(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
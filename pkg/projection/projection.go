@@ -0,0 +1,164 @@
+// Package projection trims response bodies to the fields a client asks for,
+// e.g. with "?fields=id,email".
+package projection
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+)
+
+// Projector projects the resources of one response type: the objects and
+// arrays of objects it wraps, like the user of {"user": {...}}. Other
+// members of the response are kept as they are.
+type Projector struct {
+	fields []string
+}
+
+// New returns a projector for responses of type t, or nil when t wraps no
+// resources.
+func New(t reflect.Type) *Projector {
+	t = indirect(t)
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []string
+	for _, member := range jsonFields(t) {
+		resource := indirect(member.Type)
+		if resource.Kind() == reflect.Slice || resource.Kind() == reflect.Array {
+			resource = indirect(resource.Elem())
+		}
+		if resource.Kind() != reflect.Struct || resource == reflect.TypeFor[time.Time]() {
+			continue
+		}
+		for _, field := range jsonFields(resource) {
+			if name := jsonName(field); !slices.Contains(fields, name) {
+				fields = append(fields, name)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return &Projector{fields: fields}
+}
+
+// Fields returns the names that can be projected, in declaration order.
+func (p *Projector) Fields() []string {
+	return p.fields
+}
+
+// Parse splits a comma separated list of fields, rejecting names no
+// resource has.
+func (p *Projector) Parse(value string) ([]string, error) {
+	var fields []string
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(p.fields, field) {
+			return nil, apperror.Validation(apperror.FieldError{
+				Field:   "fields",
+				Rule:    "oneof",
+				Message: "fields must be one of " + strings.Join(p.fields, ", "),
+			})
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// Project returns response with only the given fields of its resources,
+// as maps keyed by the fields' json names that keep the Go values, so any
+// codec can encode them.
+func (p *Projector) Project(response any, fields []string) (any, error) {
+	value := reflect.Indirect(reflect.ValueOf(response))
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("projection: cannot project a %s", value.Type())
+	}
+
+	members := make(map[string]any)
+	for _, member := range jsonFields(value.Type()) {
+		name, omitempty := jsonName(member), hasOption(member, "omitempty")
+		memberValue := value.FieldByIndex(member.Index)
+		if omitempty && memberValue.IsZero() {
+			continue
+		}
+		members[name] = project(memberValue, fields)
+	}
+	return members, nil
+}
+
+// project keeps the fields of a resource or the resources of a list, and
+// returns other values as they are.
+func project(value reflect.Value, fields []string) any {
+	resource := reflect.Indirect(value)
+	switch {
+	case !resource.IsValid():
+		return nil
+	case resource.Kind() == reflect.Struct && resource.Type() != reflect.TypeFor[time.Time]():
+		kept := make(map[string]any, len(fields))
+		for _, field := range jsonFields(resource.Type()) {
+			name, fieldValue := jsonName(field), resource.FieldByIndex(field.Index)
+			if !slices.Contains(fields, name) || (hasOption(field, "omitempty") && fieldValue.IsZero()) {
+				continue
+			}
+			kept[name] = fieldValue.Interface()
+		}
+		return kept
+	case resource.Kind() == reflect.Slice && !resource.IsNil(), resource.Kind() == reflect.Array:
+		elements := make([]any, resource.Len())
+		for i := range elements {
+			elements[i] = project(resource.Index(i), fields)
+		}
+		return elements
+	default:
+		return value.Interface()
+	}
+}
+
+// jsonFields returns the encoded fields of t, flattening embedded structs
+// the way encoding/json does. Their Index is relative to t.
+func jsonFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			for _, embedded := range jsonFields(field.Type) {
+				embedded.Index = append([]int{i}, embedded.Index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func hasOption(field reflect.StructField, option string) bool {
+	_, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return slices.Contains(strings.Split(options, ","), option)
+}
+
+func jsonName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
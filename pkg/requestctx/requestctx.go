@@ -0,0 +1,16 @@
+package requestctx
+
+import "context"
+
+type clientIPKey struct{}
+
+// WithClientIP stores the address of the calling client, as resolved by the
+// transport, so handlers can use it without depending on fiber.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,46 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const apiKeyPrefix = "pk"
+
+// GenerateApiKey returns a key of the form pk_<prefix>_<secret> together
+// with its prefix. The prefix identifies the key and is unique, its 64 bits
+// keep collisions unlikely across billions of keys; the secret carries 256
+// bits of entropy.
+func GenerateApiKey() (key string, prefix string, err error) {
+	prefixBytes := make([]byte, 8)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		return "", "", err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	key = apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+	return key, prefix, nil
+}
+
+// ParseApiKeyPrefix extracts the prefix of a key produced by GenerateApiKey.
+func ParseApiKeyPrefix(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// HashApiKey hashes a key for storage. A fast hash is sufficient because
+// keys are random and long, unlike passwords.
+func HashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
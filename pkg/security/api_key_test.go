@@ -0,0 +1,18 @@
+package security
+
+import "testing"
+
+func TestGenerateApiKey(t *testing.T) {
+	key, prefix, err := GenerateApiKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prefix) != 16 {
+		t.Fatalf("prefix %q has %d characters, want 16", prefix, len(prefix))
+	}
+
+	parsed, ok := ParseApiKeyPrefix(key)
+	if !ok || parsed != prefix {
+		t.Fatalf("ParseApiKeyPrefix(%q) = %q, %v, want %q", key, parsed, ok, prefix)
+	}
+}
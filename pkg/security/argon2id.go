@@ -0,0 +1,120 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+type Argon2idParams struct {
+	MemoryKiB   uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// maxArgon2idMemoryKiB keeps a single hash from taking more than 4 GiB.
+const maxArgon2idMemoryKiB = 4 * 1024 * 1024
+
+// Validate checks the parameters against the bounds of RFC 9106, so that
+// argon2.IDKey, which panics or silently adjusts out of them, never sees
+// them.
+func (p Argon2idParams) Validate() error {
+	switch {
+	case p.Iterations < 1:
+		return fmt.Errorf("argon2id needs at least 1 iteration, got %d", p.Iterations)
+	case p.Parallelism < 1:
+		return fmt.Errorf("argon2id needs a parallelism of at least 1, got %d", p.Parallelism)
+	case p.MemoryKiB < 8*uint32(p.Parallelism) || p.MemoryKiB > maxArgon2idMemoryKiB:
+		return fmt.Errorf("argon2id needs between 8 KiB per lane and %d KiB of memory, got %d KiB", maxArgon2idMemoryKiB, p.MemoryKiB)
+	case p.SaltLength < 8:
+		return fmt.Errorf("argon2id needs a salt of at least 8 bytes, got %d", p.SaltLength)
+	case p.KeyLength < 16:
+		return fmt.Errorf("argon2id needs a key of at least 16 bytes, got %d", p.KeyLength)
+	}
+	return nil
+}
+
+// Argon2idHasher encodes hashes in the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>.
+type Argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) *Argon2idHasher {
+	return &Argon2idHasher{params: params}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.MemoryKiB, h.params.Parallelism, h.params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.MemoryKiB, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password string, encoded string) error {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.MemoryKiB, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params != h.params
+}
+
+func decodeArgon2id(encoded string) (Argon2idParams, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+
+	var params Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.MemoryKiB, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrMalformedHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	if err := params.Validate(); err != nil {
+		return Argon2idParams{}, nil, nil, fmt.Errorf("%w: %v", ErrMalformedHash, err)
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,26 @@
+package security
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// GenerateClientCredentials returns a client id and a 256-bit secret for an
+// OAuth2 client.
+func GenerateClientCredentials() (clientId string, secret string, err error) {
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", "", err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+	return "svc_" + hex.EncodeToString(idBytes), base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
+
+// HashClientSecret hashes a generated client secret for storage.
+func HashClientSecret(secret string) string {
+	return HashApiKey(secret)
+}
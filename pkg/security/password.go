@@ -1,15 +1,101 @@
 package security
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"errors"
+	"fmt"
+	"strings"
 
-func HashPassw(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch     = errors.New("password does not match")
+	ErrUnknownHashFormat    = errors.New("unknown password hash format")
+	ErrMalformedHash        = errors.New("malformed password hash")
+	ErrUnknownHashAlgorithm = errors.New("unknown password hashing algorithm")
+)
+
+// PasswordHasher hashes passwords into self describing strings that carry
+// the algorithm and its parameters, so stored hashes stay verifiable when
+// the configuration changes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch if password does not match encoded,
+	// and ErrUnknownHashFormat or ErrMalformedHash if encoded cannot be
+	// verified at all.
+	Verify(password string, encoded string) error
+	// NeedsRehash reports whether encoded was produced by another algorithm
+	// or with parameters other than the current ones.
+	NeedsRehash(encoded string) bool
+}
+
+type PasswordHashingConfig struct {
+	Algorithm  string
+	Argon2id   Argon2idParams
+	BcryptCost int
+}
+
+// NewPasswordHasher returns a hasher that hashes with the configured
+// algorithm and verifies hashes of every supported algorithm.
+func NewPasswordHasher(config PasswordHashingConfig) (PasswordHasher, error) {
+	argon2idHasher := NewArgon2idHasher(config.Argon2id)
+	bcryptHasher := NewBcryptHasher(config.BcryptCost)
+
+	// Parameters are checked when the hasher is built, so a bad
+	// configuration stops the service from starting instead of failing the
+	// first registration.
+	var current PasswordHasher
+	switch config.Algorithm {
+	case "argon2id":
+		if err := config.Argon2id.Validate(); err != nil {
+			return nil, err
+		}
+		current = argon2idHasher
+	case "bcrypt":
+		if bcryptHasher.cost < bcrypt.MinCost || bcryptHasher.cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt needs a cost between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, bcryptHasher.cost)
+		}
+		current = bcryptHasher
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownHashAlgorithm, config.Algorithm)
+	}
+
+	return &compositeHasher{current: current, argon2id: argon2idHasher, bcrypt: bcryptHasher}, nil
+}
+
+type compositeHasher struct {
+	current  PasswordHasher
+	argon2id *Argon2idHasher
+	bcrypt   *BcryptHasher
+}
+
+func (h *compositeHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *compositeHasher) Verify(password string, encoded string) error {
+	hasher, err := h.hasherFor(encoded)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return string(hashed), nil
+	return hasher.Verify(password, encoded)
 }
 
-func ValidatePassw(plain string, hashed string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(plain))
+func (h *compositeHasher) NeedsRehash(encoded string) bool {
+	hasher, err := h.hasherFor(encoded)
+	if err != nil || hasher != h.current {
+		return true
+	}
+	return hasher.NeedsRehash(encoded)
+}
+
+func (h *compositeHasher) hasherFor(encoded string) (PasswordHasher, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return h.argon2id, nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return h.bcrypt, nil
+	default:
+		return nil, ErrUnknownHashFormat
+	}
 }
@@ -0,0 +1,66 @@
+package security
+
+import (
+	"errors"
+	"testing"
+)
+
+var testArgon2idParams = Argon2idParams{MemoryKiB: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestNewPasswordHasherRejectsInvalidParameters(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PasswordHashingConfig
+	}{
+		{"no iterations", PasswordHashingConfig{Algorithm: "argon2id", Argon2id: Argon2idParams{MemoryKiB: 64, Parallelism: 1, SaltLength: 16, KeyLength: 32}}},
+		{"no parallelism", PasswordHashingConfig{Algorithm: "argon2id", Argon2id: Argon2idParams{MemoryKiB: 64, Iterations: 1, SaltLength: 16, KeyLength: 32}}},
+		{"too little memory", PasswordHashingConfig{Algorithm: "argon2id", Argon2id: Argon2idParams{MemoryKiB: 15, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32}}},
+		{"too much memory", PasswordHashingConfig{Algorithm: "argon2id", Argon2id: Argon2idParams{MemoryKiB: maxArgon2idMemoryKiB + 1, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}}},
+		{"short salt", PasswordHashingConfig{Algorithm: "argon2id", Argon2id: Argon2idParams{MemoryKiB: 64, Iterations: 1, Parallelism: 1, SaltLength: 4, KeyLength: 32}}},
+		{"short key", PasswordHashingConfig{Algorithm: "argon2id", Argon2id: Argon2idParams{MemoryKiB: 64, Iterations: 1, Parallelism: 1, SaltLength: 16}}},
+		{"bcrypt cost too low", PasswordHashingConfig{Algorithm: "bcrypt", BcryptCost: 3}},
+		{"bcrypt cost too high", PasswordHashingConfig{Algorithm: "bcrypt", BcryptCost: 32}},
+		{"unknown algorithm", PasswordHashingConfig{Algorithm: "md5"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewPasswordHasher(test.config); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherVerify(t *testing.T) {
+	hasher, err := NewPasswordHasher(PasswordHashingConfig{Algorithm: "argon2id", Argon2id: testArgon2idParams, BcryptCost: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		want     error
+	}{
+		{"match", "correct horse", encoded, nil},
+		{"mismatch", "battery staple", encoded, ErrPasswordMismatch},
+		{"unknown algorithm", "correct horse", "$md5$abc", ErrUnknownHashFormat},
+		{"truncated argon2id", "correct horse", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", ErrMalformedHash},
+		{"argon2id without iterations", "correct horse", "$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"argon2id without lanes", "correct horse", "$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U", ErrMalformedHash},
+		{"truncated bcrypt", "correct horse", "$2a$04$short", ErrMalformedHash},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := hasher.Verify(test.password, test.encoded)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Verify() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
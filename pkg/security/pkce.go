@@ -0,0 +1,27 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// GeneratePKCE returns a code verifier and its S256 code challenge as
+// defined by RFC 7636.
+func GeneratePKCE() (verifier string, challenge string, err error) {
+	verifier, err = RandomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomURLToken returns n random bytes encoded as unpadded base64url.
+func RandomURLToken(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
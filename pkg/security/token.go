@@ -1,10 +1,35 @@
 package security
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeMfaChallenge      = "mfa_challenge"
+)
+
+var (
+	ErrInvalidPurposeToken = errors.New("invalid token")
 )
 
+// PurposeClaims are the claims of a single purpose token, e.g. an email
+// verification link. Such tokens are signed with a key derived from the
+// purpose so they can never be used as access tokens.
+type PurposeClaims struct {
+	Purpose string `json:"purpose"`
+	Email   string `json:"email,omitempty"`
+	Tenant  string `json:"tenant,omitempty"`
+	jwt.RegisteredClaims
+}
+
 func GenerateRefreshToken() (string, error) {
 	bytes := make([]byte, 32) // 256-bit
 	if _, err := rand.Read(bytes); err != nil {
@@ -12,3 +37,29 @@ func GenerateRefreshToken() (string, error) {
 	}
 	return hex.EncodeToString(bytes), nil
 }
+
+func SignPurposeToken(secret string, claims PurposeClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(purposeKey(secret, claims.Purpose))
+}
+
+func ParsePurposeToken(secret string, purpose string, token string) (*PurposeClaims, error) {
+	var claims PurposeClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		return purposeKey(secret, purpose), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || claims.Purpose != purpose {
+		return nil, ErrInvalidPurposeToken
+	}
+	return &claims, nil
+}
+
+func purposeKey(secret string, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,61 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+)
+
+var (
+	ErrMissingTenant  = apperror.New(apperror.CodeInternal, "no tenant in context for tenant-owned data")
+	ErrForeignRecord  = apperror.New(apperror.CodeInternal, "record belongs to another tenant than the context")
+	ErrTenantMismatch = apperror.New(apperror.CodeForbidden, "credentials belong to another tenant")
+	ErrUnknownTenant  = apperror.New(apperror.CodeInvalidArgument, "unknown tenant")
+)
+
+// Source tells where the tenant of a request was taken from.
+type Source string
+
+const (
+	SourceDefault   Source = "default"
+	SourceHeader    Source = "header"
+	SourceSubdomain Source = "subdomain"
+	// SourceToken is a tenant taken from a signed credential, an access
+	// token claim or a purpose token.
+	SourceToken Source = "token"
+)
+
+type scope struct {
+	id     string
+	source Source
+	all    bool
+}
+
+type scopeKey struct{}
+
+// WithTenant scopes all tenant-owned data access made with ctx to the tenant.
+func WithTenant(ctx context.Context, id string, source Source) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{id: id, source: source})
+}
+
+// AllTenants lifts the tenant scope for work that legitimately spans
+// tenants, such as lookups by globally unique credentials and maintenance
+// tasks. It has to be asked for explicitly; a missing tenant is an error.
+func AllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope{all: true})
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	s, _ := ctx.Value(scopeKey{}).(scope)
+	return s.id, s.id != ""
+}
+
+func SourceOf(ctx context.Context) Source {
+	s, _ := ctx.Value(scopeKey{}).(scope)
+	return s.source
+}
+
+func IsAllTenants(ctx context.Context) bool {
+	s, _ := ctx.Value(scopeKey{}).(scope)
+	return s.all
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var errRateLimited = apperror.New(apperror.CodeTooManyRequests, "rate limit exceeded")
+
+var rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_rate_limit_rejections_total",
+	Help: "Requests rejected by the rate limiter",
+}, []string{"route", "method"})
+
+func init() {
+	prometheus.MustRegister(rateLimitRejections)
+}
+
+type rateLimitRule struct {
+	key    string
+	policy domain.RateLimitPolicy
+}
+
+func newRateLimitRule(ruleConfig config.RateLimitRuleConfig) (rateLimitRule, bool) {
+	if ruleConfig.Limit <= 0 || ruleConfig.SecondsOfWindow <= 0 {
+		return rateLimitRule{}, false
+	}
+	return rateLimitRule{
+		key:    ruleConfig.Key,
+		policy: domain.RateLimitPolicy{Limit: ruleConfig.Limit, Window: time.Duration(ruleConfig.SecondsOfWindow) * time.Second},
+	}, true
+}
+
+// RateLimitMiddleware is added to each route rather than the app, so that
+// c.Route() is the matched route its rule is looked up by, and runs after
+// authentication on protected routes so it can key by the principal. Store
+// errors let the request through; an outage of the limiter must not take
+// the API down with it.
+func RateLimitMiddleware(rateLimitConfig config.RateLimitConfig, store domain.RateLimitStore) fiber.Handler {
+	if !rateLimitConfig.Enabled {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+
+	rules := make(map[string]rateLimitRule, len(rateLimitConfig.Routes))
+	for _, ruleConfig := range rateLimitConfig.Routes {
+		if rule, ok := newRateLimitRule(ruleConfig); ok {
+			rules[ruleConfig.Method+" "+ruleConfig.Path] = rule
+		}
+	}
+	defaultRule, hasDefault := newRateLimitRule(rateLimitConfig.Default)
+
+	return func(c *fiber.Ctx) error {
+		route := c.Route()
+		path := unversionedPath(route.Path)
+		rule, ok := rules[route.Method+" "+path]
+		if !ok {
+			if !hasDefault {
+				return c.Next()
+			}
+			rule = defaultRule
+		}
+
+		key := route.Method + " " + path + "|" + rateLimitKey(c, rule.key)
+		result, err := store.Take(c.UserContext(), key, rule.policy, time.Now())
+		if err != nil {
+			zap.L().Warn("rate limiter unavailable", zap.String("route", route.Path), zap.Error(err))
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Policy", strconv.Itoa(rule.policy.Limit)+";w="+strconv.Itoa(int(rule.policy.Window.Seconds())))
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+		if !result.Allowed {
+			rateLimitRejections.WithLabelValues(route.Path, route.Method).Inc()
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			return c.Status(errorStatus(errRateLimited)).JSON(errorBody(errRateLimited))
+		}
+		return c.Next()
+	}
+}
+
+// rateLimitKey falls back from API key to user to IP, so anonymous callers
+// of a route keyed by user still get a budget of their own.
+func rateLimitKey(c *fiber.Ctx, key string) string {
+	principal, authenticated := pkgauth.FromContext(c.UserContext())
+
+	switch key {
+	case "route":
+		return "route"
+	case "api_key":
+		if authenticated && principal.Method == pkgauth.MethodApiKey {
+			return "api_key:" + principal.TokenId
+		}
+		fallthrough
+	case "user":
+		if authenticated {
+			return string(principal.Kind) + ":" + principal.Subject
+		}
+	}
+	return "ip:" + c.IP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
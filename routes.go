@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/app/apikey"
+	"github.com/knetic0/production-ready-go-cqrs/app/auth"
+	"github.com/knetic0/production-ready-go-cqrs/app/healthcheck"
+	"github.com/knetic0/production-ready-go-cqrs/app/oauth"
+	"github.com/knetic0/production-ready-go-cqrs/app/user"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure"
+	"github.com/knetic0/production-ready-go-cqrs/infrastructure/jobs"
+	pkgauth "github.com/knetic0/production-ready-go-cqrs/pkg/auth"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/health"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/openapi"
+	"gorm.io/gorm"
+)
+
+// handlers are the command and query handlers, constructed once and shared
+// by the HTTP and gRPC transports. Constructing them does not touch the
+// database or the notifier, so the openapi command runs it without either.
+type handlers struct {
+	healthCheck         *healthcheck.HealthCheckHandler
+	userCreate          *user.UserCreateHandler
+	userGet             *user.UserGetHandler
+	userList            *user.UserListHandler
+	userExport          *user.UserExportHandler
+	userImport          *user.UserImportHandler
+	userImportGet       *user.UserImportGetHandler
+	me                  *user.MeHandler
+	changePassword      *user.ChangePasswordHandler
+	login               *auth.LoginHandler
+	mfaVerify           *auth.MfaVerifyHandler
+	mfaEnroll           *auth.MfaEnrollHandler
+	mfaConfirm          *auth.MfaConfirmHandler
+	mfaDisable          *auth.MfaDisableHandler
+	verifyEmail         *auth.VerifyEmailHandler
+	resendVerification  *auth.ResendVerificationHandler
+	oidcLogin           *auth.OidcLoginHandler
+	oidcCallback        *auth.OidcCallbackHandler
+	apiKeyAuthenticator *apikey.Authenticator
+	apiKeyCreate        *apikey.ApiKeyCreateHandler
+	apiKeyList          *apikey.ApiKeyListHandler
+	apiKeyRevoke        *apikey.ApiKeyRevokeHandler
+	oauthToken          *oauth.TokenHandler
+}
+
+func newHandlers(applicationConfig *config.ApplicationConfig, db *gorm.DB, notifier domain.Notifier, queue *jobs.Queue, registry *health.Registry, client *http.Client) *handlers {
+	userRepository := infrastructure.NewUserRepositoryAdapter(db)
+	refreshTokenRepository := infrastructure.NewRefreshTokenRepositoryAdapter(db)
+	recoveryCodeRepository := infrastructure.NewRecoveryCodeRepositoryAdapter(db)
+	usedMfaChallengeRepository := infrastructure.NewUsedMfaChallengeRepositoryAdapter(db)
+	verificationMailer := auth.NewVerificationMailer(userRepository, notifier, applicationConfig.Security)
+	passwordHasher := initPasswordHasher(applicationConfig.Security.PasswordHashing)
+	passwordPolicy := initPasswordPolicy(applicationConfig.Security.PasswordPolicy)
+	tokenIssuer := auth.NewTokenIssuer(refreshTokenRepository, applicationConfig.Security)
+	loginThrottle := auth.NewLoginThrottle(initLoginAttemptStore(applicationConfig.Security.LoginThrottle, db), infrastructure.NewLogSecurityEventPublisher(), applicationConfig.Security.LoginThrottle)
+	apiKeyRepository := infrastructure.NewApiKeyRepositoryAdapter(db)
+	oauthClientRepository := infrastructure.NewOAuthClientRepositoryAdapter(db)
+	identityProviders := initIdentityProviders(applicationConfig.Security.Oidc, client)
+	oidcLoginStateRepository := infrastructure.NewOidcLoginStateRepositoryAdapter(db)
+	externalIdentityRepository := infrastructure.NewExternalIdentityRepositoryAdapter(db)
+	userImportRepository := infrastructure.NewUserImportRepositoryAdapter(db)
+	importer := user.NewUserImporter(userRepository, userImportRepository, passwordHasher, passwordPolicy, verificationMailer, validateRequest, initImportConfig(applicationConfig.UserImport))
+	jobs.Register(queue, "user.import", importer, jobs.Options{})
+
+	return &handlers{
+		healthCheck:         healthcheck.NewHealthCheckHandler(registry),
+		userCreate:          user.NewUserCreateHandler(userRepository, passwordHasher, passwordPolicy, verificationMailer),
+		userGet:             user.NewUserGetHandler(userRepository),
+		userList:            user.NewUserListHandler(userRepository),
+		userExport:          user.NewUserExportHandler(userRepository),
+		userImport:          user.NewUserImportHandler(userImportRepository, queue, applicationConfig.UserImport.MaxRows),
+		userImportGet:       user.NewUserImportGetHandler(userImportRepository),
+		me:                  user.NewMeHandler(userRepository),
+		changePassword:      user.NewChangePasswordHandler(userRepository, refreshTokenRepository, passwordHasher, passwordPolicy, loginThrottle),
+		login:               auth.NewLoginHandler(userRepository, passwordHasher, tokenIssuer, loginThrottle, applicationConfig.Security),
+		mfaVerify:           auth.NewMfaVerifyHandler(userRepository, recoveryCodeRepository, usedMfaChallengeRepository, tokenIssuer, loginThrottle, applicationConfig.Security),
+		mfaEnroll:           auth.NewMfaEnrollHandler(userRepository, applicationConfig.Security),
+		mfaConfirm:          auth.NewMfaConfirmHandler(userRepository, recoveryCodeRepository, applicationConfig.Security),
+		mfaDisable:          auth.NewMfaDisableHandler(userRepository, recoveryCodeRepository, passwordHasher, loginThrottle, applicationConfig.Security),
+		verifyEmail:         auth.NewVerifyEmailHandler(userRepository, applicationConfig.Security),
+		resendVerification:  auth.NewResendVerificationHandler(userRepository, verificationMailer, applicationConfig.Security),
+		oidcLogin:           auth.NewOidcLoginHandler(identityProviders, oidcLoginStateRepository, applicationConfig.Security.Oidc),
+		oidcCallback:        auth.NewOidcCallbackHandler(identityProviders, oidcLoginStateRepository, externalIdentityRepository, userRepository, passwordHasher, tokenIssuer, applicationConfig.Security),
+		apiKeyAuthenticator: apikey.NewAuthenticator(apiKeyRepository),
+		apiKeyCreate:        apikey.NewApiKeyCreateHandler(apiKeyRepository),
+		apiKeyList:          apikey.NewApiKeyListHandler(apiKeyRepository),
+		apiKeyRevoke:        apikey.NewApiKeyRevokeHandler(apiKeyRepository),
+		oauthToken:          oauth.NewTokenHandler(oauthClientRepository, tokenIssuer),
+	}
+}
+
+// registerRoutes registers the handlers with the app under every API
+// version, documenting each in the OpenAPI document. Versions share the
+// handlers and differ in how responses are rendered. The db only backs the
+// rate limit and idempotency stores configured to live in Postgres.
+func registerRoutes(app *fiber.App, document *openapi.Builder, applicationConfig *config.ApplicationConfig, db *gorm.DB, tenants domain.TenantRepository, h *handlers) {
+	app.Use(TenantMiddleware(applicationConfig.Tenancy, tenants))
+	registerDocumentation(app, document)
+
+	rateLimit := RateLimitMiddleware(applicationConfig.RateLimit, initRateLimitStore(applicationConfig.RateLimit, db))
+	authentication := AuthenticationMiddleware(applicationConfig.Security, h.apiKeyAuthenticator)
+	idempotency := IdempotencyMiddleware(applicationConfig.Idempotency, initIdempotencyStore(applicationConfig.Idempotency, db))
+	validator := initRequestValidator(applicationConfig.OpenAPI, document)
+
+	for _, version := range apiVersions {
+		public := &api{
+			router:     app,
+			document:   document,
+			version:    version,
+			deprecated: applicationConfig.Versioning.Versions[version].Deprecated != "",
+			middleware: []fiber.Handler{rateLimit},
+			validator:  validator,
+		}
+
+		route(public, fiber.MethodPost, "/login/", "Log in with email and password", h.login)
+		route(public, fiber.MethodGet, "/auth/verify-email", "Verify an email address", h.verifyEmail)
+		route(public, fiber.MethodPost, "/auth/verify-email/resend", "Resend the verification email", h.resendVerification)
+		route(public, fiber.MethodPost, "/auth/mfa/verify", "Complete a login with a second factor", h.mfaVerify)
+		route(public, fiber.MethodPost, "/oauth/token", "Issue a token to an OAuth client", h.oauthToken)
+		route(public, fiber.MethodGet, "/auth/oidc/:provider/login", "Start a login with an identity provider", h.oidcLogin)
+		route(public, fiber.MethodGet, "/auth/oidc/:provider/callback", "Complete a login with an identity provider", h.oidcCallback)
+
+		// Scoped to the version, so the public routes of later versions
+		// stay public.
+		app.Use("/"+version, authentication, idempotency)
+		protected := public.authenticated(applicationConfig.Idempotency.Enabled)
+
+		readUsers := protected.forServices(pkgauth.ScopeUsersRead)
+		writeUsers := protected.forServices(pkgauth.ScopeUsersWrite)
+
+		route(protected, fiber.MethodGet, "/healthcheck", "Check the service is up", h.healthCheck)
+		route(writeUsers, fiber.MethodPost, "/users/", "Create a user", h.userCreate)
+		route(readUsers, fiber.MethodGet, "/users/export", "Export users as NDJSON or CSV", h.userExport)
+		route(writeUsers, fiber.MethodPost, "/users/imports", "Import users from a CSV or NDJSON upload", h.userImport)
+		route(readUsers, fiber.MethodGet, "/users/imports/:id", "Get the status and report of a user import", h.userImportGet)
+		switch version {
+		case "v1":
+			route(readUsers, fiber.MethodGet, "/users/:id", "Get a user", versioned(h.userGet, (*user.UserGetResponse).V1))
+			route(readUsers, fiber.MethodGet, "/users/", "List users", versioned(h.userList, (*user.UserListResponse).V1))
+			route(protected, fiber.MethodGet, "/user", "Get the authenticated user", versioned(h.me, (*user.MeResponse).V1))
+		case "v2":
+			route(readUsers, fiber.MethodGet, "/users/:id", "Get a user", versioned(h.userGet, (*user.UserGetResponse).V2))
+			route(readUsers, fiber.MethodGet, "/users/", "List users", versioned(h.userList, (*user.UserListResponse).V2))
+			route(protected, fiber.MethodGet, "/user", "Get the authenticated user", versioned(h.me, (*user.MeResponse).V2))
+		}
+
+		interactive := protected.interactive()
+		route(interactive, fiber.MethodPut, "/user/password", "Change the password", h.changePassword)
+		route(interactive, fiber.MethodPost, "/user/api-keys", "Create an API key", h.apiKeyCreate)
+		route(interactive, fiber.MethodGet, "/user/api-keys", "List API keys", h.apiKeyList)
+		route(interactive, fiber.MethodDelete, "/user/api-keys/:id", "Revoke an API key", h.apiKeyRevoke)
+		route(interactive, fiber.MethodPost, "/user/mfa/totp", "Start TOTP enrollment", h.mfaEnroll)
+		route(interactive, fiber.MethodPost, "/user/mfa/totp/confirm", "Confirm TOTP enrollment", h.mfaConfirm)
+		route(interactive, fiber.MethodDelete, "/user/mfa/totp", "Disable TOTP", h.mfaDisable)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/domain"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/tenant"
+)
+
+const knownTenantTTL = time.Minute
+
+// TenantMiddleware resolves the tenant of the request from the configured
+// sources, falling back to the default tenant, and scopes the request
+// context to it. AuthenticationMiddleware later replaces it with the tenant
+// of the credentials.
+func TenantMiddleware(tenancyConfig config.TenancyConfig, tenants domain.TenantRepository) fiber.Handler {
+	known := &knownTenants{repository: tenants, expiresAt: make(map[string]time.Time)}
+
+	return func(c *fiber.Ctx) error {
+		id, source := resolveTenant(c, tenancyConfig)
+		if id == "" {
+			return c.Status(errorStatus(tenant.ErrUnknownTenant)).JSON(errorBody(tenant.ErrUnknownTenant))
+		}
+
+		ctx := c.UserContext()
+		if err := known.check(ctx, id); err != nil {
+			return c.Status(errorStatus(err)).JSON(errorBody(err))
+		}
+
+		c.SetUserContext(tenant.WithTenant(ctx, id, source))
+		return c.Next()
+	}
+}
+
+func resolveTenant(c *fiber.Ctx, tenancyConfig config.TenancyConfig) (string, tenant.Source) {
+	for _, resolver := range tenancyConfig.Resolvers {
+		switch resolver {
+		case "header":
+			if id := strings.TrimSpace(c.Get(tenancyConfig.Header)); id != "" {
+				return id, tenant.SourceHeader
+			}
+		case "subdomain":
+			if id := subdomainOf(c.Hostname(), tenancyConfig.BaseDomain); id != "" {
+				return id, tenant.SourceSubdomain
+			}
+		}
+	}
+	return tenancyConfig.DefaultTenant, tenant.SourceDefault
+}
+
+// subdomainOf returns the single label in front of the base domain, so
+// "acme.example.com" yields "acme" and "www.acme.example.com" nothing.
+func subdomainOf(host string, baseDomain string) string {
+	if baseDomain == "" {
+		return ""
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(baseDomain))
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// scopeToPrincipal moves the request to the tenant of the credentials, which
+// every principal is bound to. A tenant requested explicitly, by header or
+// subdomain, has to agree with it.
+func scopeToPrincipal(ctx context.Context, principalTenant string) (context.Context, error) {
+	requested, _ := tenant.FromContext(ctx)
+	if tenant.SourceOf(ctx) != tenant.SourceDefault && requested != principalTenant {
+		return nil, tenant.ErrTenantMismatch
+	}
+	return tenant.WithTenant(ctx, principalTenant, tenant.SourceToken), nil
+}
+
+// knownTenants remembers existing tenants for a while, so resolving one does
+// not cost a query per request. Unknown ids are looked up every time.
+type knownTenants struct {
+	repository domain.TenantRepository
+	mu         sync.Mutex
+	expiresAt  map[string]time.Time
+}
+
+func (k *knownTenants) check(ctx context.Context, id string) error {
+	now := time.Now()
+
+	k.mu.Lock()
+	expiresAt, ok := k.expiresAt[id]
+	k.mu.Unlock()
+	if ok && now.Before(expiresAt) {
+		return nil
+	}
+
+	_, err := k.repository.Get(ctx, id)
+	if errors.Is(err, domain.ErrNotFound) {
+		return tenant.ErrUnknownTenant
+	}
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.expiresAt[id] = now.Add(knownTenantTTL)
+	k.mu.Unlock()
+	return nil
+}
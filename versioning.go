@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/apperror"
+	"github.com/knetic0/production-ready-go-cqrs/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// apiVersions are the versions every route is registered under, oldest
+// first.
+var apiVersions = []string{"v1", "v2"}
+
+// unversionedPaths are served next to the API rather than as part of it.
+var unversionedPaths = []string{"/metrics", "/health", "/openapi.json", "/docs"}
+
+var errUnknownVersion = apperror.New(apperror.CodeNotAcceptable, "unknown API version")
+
+var apiVersionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "http_api_version_requests_total",
+	Help: "HTTP requests by the API version serving them and how the version was selected",
+}, []string{"version", "selection", "route"})
+
+func init() {
+	prometheus.MustRegister(apiVersionRequests)
+}
+
+type apiVersion struct {
+	name       string
+	deprecated time.Time
+	sunset     time.Time
+	link       string
+}
+
+// newAPIVersions reads the deprecation schedule of each version.
+func newAPIVersions(versioningConfig config.VersioningConfig) map[string]*apiVersion {
+	versions := make(map[string]*apiVersion, len(apiVersions))
+	for _, name := range apiVersions {
+		versionConfig := versioningConfig.Versions[name]
+		version := &apiVersion{name: name, link: versionConfig.Link}
+
+		var err error
+		if version.deprecated, err = parseVersionDate(versionConfig.Deprecated); err != nil {
+			log.Fatalf("invalid deprecation date of API version %s: %v", name, err)
+		}
+		if version.sunset, err = parseVersionDate(versionConfig.Sunset); err != nil {
+			log.Fatalf("invalid sunset date of API version %s: %v", name, err)
+		}
+		versions[name] = version
+	}
+
+	for name := range versioningConfig.Versions {
+		if _, ok := versions[name]; !ok {
+			log.Fatalf("unknown API version %q", name)
+		}
+	}
+	if _, ok := versions[versioningConfig.Default]; !ok {
+		log.Fatalf("unknown default API version %q", versioningConfig.Default)
+	}
+	return versions
+}
+
+func parseVersionDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.DateOnly, date)
+}
+
+// VersionMiddleware serves requests without a version in the path, e.g.
+// "/users/", with the version their Accept header asks for, e.g.
+// "application/vnd.<vendor>.v2+json", or else the default one, by
+// rewriting the path. It must be registered ahead of every route: fiber
+// narrows the routes it tries by the first characters of the path, and
+// only middleware in front of all of them keeps its position when the path
+// changes underneath it.
+func VersionMiddleware(versioningConfig config.VersioningConfig) fiber.Handler {
+	versions := newAPIVersions(versioningConfig)
+	mediaTypePrefix := "application/vnd." + versioningConfig.Vendor + "."
+
+	return func(c *fiber.Ctx) error {
+		path := c.Path()
+		if isUnversionedPath(path) {
+			return c.Next()
+		}
+
+		name, selection := versionOfPath(path), "path"
+		if name == "" {
+			c.Vary(fiber.HeaderAccept)
+
+			var requested bool
+			name, requested = versionFromAccept(c.Get(fiber.HeaderAccept), mediaTypePrefix)
+			if requested {
+				selection = "accept"
+			} else {
+				name, selection = versioningConfig.Default, "default"
+			}
+			if _, ok := versions[name]; !ok {
+				return c.Status(errorStatus(errUnknownVersion)).JSON(errorBody(errUnknownVersion))
+			}
+			c.Path("/" + name + path)
+		}
+
+		version := versions[name]
+		c.Set("API-Version", version.name)
+		if !version.deprecated.IsZero() {
+			// RFC 9745 and RFC 8594.
+			c.Set("Deprecation", "@"+strconv.FormatInt(version.deprecated.Unix(), 10))
+			if version.link != "" {
+				c.Append(fiber.HeaderLink, "<"+version.link+`>; rel="deprecation"; type="text/html"`)
+			}
+		}
+		if !version.sunset.IsZero() {
+			c.Set("Sunset", version.sunset.UTC().Format(http.TimeFormat))
+		}
+
+		err := c.Next()
+		apiVersionRequests.WithLabelValues(version.name, selection, unversionedPath(c.Route().Path)).Inc()
+		return err
+	}
+}
+
+// versionFromAccept returns the version named by the first vendor media
+// type in the Accept header, which may be one no route is registered for.
+func versionFromAccept(accept, mediaTypePrefix string) (string, bool) {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if !strings.HasPrefix(mediaType, mediaTypePrefix) {
+			continue
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(mediaType, mediaTypePrefix), "+")
+		return name, true
+	}
+	return "", false
+}
+
+func isUnversionedPath(path string) bool {
+	for _, unversioned := range unversionedPaths {
+		if path == unversioned || strings.HasPrefix(path, unversioned+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// versionOfPath returns the version path starts with, if any.
+func versionOfPath(path string) string {
+	for _, name := range apiVersions {
+		if path == "/"+name || strings.HasPrefix(path, "/"+name+"/") {
+			return name
+		}
+	}
+	return ""
+}
+
+// unversionedPath strips the version from path, so that e.g. rate limits
+// configured for "/login/" apply to every version of the route.
+func unversionedPath(path string) string {
+	name := versionOfPath(path)
+	if name == "" {
+		return path
+	}
+	if path = strings.TrimPrefix(path, "/"+name); path == "" {
+		return "/"
+	}
+	return path
+}
+
+// versionedHandler renders the response of a handler shared by all
+// versions the way one version of the API does.
+type versionedHandler[TReq Request, TRes Response, TOut Response] struct {
+	handler HandlerInterface[TReq, TRes]
+	render  func(*TRes) *TOut
+}
+
+func versioned[TReq Request, TRes Response, TOut Response](handler HandlerInterface[TReq, TRes], render func(*TRes) *TOut) HandlerInterface[TReq, TOut] {
+	return &versionedHandler[TReq, TRes, TOut]{handler: handler, render: render}
+}
+
+func (h *versionedHandler[TReq, TRes, TOut]) Handle(ctx context.Context, request *TReq) (*TOut, error) {
+	response, err := h.handler.Handle(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return h.render(response), nil
+}
+
+// Unwrap returns the handler operations are named after.
+func (h *versionedHandler[TReq, TRes, TOut]) Unwrap() any {
+	return h.handler
+}